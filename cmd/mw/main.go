@@ -1,32 +1,85 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"github.com/blockcypher/libgrin/core"
 	"github.com/mitchellh/go-homedir"
 	"github.com/olegabu/go-mimblewimble/internal/abci"
 	"github.com/olegabu/go-mimblewimble/internal/wallet"
 	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/olegabu/go-mimblewimble/pkg/slatepack"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	tendermintCmd "github.com/tendermint/tendermint/cmd/tendermint/commands"
 	cfg "github.com/tendermint/tendermint/config"
 	"github.com/tendermint/tendermint/libs/cli"
+	"github.com/tendermint/tendermint/types"
+	"golang.org/x/crypto/ssh/terminal"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 const defaultAsset = "¤"
 
+// dateLayout is of dates history is filtered by
+const dateLayout = "2006-01-02"
+
+// formats of what commands print out
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
 // flags
 var (
 	// global
 	flagAddress string
 	flagPersist string
+	flagOutput  string
+
+	// slates
+	flagTo           string
+	flagSlatepack    bool
+	flagSlateVersion uint16
+	flagSelection    string
+	flagInputs       []string
+	flagLateLock     bool
+
+	// fees
+	flagFee     uint64
+	flagFeeRate uint64
+	flagMinFee  uint64
+	flagMaxFee  uint64
+
+	// expiry
+	flagTTL          time.Duration
+	flagExpiryHeight uint64
+	flagHeight       uint64
+
+	// history
+	flagTxAsset  string
+	flagTxStatus string
+	flagSince    string
+	flagUntil    string
+
+	// balance
+
+	// keys
+	flagWords      int
+	flagPassphrase bool
+	flagFromShares bool
+	flagThreshold  int
+	flagShares     int
 )
 
 var rootCmd *cobra.Command
@@ -68,10 +121,10 @@ func presetRequiredFlags(cmd *cobra.Command) {
 func main() {
 
 	var initCmd = &cobra.Command{
-		Use:     "init [mnemonic]",
+		Use:     "init [mnemonic | share...]",
 		Short:   "Creates or recovers user's secret key",
-		Long:    `Creates user's master secret key if not found, or re-creates it from a supplied mnemonic'.`,
-		Example: `to create: mw init, to recover: mw init "citizen convince comfort sleep student potato frequent bike catalog dinosaur speed knife"`,
+		Long:    `Creates user's master secret key if not found, or re-creates it from a supplied mnemonic', and encrypts it with the password prompted for or set in MW_PASSWORD. The key is made from the mnemonic and an optional BIP39 passphrase prompted for with --passphrase or set in MW_PASSPHRASE, recovery needs the same passphrase. With --from-shares the key is recovered from mnemonic shares made by mw backup split.`,
+		Example: `to create: mw init --words 24 --passphrase, to recover: mw init "citizen convince comfort sleep student potato frequent bike catalog dinosaur speed knife", from shares: mw init --from-shares "first share words" "second share words"`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			w, err := wallet.NewWalletWithoutMasterKey(flagPersist)
 			if err != nil {
@@ -79,25 +132,68 @@ func main() {
 			}
 			defer w.Close()
 
+			if flagFromShares {
+				if len(args) == 0 {
+					return errors.New("need mnemonic shares to recover the key from")
+				}
+
+				password, err := readNewPassword(passwordEnv)
+				if err != nil {
+					return errors.Wrap(err, "cannot read password")
+				}
+
+				fmt.Printf("master secret key is in %v\n", flagPersist)
+
+				err = w.InitMasterKeyFromShares(args, password)
+				if err != nil {
+					return errors.Wrap(err, "cannot initialize key from shares")
+				}
+				return nil
+			}
+
 			var mnemonic string
 			if len(args) > 0 {
 				mnemonic = args[0]
 			}
 
+			var password, passphrase string
+			if w.MasterKeyExists() {
+				password, err = readPassword(passwordEnv, "password: ")
+			} else {
+				password, err = readNewPassword(passwordEnv)
+			}
+			if err != nil {
+				return errors.Wrap(err, "cannot read password")
+			}
+
+			// the passphrase makes a new key, an existing one is decrypted with the password alone
+			if !w.MasterKeyExists() {
+				passphrase, err = readPassphrase()
+				if err != nil {
+					return errors.Wrap(err, "cannot read passphrase")
+				}
+			}
+
 			fmt.Printf("master secret key is in %v\n", flagPersist)
 
-			createdMnemonic, err := w.InitMasterKey(mnemonic)
+			createdMnemonic, err := w.InitMasterKey(mnemonic, passphrase, flagWords, password)
 			if err != nil {
 				return errors.Wrap(err, "cannot initialize key")
 			}
 
 			if len(createdMnemonic) > 0 {
 				fmt.Printf("please record all the words of this mnemonic, use it if you ever need to recover your key\n%s\n", createdMnemonic)
+				if len(passphrase) > 0 {
+					fmt.Println("you will need the passphrase too")
+				}
 			}
 
 			return nil
 		},
 	}
+	initCmd.Flags().IntVar(&flagWords, "words", wallet.DefaultMnemonicWords, "number of words of a new mnemonic: 12, 15, 18, 21 or 24")
+	initCmd.Flags().BoolVar(&flagPassphrase, "passphrase", false, "prompt for BIP39 passphrase the key is made from together with the mnemonic, unless set in MW_PASSPHRASE")
+	initCmd.Flags().BoolVar(&flagFromShares, "from-shares", false, "recover the key from mnemonic shares given as arguments")
 
 	var issueCmd = &cobra.Command{
 		Use:   "issue amount [asset]",
@@ -114,7 +210,7 @@ func main() {
 				asset = args[1]
 			}
 
-			w, err := wallet.NewWallet(flagPersist)
+			w, err := openWallet()
 			if err != nil {
 				return errors.Wrap(err, "cannot create wallet")
 			}
@@ -129,15 +225,15 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot write file "+fileName)
 			}
-			fmt.Printf("wrote transaction to issue %v, send it to the network: broadcast %v\n", args[0], fileName)
-			return nil
+			return printResult(result{File: fileName, Status: "issued"},
+				fmt.Sprintf("wrote transaction to issue %v, send it to the network: broadcast %v\n", args[0], fileName))
 		},
 	}
 
 	var sendCmd = &cobra.Command{
 		Use:   "send amount [asset]",
 		Short: "Initiates a send-receive transaction",
-		Long:  `Payer creates a json file with a send slate to pass to the payee.`,
+		Long:  `Payer creates a json file with a send slate to pass to the payee. Payer pays the fee, set with --fee or calculated from the transaction weight and --fee-rate.`,
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			amount, err := strconv.Atoi(args[0])
@@ -159,13 +255,22 @@ func main() {
 				receiveAsset = args[3]
 			}
 
-			w, err := wallet.NewWallet(flagPersist)
+			w, err := openWallet()
 			if err != nil {
 				return errors.Wrap(err, "cannot create wallet")
 			}
 			defer w.Close()
 
-			slateBytes, err := w.Send(uint64(amount), asset, uint64(receiveAmount), receiveAsset)
+			err = setSelection(w)
+			if err != nil {
+				return errors.Wrap(err, "cannot setSelection")
+			}
+			setFee(cmd, w)
+			w.SetInputs(flagInputs)
+			w.SetLateLock(flagLateLock)
+			setExpiry(w)
+
+			slateBytes, err := w.Send(uint64(amount), asset, uint64(receiveAmount), receiveAsset, flagSlateVersion)
 			if err != nil {
 				return errors.Wrap(err, "cannot Send")
 			}
@@ -173,20 +278,32 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot parse id from slate")
 			}
-			fileName := "slate-send-" + string(id) + ".json"
-			err = ioutil.WriteFile(fileName, slateBytes, 0644)
+			fileName, err := writeSlate(w, "slate-send-"+string(id), slateBytes, flagSlatepack || len(flagTo) > 0, flagTo)
 			if err != nil {
-				return errors.Wrap(err, "cannot write file "+fileName)
+				return errors.Wrap(err, "cannot writeSlate")
 			}
-			fmt.Printf("wrote slate, pass it to the receiver to fill in and respond: receive %v \n", fileName)
-			return nil
+			return printResult(result{ID: string(id), File: fileName, Status: "sent"},
+				fmt.Sprintf("wrote slate, pass it to the receiver to fill in and respond: receive %v \n", fileName))
 		},
 	}
+	sendCmd.Flags().StringVarP(&flagTo,
+		"to",
+		"",
+		"",
+		"slatepack address of the receiver to encrypt the slate to")
+	sendCmd.Flags().BoolVar(&flagSlatepack, "slatepack", false, "write armored slatepack instead of json")
+	sendCmd.Flags().Uint16Var(&flagSlateVersion, "slate-version", wallet.SlateVersion4, "slate version: 3 for full or 4 for compact")
+	sendCmd.Flags().StringVar(&flagSelection, "selection", "", "coin selection for this transaction instead of the wallet's: "+strings.Join(wallet.Selections, ", "))
+	sendCmd.Flags().Uint64Var(&flagFee, "fee", 0, "fee to pay instead of one calculated with fee rate")
+	sendCmd.Flags().Uint64Var(&flagFeeRate, "fee-rate", wallet.DefaultFeeRate, "fee per transaction weight unit")
+	sendCmd.Flags().StringSliceVar(&flagInputs, "inputs", nil, "commits of outputs to spend, all of them, instead of ones picked by coin selection")
+	sendCmd.Flags().BoolVar(&flagLateLock, "late-lock", false, "pick and lock inputs when finalizing instead of now, the fee is estimated for inputs coin selection would pick now")
+	addExpiryFlags(sendCmd)
 
 	var invoiceCmd = &cobra.Command{
 		Use:   "invoice amount [asset]",
 		Short: "Initiates an invoice-pay transaction",
-		Long:  `Payee creates a json file with an invoice slate to pass to the payer.`,
+		Long:  `Payee creates a json file with an invoice slate to pass to the payer. Payer pays the fee the invoice asks for, set with --fee or estimated with --fee-rate.`,
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			amount, err := strconv.Atoi(args[0])
@@ -198,13 +315,16 @@ func main() {
 				asset = args[1]
 			}
 
-			w, err := wallet.NewWallet(flagPersist)
+			w, err := openWallet()
 			if err != nil {
 				return errors.Wrap(err, "cannot create wallet")
 			}
 			defer w.Close()
 
-			slateBytes, err := w.Send(0, "", uint64(amount), asset)
+			setFee(cmd, w)
+			setExpiry(w)
+
+			slateBytes, err := w.Send(0, "", uint64(amount), asset, flagSlateVersion)
 			if err != nil {
 				return errors.Wrap(err, "cannot Send")
 			}
@@ -212,33 +332,51 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot parse id from slate")
 			}
-			fileName := "slate-send-" + string(id) + ".json"
-			err = ioutil.WriteFile(fileName, slateBytes, 0644)
+			fileName, err := writeSlate(w, "slate-send-"+string(id), slateBytes, flagSlatepack || len(flagTo) > 0, flagTo)
 			if err != nil {
-				return errors.Wrap(err, "cannot write file "+fileName)
+				return errors.Wrap(err, "cannot writeSlate")
 			}
-			fmt.Printf("wrote slate, pass it to the payer to fill in and respond: receive %v \n", fileName)
-			return nil
+			return printResult(result{ID: string(id), File: fileName, Status: "invoiced"},
+				fmt.Sprintf("wrote slate, pass it to the payer to fill in and respond: receive %v \n", fileName))
 		},
 	}
+	invoiceCmd.Flags().StringVarP(&flagTo,
+		"to",
+		"",
+		"",
+		"slatepack address of the payer to encrypt the slate to")
+	invoiceCmd.Flags().BoolVar(&flagSlatepack, "slatepack", false, "write armored slatepack instead of json")
+	invoiceCmd.Flags().Uint16Var(&flagSlateVersion, "slate-version", wallet.SlateVersion4, "slate version: 3 for full or 4 for compact")
+	invoiceCmd.Flags().Uint64Var(&flagFee, "fee", 0, "fee the payer is asked to pay instead of one calculated with fee rate")
+	invoiceCmd.Flags().Uint64Var(&flagFeeRate, "fee-rate", wallet.DefaultFeeRate, "fee per transaction weight unit")
+	addExpiryFlags(invoiceCmd)
 
 	var receiveCmd = &cobra.Command{
-		Use:   "receive slate_file",
+		Use:   "receive [slate_file]",
 		Short: "Receives transfer or pays an invoice or exchange by creating a response slate",
-		Long:  `Creates json file with a response slate with own outputs and outputs and partial signature.`,
-		Args:  cobra.ExactArgs(1),
+		Long:  `Creates json file with a response slate with own outputs and outputs and partial signature. Reads json or armored slatepack from the file or stdin, responds to a slatepack with a slatepack.`,
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			slateFileName := args[0]
-			slateBytes, err := ioutil.ReadFile(slateFileName)
+			w, err := openWallet()
 			if err != nil {
-				return errors.Wrap(err, "cannot read sender slate file "+slateFileName)
+				return errors.Wrap(err, "cannot create wallet")
 			}
+			defer w.Close()
 
-			w, err := wallet.NewWallet(flagPersist)
+			err = setSelection(w)
 			if err != nil {
-				return errors.Wrap(err, "cannot create wallet")
+				return errors.Wrap(err, "cannot setSelection")
+			}
+			w.SetFeePolicy(wallet.FeePolicy{MinFee: flagMinFee, MaxFee: flagMaxFee})
+			err = setHeight(w)
+			if err != nil {
+				return errors.Wrap(err, "cannot setHeight")
+			}
+
+			slateBytes, pack, err := readSlate(w, args)
+			if err != nil {
+				return errors.Wrap(err, "cannot read sender slate")
 			}
-			defer w.Close()
 
 			responseSlateBytes, err := w.Respond(slateBytes)
 			if err != nil {
@@ -248,33 +386,46 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot parse id from slate")
 			}
-			fileName := "slate-receive-" + string(id) + ".json"
-			err = ioutil.WriteFile(fileName, responseSlateBytes, 0644)
+			// respond encrypted to the sender if the slate came encrypted
+			var recipient string
+			if pack != nil && pack.Encrypted {
+				recipient = pack.Sender
+			}
+			fileName, err := writeSlate(w, "slate-receive-"+string(id), responseSlateBytes, pack != nil, recipient)
 			if err != nil {
-				return errors.Wrap(err, "cannot write file "+fileName)
+				return errors.Wrap(err, "cannot writeSlate")
 			}
-			fmt.Printf("wrote slate, pass it back to the sender: finalize or post %v\n", fileName)
-			return nil
+			return printResult(result{ID: string(id), File: fileName, Status: "responded"},
+				fmt.Sprintf("wrote slate, pass it back to the sender: finalize or post %v\n", fileName))
 		},
 	}
 
+	receiveCmd.Flags().StringVar(&flagSelection, "selection", "", "coin selection to pay with instead of the wallet's: "+strings.Join(wallet.Selections, ", "))
+	receiveCmd.Flags().Uint64Var(&flagMinFee, "min-fee", 0, "refuse slates with a lower fee")
+	receiveCmd.Flags().Uint64Var(&flagMaxFee, "max-fee", 0, "refuse to pay invoices with a higher fee, 0 for no limit")
+	addHeightFlags(receiveCmd, "to refuse slates expired by it")
+
 	var finalizeCmd = &cobra.Command{
-		Use:   "finalize slate_receive_file",
+		Use:   "finalize [slate_receive_file]",
 		Short: "Finalizes transfer by creating a transaction from a response slate",
-		Long:  `Creates a json file with a transaction to be sent to the network to get validated.`,
-		Args:  cobra.ExactArgs(1),
+		Long:  `Creates a json file with a transaction to be sent to the network to get validated. Reads json or armored slatepack from the file or stdin.`,
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			slateFileName := args[0]
-			slateBytes, err := ioutil.ReadFile(slateFileName)
+			w, err := openWallet()
 			if err != nil {
-				return errors.Wrap(err, "cannot read receiver slate file "+slateFileName)
+				return errors.Wrap(err, "cannot create wallet")
 			}
+			defer w.Close()
 
-			w, err := wallet.NewWallet(flagPersist)
+			err = setHeight(w)
 			if err != nil {
-				return errors.Wrap(err, "cannot create wallet")
+				return errors.Wrap(err, "cannot setHeight")
+			}
+
+			slateBytes, _, err := readSlate(w, args)
+			if err != nil {
+				return errors.Wrap(err, "cannot read receiver slate")
 			}
-			defer w.Close()
 
 			txBytes, err := w.Finalize(slateBytes)
 			if err != nil {
@@ -289,18 +440,20 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot write file "+fileName)
 			}
-			fmt.Printf("wrote transaction %v, send it to the network to get validated: broadcast %v\nthen tell the wallet the transaction has been confirmed: confirm %v\n", string(id), fileName, string(id))
-			return nil
+			return printResult(result{ID: string(id), File: fileName, Status: "finalized"},
+				fmt.Sprintf("wrote transaction %v, send it to the network to get validated: broadcast %v\nthen tell the wallet the transaction has been confirmed: confirm %v\n", string(id), fileName, string(id)))
 		},
 	}
 
+	addHeightFlags(finalizeCmd, "to refuse to finalize slates expired by it")
+
 	var confirmCmd = &cobra.Command{
 		Use:   "confirm transaction_id",
 		Short: "Tells the wallet the transaction has been confirmed",
 		Long:  `Tells the wallet the transaction has been confirmed by the network so the outputs become valid and inputs spent.`,
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			w, err := wallet.NewWallet(flagPersist)
+			w, err := openWallet()
 			if err != nil {
 				return errors.Wrap(err, "cannot create wallet")
 			}
@@ -310,18 +463,18 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot Confirm")
 			}
-			fmt.Println("confirmed transaction: marked inputs as spent and outputs as confirmed")
-			return nil
+			return printResult(result{ID: args[0], Status: "confirmed"},
+				"confirmed transaction: marked inputs as spent and outputs as confirmed\n")
 		},
 	}
 
 	var cancelCmd = &cobra.Command{
 		Use:   "cancel transaction_id",
 		Short: "Tells the wallet the transaction is canceled",
-		Long:  `Tells the wallet the transaction is canceled so the inputs become spendable and outputs are canceled.`,
+		Long:  `Tells the wallet the transaction is canceled so the inputs become spendable and outputs are canceled. A slate the wallet started is canceled by its id before it is finalized, it cannot be finalized after.`,
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			w, err := wallet.NewWallet(flagPersist)
+			w, err := openWallet()
 			if err != nil {
 				return errors.Wrap(err, "cannot create wallet")
 			}
@@ -331,8 +484,8 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot Cancel")
 			}
-			fmt.Println("canceled transaction: marked inputs as spendable and outputs canceled")
-			return nil
+			return printResult(result{ID: args[0], Status: "canceled"},
+				"canceled transaction: marked inputs as spendable and outputs canceled\n")
 		},
 	}
 
@@ -351,23 +504,36 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot transaction.ValidateTransactionBytes")
 			}
-			fmt.Printf("transaction %v is valid\n", tx.ID)
-			return nil
+			return printResult(result{ID: tx.ID.String(), File: transactionFileName, Status: "valid"},
+				fmt.Sprintf("transaction %v is valid\n", tx.ID))
 		},
 	}
 
 	var infoCmd = &cobra.Command{
 		Use:   "info",
 		Short: "Prints out outputs, slates, transactions",
-		Long:  `Prints out outputs, slates, transactions stored in the wallet.`,
+		Long:  `Prints out outputs, slates, transactions stored in the wallet, and how long slates waiting for the counterparty are valid for. Slates that have expired are canceled.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			w, err := wallet.NewWallet(flagPersist)
+			w, err := openWallet()
 			if err != nil {
 				return errors.Wrap(err, "cannot create wallet")
 			}
 			defer w.Close()
 
+			err = setHeight(w)
+			if err != nil {
+				return errors.Wrap(err, "cannot setHeight")
+			}
+
+			if isJSONOutput() {
+				report, err := w.Report()
+				if err != nil {
+					return errors.Wrap(err, "cannot get Report")
+				}
+				return printJSON(report)
+			}
+
 			err = w.Print()
 			if err != nil {
 				return errors.Wrap(err, "cannot Print")
@@ -375,6 +541,7 @@ func main() {
 			return nil
 		},
 	}
+	addHeightFlags(infoCmd, "to cancel slates expired by it")
 
 	var broadcastCmd = &cobra.Command{
 		Use:   "broadcast transaction_file",
@@ -394,11 +561,14 @@ func main() {
 			}
 			defer client.Stop()
 
-			err = client.Broadcast(transactionBytes)
+			broadcastResult, err := client.Broadcast(transactionBytes)
 			if err != nil {
 				return errors.Wrap(err, "cannot client.Broadcast")
 			}
 
+			if isJSONOutput() {
+				return printJSON(broadcastResult)
+			}
 			return nil
 		},
 	}
@@ -409,22 +579,26 @@ func main() {
 		"address of tendermint socket to broadcast to")
 
 	var postCmd = &cobra.Command{
-		Use:   "post slate_receive_file",
+		Use:   "post [slate_receive_file]",
 		Short: "Finalizes transfer by creating a transaction from a response slate then broadcasts the transaction",
-		Long:  `Creates a json file with a transaction to get validated then broadcasts the transaction to the network synchronously.`,
-		Args:  cobra.ExactArgs(1),
+		Long:  `Creates a json file with a transaction to get validated then broadcasts the transaction to the network synchronously. Reads json or armored slatepack from the file or stdin.`,
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			slateFileName := args[0]
-			slateBytes, err := ioutil.ReadFile(slateFileName)
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			err = setHeight(w)
 			if err != nil {
-				return errors.Wrap(err, "cannot read receiver slate file "+slateFileName)
+				return errors.Wrap(err, "cannot setHeight")
 			}
 
-			w, err := wallet.NewWallet(flagPersist)
+			slateBytes, _, err := readSlate(w, args)
 			if err != nil {
-				return errors.Wrap(err, "cannot create wallet")
+				return errors.Wrap(err, "cannot read receiver slate")
 			}
-			defer w.Close()
 
 			txBytes, err := w.Finalize(slateBytes)
 			if err != nil {
@@ -439,7 +613,9 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "cannot write file "+fileName)
 			}
-			fmt.Printf("wrote %v, sending it to the network to get validated\n", fileName)
+			if !isJSONOutput() {
+				fmt.Printf("wrote %v, sending it to the network to get validated\n", fileName)
+			}
 
 			client, err := abci.NewClient(flagAddress)
 			if err != nil {
@@ -447,11 +623,14 @@ func main() {
 			}
 			defer client.Stop()
 
-			err = client.Broadcast(txBytes)
+			broadcastResult, err := client.Broadcast(txBytes)
 			if err != nil {
 				return errors.Wrap(err, "cannot client.Broadcast")
 			}
 
+			if isJSONOutput() {
+				return printJSON(postResult{result: result{ID: string(id), File: fileName, Status: "posted"}, Broadcast: broadcastResult})
+			}
 			return nil
 		},
 	}
@@ -460,6 +639,7 @@ func main() {
 		"",
 		"tcp://0.0.0.0:26657",
 		"address of tendermint socket to post to")
+	postCmd.Flags().Uint64Var(&flagHeight, "height", 0, "current height of the chain to refuse to finalize slates expired by it, queried from the node when not given")
 
 	var eventsCmd = &cobra.Command{
 		Use:   "events",
@@ -472,7 +652,24 @@ func main() {
 			}
 			defer client.Stop()
 
-			err = client.ListenForTxEvents(client.PrintTxEvent)
+			onEvent := client.PrintTxEvent
+			if isJSONOutput() {
+				// one json object per line for each transaction event
+				onEvent = func(evt types.TMEventData) {
+					txEvent, ok := abci.ParseTxEvent(evt)
+					if !ok {
+						return
+					}
+					eventBytes, err := json.Marshal(txEvent)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, errors.Wrap(err, "cannot marshal event to json"))
+						return
+					}
+					fmt.Println(string(eventBytes))
+				}
+			}
+
+			err = client.ListenForTxEvents(onEvent)
 			if err != nil {
 				return errors.Wrap(err, "cannot client.ListenForEvents")
 			}
@@ -491,6 +688,17 @@ func main() {
 		Short: "Listens to and processes successful transaction events",
 		Long:  `Subscribes to events from the network and updates wallet with confirmed transactions.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// the password is read once, the wallet is opened for each event not to keep its database locked
+			password, err := readPassword(passwordEnv, "password: ")
+			if err != nil {
+				return errors.Wrap(err, "cannot read password")
+			}
+			w, err := wallet.NewWallet(flagPersist, password)
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			w.Close()
+
 			client, err := abci.NewClient(flagAddress)
 			if err != nil {
 				return errors.Wrap(err, "cannot get new client")
@@ -499,9 +707,10 @@ func main() {
 
 			err = client.ListenForSuccessfulTxEvents(func(transactionId []byte) {
 
-				w, err := wallet.NewWallet(flagPersist)
+				w, err := wallet.NewWallet(flagPersist, password)
 				if err != nil {
 					fmt.Println(errors.Wrap(err, "cannot create wallet"))
+					return
 				}
 				defer w.Close()
 
@@ -528,64 +737,1794 @@ func main() {
 		"tcp://0.0.0.0:26657",
 		"address of tendermint socket to subscribe for events")
 
-	var doublespend bool
-	var nodeCmd = &cobra.Command{
-		Use:   "node",
-		Short: "Runs blockchain node",
-		Long:  `Runs Tendermint node with built in Mimblewimble ABCI app.`,
+	var blockCmd = &cobra.Command{
+		Use:   "block [height]",
+		Short: "Prints out block header",
+		Long:  `Queries the network for a header of the block at the given height, or of the last block.`,
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := abci.Start(flagPersist, doublespend)
+			path := "block"
+			if len(args) > 0 {
+				height, err := strconv.Atoi(args[0])
+				if err != nil {
+					return errors.Wrap(err, "cannot parse height")
+				}
+				path += "/" + strconv.Itoa(height)
+			}
+
+			client, err := abci.NewClient(flagAddress)
 			if err != nil {
-				return errors.Wrap(err, "cannot abci.Start")
+				return errors.Wrap(err, "cannot get new client")
+			}
+			defer client.Stop()
+
+			blockBytes, err := client.Query(path)
+			if err != nil {
+				return errors.Wrap(err, "cannot client.Query")
+			}
+
+			block := ledger.Block{}
+			err = json.Unmarshal(blockBytes, &block)
+			if err != nil {
+				return errors.Wrap(err, "cannot unmarshal block")
+			}
+
+			if isJSONOutput() {
+				return printJSON(block)
+			}
+
+			fmt.Printf("block %v at %v\nstate root %v\n%v outputs, %v kernels in the ledger\ntotal offset %v\n%v kernels in the block:\n",
+				block.Height, block.Time, block.StateRoot, block.NumOutputs, block.NumKernels, block.TotalOffset, len(block.Kernels))
+			for _, kernel := range block.Kernels {
+				fmt.Println(kernel)
 			}
 			return nil
 		},
 	}
-	nodeCmd.Flags().BoolVar(&doublespend, "doublespend", false, "Double spend inputs for testing")
+	blockCmd.Flags().StringVarP(&flagAddress,
+		"address",
+		"",
+		"tcp://0.0.0.0:26657",
+		"address of tendermint socket to query")
 
-	rootCmd = &cobra.Command{
-		Use:          "mw",
-		Short:        "Wallet and validator for Mimblewimble",
-		Long:         `Experimental wallet and validator for Mimblewimble protocol.`,
-		SilenceUsage: true,
+	var restoreCmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Restores wallet outputs from the network's ledger",
+		Long:  `Pages through unspent outputs in the network's ledger, finds the ones made with keys of the wallet by rewinding their bulletproofs and saves them in the wallet. Run it after re-creating the key with init and the mnemonic.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			const pageSize = 100
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			client, err := abci.NewClient(flagAddress)
+			if err != nil {
+				return errors.Wrap(err, "cannot get new client")
+			}
+			defer client.Stop()
+
+			assetsBytes, err := client.Query("asset")
+			if err != nil {
+				return errors.Wrap(err, "cannot client.Query assets")
+			}
+			assetTotals := make(map[string]uint64)
+			err = json.Unmarshal(assetsBytes, &assetTotals)
+			if err != nil {
+				return errors.Wrap(err, "cannot unmarshal assets")
+			}
+			var assets []string
+			for asset := range assetTotals {
+				assets = append(assets, asset)
+			}
+			sort.Strings(assets)
+
+			var outputs []core.Output
+			var after string
+			for {
+				path := "outputs/" + strconv.Itoa(pageSize)
+				if len(after) > 0 {
+					path += "/" + after
+				}
+				pageBytes, err := client.Query(path)
+				if err != nil {
+					return errors.Wrap(err, "cannot client.Query outputs")
+				}
+				var page []core.Output
+				err = json.Unmarshal(pageBytes, &page)
+				if err != nil {
+					return errors.Wrap(err, "cannot unmarshal outputs")
+				}
+				outputs = append(outputs, page...)
+				if len(page) < pageSize {
+					break
+				}
+				after = page[len(page)-1].Commit
+			}
+
+			restored, err := w.Restore(outputs, assets)
+			if err != nil {
+				return errors.Wrap(err, "cannot Restore")
+			}
+			if isJSONOutput() {
+				return printJSON(restoreResult{Scanned: len(outputs), Restored: restored})
+			}
+
+			fmt.Printf("restored %v of %v outputs in the ledger\n", len(restored), len(outputs))
+			for _, o := range restored {
+				fmt.Printf("%v %v %v\n", o.Value, o.Asset, o.Commit)
+			}
+			return nil
+		},
 	}
+	restoreCmd.Flags().StringVarP(&flagAddress,
+		"address",
+		"",
+		"tcp://0.0.0.0:26657",
+		"address of tendermint socket to query")
 
-	rootCmd.AddCommand(initCmd, issueCmd, sendCmd, receiveCmd, invoiceCmd, finalizeCmd, postCmd,
-		confirmCmd, cancelCmd, validateCmd, infoCmd, nodeCmd, broadcastCmd, eventsCmd, listenCmd)
+	var ledgerCmd = &cobra.Command{
+		Use:   "ledger",
+		Short: "Exports, imports and audits ledger state",
+		Long:  `Moves ledger state of the node between networks and validates it offline.`,
+	}
 
-	dir, err := homedir.Dir()
-	if err != nil {
-		panic("cannot get homedir")
+	var ledgerExportCmd = &cobra.Command{
+		Use:   "export [state_file]",
+		Short: "Exports ledger state to a file",
+		Long:  `Writes outputs, kernels, assets and height from the node's database to a json file. Stop the node first.`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := abci.NewLeveldbDatabase(flagPersist)
+			if err != nil {
+				return errors.Wrap(err, "cannot create NewLeveldbDatabase")
+			}
+			defer db.Close()
+
+			state, err := ledger.ExportState(db)
+			if err != nil {
+				return errors.Wrap(err, "cannot ExportState")
+			}
+			stateBytes, err := json.Marshal(state)
+			if err != nil {
+				return errors.Wrap(err, "cannot marshal state")
+			}
+
+			fileName := "ledger-" + strconv.FormatInt(state.Height, 10) + ".json"
+			if len(args) > 0 {
+				fileName = args[0]
+			}
+			err = ioutil.WriteFile(fileName, stateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote ledger state of height %v with %v outputs and %v kernels to %v\n", state.Height, len(state.Outputs), len(state.Kernels), fileName)
+			return nil
+		},
 	}
-	mwroot := filepath.Join(dir, ".mw")
 
-	rootCmd.PersistentFlags().StringVarP(&flagPersist, "persist", "", mwroot, "directory to use to store databases and user's master secret key")
+	var flagGenesis string
+	var ledgerImportCmd = &cobra.Command{
+		Use:   "import state_file",
+		Short: "Imports ledger state into a fresh node",
+		Long:  `Validates exported ledger state and places it into genesis of a fresh node, which loads it when the chain starts.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stateFileName := args[0]
+			stateBytes, err := ioutil.ReadFile(stateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read state file "+stateFileName)
+			}
 
-	// Tendermint commands
+			_, msg, err := ledger.ValidateStateBytes(stateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot ValidateStateBytes")
+			}
 
-	tendermintRootCmd := tendermintCmd.RootCmd
+			genesis, err := types.GenesisDocFromFile(flagGenesis)
+			if err != nil {
+				return errors.Wrap(err, "cannot read genesis file "+flagGenesis)
+			}
+			genesis.AppState = stateBytes
+			err = genesis.SaveAs(flagGenesis)
+			if err != nil {
+				return errors.Wrap(err, "cannot write genesis file "+flagGenesis)
+			}
+			fmt.Printf("imported valid ledger state (%v) into %v, the node will load it when the chain starts\n", msg, flagGenesis)
+			return nil
+		},
+	}
+	ledgerImportCmd.Flags().StringVarP(&flagGenesis,
+		"genesis",
+		"",
+		os.ExpandEnv(filepath.Join("$HOME", cfg.DefaultTendermintDir, "config", "genesis.json")),
+		"genesis file of the node to import into")
 
-	tendermintRootCmd.AddCommand(
-		tendermintCmd.GenValidatorCmd,
-		tendermintCmd.InitFilesCmd,
-		tendermintCmd.ProbeUpnpCmd,
-		tendermintCmd.LiteCmd,
-		tendermintCmd.ReplayCmd,
-		tendermintCmd.ReplayConsoleCmd,
-		tendermintCmd.ResetAllCmd,
-		tendermintCmd.ResetPrivValidatorCmd,
-		tendermintCmd.ShowValidatorCmd,
-		tendermintCmd.TestnetFilesCmd,
-		tendermintCmd.ShowNodeIDCmd,
-		tendermintCmd.GenNodeKeyCmd,
-		tendermintCmd.VersionCmd)
+	var ledgerAuditCmd = &cobra.Command{
+		Use:   "audit state_file",
+		Short: "Validates exported ledger state offline",
+		Long:  `Validates bulletproofs of all outputs and that outputs less kernel excesses sum up to the total of issued assets, and checks the state root of the snapshot. Compare the root with the one in the header of the block at the same height printed by block.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stateFileName := args[0]
+			stateBytes, err := ioutil.ReadFile(stateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read state file "+stateFileName)
+			}
 
-	tendermintBaseCmd := cli.PrepareBaseCmd(tendermintRootCmd, "TM", os.ExpandEnv(filepath.Join("$HOME", cfg.DefaultTendermintDir)))
+			state, msg, err := ledger.ValidateStateBytes(stateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot ValidateStateBytes")
+			}
 
-	rootCmd.AddCommand(tendermintBaseCmd.Command)
+			if isJSONOutput() {
+				return printJSON(auditResult{
+					Height:     state.Height,
+					StateRoot:  state.StateRoot,
+					NumOutputs: len(state.Outputs),
+					NumKernels: len(state.Kernels),
+					Assets:     state.Assets,
+					Status:     "valid",
+				})
+			}
 
-	err = rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+			fmt.Printf("ledger state of height %v with state root %v is valid: %v\n", state.Height, state.StateRoot, msg)
+			var assets []string
+			for asset := range state.Assets {
+				assets = append(assets, asset)
+			}
+			sort.Strings(assets)
+			for _, asset := range assets {
+				fmt.Printf("%v %v issued\n", state.Assets[asset], asset)
+			}
+			return nil
+		},
+	}
+
+	ledgerCmd.AddCommand(ledgerExportCmd, ledgerImportCmd, ledgerAuditCmd)
+
+	var addressCmd = &cobra.Command{
+		Use:   "address",
+		Short: "Prints out wallet addresses",
+		Long:  `Prints out the public key the wallet signs payment proofs with and the slatepack address other wallets encrypt slates to.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			address, err := w.Address()
+			if err != nil {
+				return errors.Wrap(err, "cannot get Address")
+			}
+			slatepackAddress, err := w.SlatepackAddress()
+			if err != nil {
+				return errors.Wrap(err, "cannot get SlatepackAddress")
+			}
+			fmt.Printf("payment proof address: %v\nslatepack address: %v\n", address, slatepackAddress)
+			return nil
+		},
+	}
+
+	var passwdCmd = &cobra.Command{
+		Use:   "passwd",
+		Short: "Changes wallet password",
+		Long:  `Decrypts the master key with the current password and encrypts it with the new one prompted for or set in MW_NEW_PASSWORD. Key created before it was encrypted is encrypted with the password it is first opened with.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			password, err := readNewPassword(newPasswordEnv)
+			if err != nil {
+				return errors.Wrap(err, "cannot read new password")
+			}
+
+			err = w.ChangePassword(password)
+			if err != nil {
+				return errors.Wrap(err, "cannot ChangePassword")
+			}
+			fmt.Println("changed password")
+			return nil
+		},
+	}
+
+	var backupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Backs up the master key",
+		Long:  `Backs up the master key as mnemonic shares to keep in different places.`,
+	}
+
+	var backupSplitCmd = &cobra.Command{
+		Use:     "split",
+		Short:   "Splits the master key into mnemonic shares",
+		Long:    `Splits the master key with Shamir's secret sharing into mnemonic shares any threshold of which recover it with mw init --from-shares. Fewer shares reveal nothing about the key. The shares stand for the key itself, the BIP39 passphrase is not needed to recover from them.`,
+		Example: `mw backup split --threshold 2 --shares 3`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			mnemonics, err := w.SplitMasterKey(flagThreshold, flagShares)
+			if err != nil {
+				return errors.Wrap(err, "cannot SplitMasterKey")
+			}
+			fmt.Printf("please record each share and keep them apart, any %v of them recover your key\n", flagThreshold)
+			for i, mnemonic := range mnemonics {
+				fmt.Printf("share %v: %v\n", i+1, mnemonic)
+			}
+			return nil
+		},
+	}
+	backupSplitCmd.Flags().IntVar(&flagThreshold, "threshold", 2, "number of shares needed to recover the key")
+	backupSplitCmd.Flags().IntVar(&flagShares, "shares", 3, "number of shares to split the key into")
+
+	backupCmd.AddCommand(backupSplitCmd)
+
+	var proofCmd = &cobra.Command{
+		Use:   "proof",
+		Short: "Exports and verifies payment proofs",
+		Long:  `Payment proof is signed by the receiver and the sender and proves the amount was paid by a transaction in the ledger.`,
+	}
+
+	var proofExportCmd = &cobra.Command{
+		Use:   "export transaction_id [proof_file]",
+		Short: "Exports payment proof of a sent transaction",
+		Long:  `Writes payment proof stored with a transaction finalized by this wallet to a json file.`,
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			id := args[0]
+			proofBytes, err := w.PaymentProof([]byte(id))
+			if err != nil {
+				return errors.Wrap(err, "cannot get PaymentProof")
+			}
+
+			fileName := "proof-" + id + ".json"
+			if len(args) > 1 {
+				fileName = args[1]
+			}
+			err = ioutil.WriteFile(fileName, proofBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote payment proof of transaction %v to %v\n", id, fileName)
+			return nil
+		},
+	}
+
+	var proofVerifyCmd = &cobra.Command{
+		Use:   "verify proof_file",
+		Short: "Verifies payment proof",
+		Long:  `Verifies signatures of the receiver and the sender and queries the network for the kernel of the payment.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			proofFileName := args[0]
+			proofBytes, err := ioutil.ReadFile(proofFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read proof file "+proofFileName)
+			}
+
+			proof, err := wallet.VerifyPaymentProof(proofBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot VerifyPaymentProof")
+			}
+
+			client, err := abci.NewClient(flagAddress)
+			if err != nil {
+				return errors.Wrap(err, "cannot get new client")
+			}
+			defer client.Stop()
+
+			_, err = client.Query("kernel/" + proof.Excess)
+			if err != nil {
+				return errors.Wrap(err, "cannot find payment kernel in the ledger")
+			}
+
+			fmt.Printf("payment proof is valid: %v sent %v %v to %v in transaction with kernel %v\n",
+				proof.SenderAddress, uint64(proof.Amount), proof.Asset, proof.ReceiverAddress, proof.Excess)
+			return nil
+		},
+	}
+	proofVerifyCmd.Flags().StringVarP(&flagAddress,
+		"address",
+		"",
+		"tcp://0.0.0.0:26657",
+		"address of tendermint socket to query")
+
+	proofCmd.AddCommand(proofExportCmd, proofVerifyCmd)
+
+	var multipartyCmd = &cobra.Command{
+		Use:   "multiparty",
+		Short: "Builds a transaction by more than two wallets",
+		Long:  `Participants join a slate in the first round adding their inputs and outputs, sign it in the second round, then the initiator finalizes it.`,
+	}
+
+	var multipartyNewCmd = &cobra.Command{
+		Use:     "new participants amount asset receive_amount receive_asset",
+		Short:   "Starts a multiparty slate",
+		Long:    `Initiator creates a json file with a slate for the number of participants, spending amount of asset and receiving receive amount of receive asset. Pass it to the next participant to join.`,
+		Example: `mw multiparty new 3 10 apple 0 ""`,
+		Args:    cobra.ExactArgs(5),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			participants, err := strconv.Atoi(args[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse number of participants")
+			}
+			amount, err := strconv.Atoi(args[1])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse amount")
+			}
+			receiveAmount, err := strconv.Atoi(args[3])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse receive amount")
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			setExpiry(w)
+
+			slateBytes, err := w.NewMultiparty(uint64(amount), args[2], uint64(receiveAmount), args[4], uint(participants))
+			if err != nil {
+				return errors.Wrap(err, "cannot NewMultiparty")
+			}
+			id, err := wallet.ParseIDFromSlate(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "slate-join-" + string(id) + "-1.json"
+			err = ioutil.WriteFile(fileName, slateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, pass it to the next participant to join: multiparty join %v\n", fileName)
+			return nil
+		},
+	}
+
+	var multipartyJoinCmd = &cobra.Command{
+		Use:     "join slate_file amount asset receive_amount receive_asset",
+		Short:   "Joins a multiparty slate",
+		Long:    `Participant adds its inputs and outputs spending amount of asset and receiving receive amount of receive asset, and its public blind and nonce.`,
+		Example: `mw multiparty join slate-join-3d9d3ae8-71c4-4d4a-8f72-3a5e5ae8a0c6-1.json 0 "" 5 apple`,
+		Args:    cobra.ExactArgs(5),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slateFileName := args[0]
+			slateBytes, err := ioutil.ReadFile(slateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read slate file "+slateFileName)
+			}
+			amount, err := strconv.Atoi(args[1])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse amount")
+			}
+			receiveAmount, err := strconv.Atoi(args[3])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse receive amount")
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			outSlateBytes, err := w.JoinMultiparty(slateBytes, uint64(amount), args[2], uint64(receiveAmount), args[4])
+			if err != nil {
+				return errors.Wrap(err, "cannot JoinMultiparty")
+			}
+			slate := wallet.Slate{}
+			err = json.Unmarshal(outSlateBytes, &slate)
+			if err != nil {
+				return errors.Wrap(err, "cannot unmarshal slate")
+			}
+			id := slate.ID.String()
+			joined := len(slate.ParticipantData)
+			if uint(joined) < slate.NumParticipants {
+				fileName := "slate-join-" + id + "-" + strconv.Itoa(joined) + ".json"
+				err = ioutil.WriteFile(fileName, outSlateBytes, 0644)
+				if err != nil {
+					return errors.Wrap(err, "cannot write file "+fileName)
+				}
+				fmt.Printf("wrote slate, %v of %v participants joined, pass it to the next participant to join: multiparty join %v\n", joined, slate.NumParticipants, fileName)
+			} else {
+				fileName := "slate-sign-" + id + "-0.json"
+				err = ioutil.WriteFile(fileName, outSlateBytes, 0644)
+				if err != nil {
+					return errors.Wrap(err, "cannot write file "+fileName)
+				}
+				fmt.Printf("wrote slate, all participants joined, pass it to every participant but the initiator to sign: multiparty sign %v\n", fileName)
+			}
+			return nil
+		},
+	}
+
+	var multipartySignCmd = &cobra.Command{
+		Use:   "sign slate_file",
+		Short: "Signs a multiparty slate",
+		Long:  `Participant adds its partial signature to the slate all participants have joined.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slateFileName := args[0]
+			slateBytes, err := ioutil.ReadFile(slateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read slate file "+slateFileName)
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			outSlateBytes, err := w.SignMultiparty(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot SignMultiparty")
+			}
+			slate := wallet.Slate{}
+			err = json.Unmarshal(outSlateBytes, &slate)
+			if err != nil {
+				return errors.Wrap(err, "cannot unmarshal slate")
+			}
+			var signed int
+			for _, p := range slate.ParticipantData {
+				if p.PartSig != nil {
+					signed++
+				}
+			}
+			fileName := "slate-sign-" + slate.ID.String() + "-" + strconv.Itoa(signed) + ".json"
+			err = ioutil.WriteFile(fileName, outSlateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, %v of %v participants signed, pass it to the next participant to sign or to the initiator to finalize: multiparty finalize %v\n", signed, slate.NumParticipants-1, fileName)
+			return nil
+		},
+	}
+
+	var multipartyFinalizeCmd = &cobra.Command{
+		Use:   "finalize slate_file",
+		Short: "Finalizes a multiparty slate",
+		Long:  `Initiator verifies partial signatures of all participants, adds its own and creates a json file with a transaction to be sent to the network.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slateFileName := args[0]
+			slateBytes, err := ioutil.ReadFile(slateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read slate file "+slateFileName)
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			err = setHeight(w)
+			if err != nil {
+				return errors.Wrap(err, "cannot setHeight")
+			}
+
+			txBytes, err := w.FinalizeMultiparty(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot FinalizeMultiparty")
+			}
+			id, err := wallet.ParseIDFromSlate(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "tx-" + string(id) + ".json"
+			err = ioutil.WriteFile(fileName, txBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote transaction %v, send it to the network to get validated: broadcast %v\nthen every participant tells its wallet the transaction has been confirmed: confirm %v\n", string(id), fileName, string(id))
+			return nil
+		},
+	}
+
+	addExpiryFlags(multipartyNewCmd)
+	addHeightFlags(multipartyFinalizeCmd, "to refuse to finalize slates expired by it")
+
+	multipartyCmd.AddCommand(multipartyNewCmd, multipartyJoinCmd, multipartySignCmd, multipartyFinalizeCmd)
+
+	var multisigCmd = &cobra.Command{
+		Use:   "multisig",
+		Short: "Funds and spends outputs owned by two wallets together",
+		Long:  `Multisig output is committed to with the sum of blind shares of two wallets and can be spent only when both of them sign.`,
+	}
+
+	var multisigNewCmd = &cobra.Command{
+		Use:     "new amount asset",
+		Short:   "Starts a slate funding a multisig output",
+		Long:    `Funder creates a json file with a slate spending its inputs to a multisig output of amount of asset, with its share of the output commitment and bulletproof. Pass it to the other party to join.`,
+		Example: `mw multisig new 10 apple`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			amount, err := strconv.Atoi(args[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse amount")
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			slateBytes, err := w.NewMultisig(uint64(amount), args[1])
+			if err != nil {
+				return errors.Wrap(err, "cannot NewMultisig")
+			}
+			id, err := wallet.ParseIDFromSlate(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "slate-multisig-" + string(id) + ".json"
+			err = ioutil.WriteFile(fileName, slateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, pass it to the other party to join: multisig join %v\n", fileName)
+			return nil
+		},
+	}
+
+	var multisigJoinCmd = &cobra.Command{
+		Use:   "join slate_file",
+		Short: "Joins a slate funding a multisig output",
+		Long:  `Other party adds its blind share to the output commitment, its share of the bulletproof and its partial signature.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slateFileName := args[0]
+			slateBytes, err := ioutil.ReadFile(slateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read slate file "+slateFileName)
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			outSlateBytes, err := w.JoinMultisig(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot JoinMultisig")
+			}
+			id, err := wallet.ParseIDFromSlate(outSlateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "slate-multisig-" + string(id) + "-joined.json"
+			err = ioutil.WriteFile(fileName, outSlateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, return it to the funder to finalize: multisig finalize %v\n", fileName)
+			return nil
+		},
+	}
+
+	var multisigSpendCmd = &cobra.Command{
+		Use:     "spend commit amount",
+		Short:   "Starts a slate spending a multisig output",
+		Long:    `Proposes to spend the multisig output with the commit receiving amount to this wallet and the rest of its value to the other party. Pass the slate to the other party to co-sign.`,
+		Example: `mw multisig spend 09a1b2... 4`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			amount, err := strconv.Atoi(args[1])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse amount")
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			slateBytes, err := w.SpendMultisig(args[0], uint64(amount))
+			if err != nil {
+				return errors.Wrap(err, "cannot SpendMultisig")
+			}
+			id, err := wallet.ParseIDFromSlate(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "slate-multisig-spend-" + string(id) + ".json"
+			err = ioutil.WriteFile(fileName, slateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, pass it to the other party to co-sign: multisig cosign %v\n", fileName)
+			return nil
+		},
+	}
+
+	var multisigCosignCmd = &cobra.Command{
+		Use:   "cosign slate_file",
+		Short: "Co-signs a slate spending a multisig output",
+		Long:  `Other party adds its output receiving its part of the value of the multisig output and its partial signature.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slateFileName := args[0]
+			slateBytes, err := ioutil.ReadFile(slateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read slate file "+slateFileName)
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			outSlateBytes, err := w.CosignMultisig(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot CosignMultisig")
+			}
+			id, err := wallet.ParseIDFromSlate(outSlateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "slate-multisig-spend-" + string(id) + "-cosigned.json"
+			err = ioutil.WriteFile(fileName, outSlateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, return it to the other party to finalize: multisig finalize %v\n", fileName)
+			return nil
+		},
+	}
+
+	var multisigFinalizeCmd = &cobra.Command{
+		Use:   "finalize slate_file",
+		Short: "Finalizes a slate funding or spending a multisig output",
+		Long:  `Party that started the slate completes the bulletproof of the multisig output it funds, verifies the other party's partial signature, adds its own and creates a json file with a transaction to be sent to the network.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slateFileName := args[0]
+			slateBytes, err := ioutil.ReadFile(slateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read slate file "+slateFileName)
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			txBytes, err := w.FinalizeMultisig(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot FinalizeMultisig")
+			}
+			id, err := wallet.ParseIDFromSlate(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "tx-" + string(id) + ".json"
+			err = ioutil.WriteFile(fileName, txBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote transaction %v, send it to the network to get validated: broadcast %v\nthen both parties tell their wallets the transaction has been confirmed: confirm %v\n", string(id), fileName, string(id))
+			return nil
+		},
+	}
+
+	multisigCmd.AddCommand(multisigNewCmd, multisigJoinCmd, multisigSpendCmd, multisigCosignCmd, multisigFinalizeCmd)
+
+	var consolidateCmd = &cobra.Command{
+		Use:   "consolidate [asset]",
+		Short: "Merges outputs into one",
+		Long:  `Creates a transaction of this wallet alone spending all confirmed outputs of the asset that are not frozen into one output, paying the fee from them.`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asset := defaultAsset
+			if len(args) > 0 {
+				asset = args[0]
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			setFee(cmd, w)
+
+			txBytes, err := w.Consolidate(asset)
+			if err != nil {
+				return errors.Wrap(err, "cannot Consolidate")
+			}
+			return writeTransaction(txBytes)
+		},
+	}
+	consolidateCmd.Flags().Uint64Var(&flagFee, "fee", 0, "fee to pay instead of one calculated with fee rate")
+	consolidateCmd.Flags().Uint64Var(&flagFeeRate, "fee-rate", wallet.DefaultFeeRate, "fee per transaction weight unit")
+
+	var splitCmd = &cobra.Command{
+		Use:     "split amount count [asset]",
+		Short:   "Splits outputs into equal ones",
+		Long:    `Creates a transaction of this wallet alone spending outputs to create count outputs sharing the amount equally, to spend them in parallel. What is left goes to change.`,
+		Example: `mw split 100 4 --inputs 09a1`,
+		Args:    cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			amount, err := strconv.Atoi(args[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse amount")
+			}
+			count, err := strconv.Atoi(args[1])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse count")
+			}
+			asset := defaultAsset
+			if len(args) > 2 {
+				asset = args[2]
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			err = setSelection(w)
+			if err != nil {
+				return errors.Wrap(err, "cannot setSelection")
+			}
+			setFee(cmd, w)
+			w.SetInputs(flagInputs)
+
+			txBytes, err := w.Split(uint64(amount), count, asset)
+			if err != nil {
+				return errors.Wrap(err, "cannot Split")
+			}
+			return writeTransaction(txBytes)
+		},
+	}
+	splitCmd.Flags().StringVar(&flagSelection, "selection", "", "coin selection for this transaction instead of the wallet's: "+strings.Join(wallet.Selections, ", "))
+	splitCmd.Flags().Uint64Var(&flagFee, "fee", 0, "fee to pay instead of one calculated with fee rate")
+	splitCmd.Flags().Uint64Var(&flagFeeRate, "fee-rate", wallet.DefaultFeeRate, "fee per transaction weight unit")
+	splitCmd.Flags().StringSliceVar(&flagInputs, "inputs", nil, "commits of outputs to split, all of them, instead of ones picked by coin selection")
+
+	var batchCmd = &cobra.Command{
+		Use:   "batch",
+		Short: "Pays out to many receivers in one transaction",
+		Long:  `Initiator creates a slate for each receiver, receivers join their slates in parallel, the initiator combines them into one slate every receiver signs, then the initiator finalizes it.`,
+	}
+
+	var batchNewCmd = &cobra.Command{
+		Use:   "new payouts_file",
+		Short: "Starts a batch of payouts",
+		Long: `Initiator creates a json file with a slate for each payout in a csv file with rows of amount and asset, the default asset when it is omitted. A header row is skipped.
+The fee is paid in the asset of the first payout. Pass each slate to its receiver to join.`,
+		Example: `mw batch new payouts.csv --fee-rate 1`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			payouts, err := readPayouts(args[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot readPayouts")
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			err = setSelection(w)
+			if err != nil {
+				return errors.Wrap(err, "cannot setSelection")
+			}
+			setFee(cmd, w)
+			setExpiry(w)
+
+			slates, err := w.NewBatch(payouts)
+			if err != nil {
+				return errors.Wrap(err, "cannot NewBatch")
+			}
+			id, err := wallet.ParseIDFromSlate(slates[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			for i, slateBytes := range slates {
+				fileName := "slate-batch-" + string(id) + "-" + strconv.Itoa(i+1) + ".json"
+				err = ioutil.WriteFile(fileName, slateBytes, 0644)
+				if err != nil {
+					return errors.Wrap(err, "cannot write file "+fileName)
+				}
+				fmt.Printf("wrote slate for %v %v, pass it to the receiver to join: batch join %v\n", payouts[i].Amount, payouts[i].Asset, fileName)
+			}
+			return nil
+		},
+	}
+	batchNewCmd.Flags().StringVar(&flagSelection, "selection", "", "coin selection for this transaction instead of the wallet's: "+strings.Join(wallet.Selections, ", "))
+	batchNewCmd.Flags().Uint64Var(&flagFee, "fee", 0, "fee to pay instead of one calculated with fee rate")
+	batchNewCmd.Flags().Uint64Var(&flagFeeRate, "fee-rate", wallet.DefaultFeeRate, "fee per transaction weight unit")
+	addExpiryFlags(batchNewCmd)
+
+	var batchJoinCmd = &cobra.Command{
+		Use:   "join slate_file",
+		Short: "Joins a batch slate",
+		Long:  `Receiver adds its output for the payout in the slate, and its public blind and nonce.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slateFileName := args[0]
+			slateBytes, err := ioutil.ReadFile(slateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read slate file "+slateFileName)
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			w.SetFeePolicy(wallet.FeePolicy{MinFee: flagMinFee})
+
+			outSlateBytes, err := w.JoinBatch(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot JoinBatch")
+			}
+			fileName := strings.TrimSuffix(filepath.Base(slateFileName), ".json") + "-joined.json"
+			err = ioutil.WriteFile(fileName, outSlateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, return it to the initiator to combine with slates of other receivers: batch combine %v ...\n", fileName)
+			return nil
+		},
+	}
+	batchJoinCmd.Flags().Uint64Var(&flagMinFee, "min-fee", 0, "refuse slates with a lower fee")
+
+	var batchCombineCmd = &cobra.Command{
+		Use:   "combine slate_file...",
+		Short: "Combines joined batch slates",
+		Long:  `Initiator collects outputs, public blinds and nonces from slates joined by all receivers into one slate for them to sign.`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slates, err := readSlates(args)
+			if err != nil {
+				return errors.Wrap(err, "cannot readSlates")
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			slateBytes, err := w.CombineBatch(slates)
+			if err != nil {
+				return errors.Wrap(err, "cannot CombineBatch")
+			}
+			id, err := wallet.ParseIDFromSlate(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "slate-batch-sign-" + string(id) + ".json"
+			err = ioutil.WriteFile(fileName, slateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, pass it to every receiver to sign: batch sign %v\n", fileName)
+			return nil
+		},
+	}
+
+	var batchSignCmd = &cobra.Command{
+		Use:   "sign slate_file",
+		Short: "Signs a combined batch slate",
+		Long:  `Receiver adds its partial signature to the slate combined by the initiator.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slateFileName := args[0]
+			slateBytes, err := ioutil.ReadFile(slateFileName)
+			if err != nil {
+				return errors.Wrap(err, "cannot read slate file "+slateFileName)
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			outSlateBytes, err := w.SignMultiparty(slateBytes)
+			if err != nil {
+				return errors.Wrap(err, "cannot SignMultiparty")
+			}
+			slate := wallet.Slate{}
+			err = json.Unmarshal(outSlateBytes, &slate)
+			if err != nil {
+				return errors.Wrap(err, "cannot unmarshal slate")
+			}
+			// receivers sign in parallel so the only partial signature is this receiver's
+			var signer uint64
+			for _, p := range slate.ParticipantData {
+				if p.PartSig != nil {
+					signer = uint64(p.ID)
+				}
+			}
+			fileName := "slate-batch-signed-" + slate.ID.String() + "-" + strconv.FormatUint(signer, 10) + ".json"
+			err = ioutil.WriteFile(fileName, outSlateBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote slate, return it to the initiator to finalize with slates of other receivers: batch finalize %v ...\n", fileName)
+			return nil
+		},
+	}
+
+	var batchFinalizeCmd = &cobra.Command{
+		Use:   "finalize slate_file...",
+		Short: "Finalizes a batch of payouts",
+		Long:  `Initiator merges partial signatures from slates signed by all receivers, adds its own and creates a json file with a transaction to be sent to the network.`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slates, err := readSlates(args)
+			if err != nil {
+				return errors.Wrap(err, "cannot readSlates")
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			txBytes, err := w.FinalizeBatch(slates)
+			if err != nil {
+				return errors.Wrap(err, "cannot FinalizeBatch")
+			}
+			id, err := wallet.ParseIDFromSlate(slates[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot parse id from slate")
+			}
+			fileName := "tx-" + string(id) + ".json"
+			err = ioutil.WriteFile(fileName, txBytes, 0644)
+			if err != nil {
+				return errors.Wrap(err, "cannot write file "+fileName)
+			}
+			fmt.Printf("wrote transaction %v, send it to the network to get validated: broadcast %v\nthen every receiver tells its wallet the transaction has been confirmed: confirm %v\n", string(id), fileName, string(id))
+			return nil
+		},
+	}
+
+	batchCmd.AddCommand(batchNewCmd, batchJoinCmd, batchCombineCmd, batchSignCmd, batchFinalizeCmd)
+
+	var txsCmd = &cobra.Command{
+		Use:     "txs",
+		Short:   "Prints out transaction history",
+		Long:    `Prints out transactions of the current account with what was sent and received, the fee, counterparty, when they were created and confirmed, and notes. The latest come first.`,
+		Example: `mw txs --asset cash --status confirmed --since 2021-01-01`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter := wallet.TransactionFilter{Asset: flagTxAsset}
+
+			if len(flagTxStatus) > 0 {
+				status, err := wallet.ParseTransactionStatus(flagTxStatus)
+				if err != nil {
+					return errors.Wrap(err, "cannot parse status")
+				}
+				filter.Status = &status
+			}
+
+			var err error
+			if len(flagSince) > 0 {
+				filter.Since, err = time.ParseInLocation(dateLayout, flagSince, time.Local)
+				if err != nil {
+					return errors.Wrap(err, "cannot parse since date")
+				}
+			}
+			if len(flagUntil) > 0 {
+				until, err := time.ParseInLocation(dateLayout, flagUntil, time.Local)
+				if err != nil {
+					return errors.Wrap(err, "cannot parse until date")
+				}
+				// until the end of the day
+				filter.Until = until.AddDate(0, 0, 1)
+			}
+
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			if isJSONOutput() {
+				transactions, err := w.Transactions(filter)
+				if err != nil {
+					return errors.Wrap(err, "cannot get Transactions")
+				}
+				return printJSON(transactions)
+			}
+
+			history, err := w.History(filter)
+			if err != nil {
+				return errors.Wrap(err, "cannot get History")
+			}
+			fmt.Print(history)
+			return nil
+		},
+	}
+	txsCmd.Flags().StringVar(&flagTxAsset, "asset", "", "only transactions sending or receiving the asset")
+	txsCmd.Flags().StringVar(&flagTxStatus, "status", "", "only transactions of the status: unconfirmed, confirmed or canceled")
+	txsCmd.Flags().StringVar(&flagSince, "since", "", "only transactions created on the date or later, as "+dateLayout)
+	txsCmd.Flags().StringVar(&flagUntil, "until", "", "only transactions created on the date or earlier, as "+dateLayout)
+
+	var txCmd = &cobra.Command{
+		Use:   "tx",
+		Short: "Annotates transactions",
+		Long:  `Attaches notes to transactions in the history.`,
+	}
+
+	var txNoteCmd = &cobra.Command{
+		Use:     "note transaction_id text",
+		Short:   "Attaches a note to a transaction",
+		Long:    `Attaches a free text note to the transaction, replacing the one it had. Empty text removes the note.`,
+		Example: `mw tx note 4fb7d3b2-7d6b-4ad7-a8b7-4e1a43de5bc3 rent for may`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			err = w.SetNote([]byte(args[0]), strings.Join(args[1:], " "))
+			if err != nil {
+				return errors.Wrap(err, "cannot SetNote")
+			}
+			fmt.Printf("noted transaction %v\n", args[0])
+			return nil
+		},
+	}
+
+	txCmd.AddCommand(txNoteCmd)
+
+	var balanceCmd = &cobra.Command{
+		Use:   "balance",
+		Short: "Prints out balances of assets",
+		Long:  `Prints out what the current account holds in each asset: spendable, locked in inputs of transactions not yet finalized or confirmed, unconfirmed received and change, frozen, and shared in multisig outputs, which is left out of the total.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			if isJSONOutput() {
+				balances, err := w.Balances()
+				if err != nil {
+					return errors.Wrap(err, "cannot get Balances")
+				}
+				return printJSON(balances)
+			}
+
+			balance, err := w.BalanceInfo()
+			if err != nil {
+				return errors.Wrap(err, "cannot get BalanceInfo")
+			}
+			fmt.Print(balance)
+			return nil
+		},
+	}
+
+	var outputCmd = &cobra.Command{
+		Use:   "output",
+		Short: "Controls wallet outputs",
+		Long:  `Freezes outputs to keep them from being spent and unfreezes them.`,
+	}
+
+	var outputFreezeCmd = &cobra.Command{
+		Use:     "freeze commit",
+		Short:   "Freezes an output",
+		Long:    `Keeps the output with the commit, or a unique start of it as shown by info, from being spent until it is unfrozen.`,
+		Example: `mw output freeze 09a1`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			output, err := w.FreezeOutput(args[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot FreezeOutput")
+			}
+			fmt.Printf("froze output %v\n", output.Commit)
+			return nil
+		},
+	}
+
+	var outputUnfreezeCmd = &cobra.Command{
+		Use:     "unfreeze commit",
+		Short:   "Unfreezes an output",
+		Long:    `Lets the frozen output with the commit, or a unique start of it as shown by info, be spent again.`,
+		Example: `mw output unfreeze 09a1`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			output, err := w.UnfreezeOutput(args[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot UnfreezeOutput")
+			}
+			fmt.Printf("unfroze output %v\n", output.Commit)
+			return nil
+		},
+	}
+
+	outputCmd.AddCommand(outputFreezeCmd, outputUnfreezeCmd)
+
+	var selectionCmd = &cobra.Command{
+		Use:     "selection [strategy]",
+		Short:   "Shows or sets coin selection",
+		Long:    `Prints out the coin selection strategy the wallet picks inputs with, or sets it for the transactions that follow. Strategies: smallest spends the smallest outputs first, largest the largest first, exact looks for outputs matching the amount to avoid change and falls back to smallest, random spends outputs in random order for privacy.`,
+		Example: `mw selection random`,
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			if len(args) > 0 {
+				err = w.SetDefaultSelection(args[0])
+				if err != nil {
+					return errors.Wrap(err, "cannot SetDefaultSelection")
+				}
+			}
+			fmt.Printf("coin selection %v\n", w.Selection())
+			return nil
+		},
+	}
+
+	var accountCmd = &cobra.Command{
+		Use:   "account",
+		Short: "Manages wallet accounts",
+		Long:  `Account keeps its own outputs, slates and transactions, derived from its own hardened key. Commands work with the current account.`,
+	}
+
+	var accountCreateCmd = &cobra.Command{
+		Use:     "create name",
+		Short:   "Creates an account",
+		Long:    `Creates an account with the name, numbered after the last one. Switch to it to send and receive.`,
+		Example: `mw account create savings`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			account, err := w.CreateAccount(args[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot CreateAccount")
+			}
+			fmt.Printf("created account %v number %v\n", account.Name, account.Number)
+			return nil
+		},
+	}
+
+	var accountListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists accounts",
+		Long:  `Prints out names and numbers of accounts, the current one marked with *.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			accounts, err := w.ListAccounts()
+			if err != nil {
+				return errors.Wrap(err, "cannot ListAccounts")
+			}
+
+			if isJSONOutput() {
+				results := make([]accountResult, 0, len(accounts))
+				for _, account := range accounts {
+					results = append(results, accountResult{Account: account, Current: account.Number == w.Account().Number})
+				}
+				return printJSON(results)
+			}
+
+			for _, account := range accounts {
+				current := " "
+				if account.Number == w.Account().Number {
+					current = "*"
+				}
+				fmt.Printf("%v %v %v\n", current, account.Number, account.Name)
+			}
+			return nil
+		},
+	}
+
+	var accountSwitchCmd = &cobra.Command{
+		Use:     "switch name",
+		Short:   "Switches to an account",
+		Long:    `Makes the account current for the commands that follow.`,
+		Example: `mw account switch savings`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := openWallet()
+			if err != nil {
+				return errors.Wrap(err, "cannot create wallet")
+			}
+			defer w.Close()
+
+			err = w.SwitchAccount(args[0])
+			if err != nil {
+				return errors.Wrap(err, "cannot SwitchAccount")
+			}
+			fmt.Printf("switched to account %v\n", args[0])
+			return nil
+		},
+	}
+
+	accountCmd.AddCommand(accountCreateCmd, accountListCmd, accountSwitchCmd)
+
+	var doublespend bool
+	var nodeCmd = &cobra.Command{
+		Use:   "node",
+		Short: "Runs blockchain node",
+		Long:  `Runs Tendermint node with built in Mimblewimble ABCI app.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := abci.Start(flagPersist, doublespend)
+			if err != nil {
+				return errors.Wrap(err, "cannot abci.Start")
+			}
+			return nil
+		},
+	}
+	nodeCmd.Flags().BoolVar(&doublespend, "doublespend", false, "Double spend inputs for testing")
+
+	rootCmd = &cobra.Command{
+		Use:          "mw",
+		Short:        "Wallet and validator for Mimblewimble",
+		Long:         `Experimental wallet and validator for Mimblewimble protocol.`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if flagOutput != outputText && flagOutput != outputJSON {
+				return errors.Errorf("unknown output format %v, expected %v or %v", flagOutput, outputText, outputJSON)
+			}
+			if isJSONOutput() && !jsonCommands[cmd.CommandPath()] {
+				return errors.Errorf("json output not supported by %v", cmd.CommandPath())
+			}
+			return nil
+		},
+	}
+
+	rootCmd.AddCommand(initCmd, issueCmd, sendCmd, receiveCmd, invoiceCmd, finalizeCmd, postCmd,
+		confirmCmd, cancelCmd, validateCmd, infoCmd, nodeCmd, broadcastCmd, eventsCmd, listenCmd, blockCmd, ledgerCmd,
+		addressCmd, proofCmd, multipartyCmd, multisigCmd, restoreCmd, accountCmd, passwdCmd, backupCmd, selectionCmd, outputCmd,
+		consolidateCmd, splitCmd, batchCmd, txsCmd, txCmd, balanceCmd)
+
+	dir, err := homedir.Dir()
+	if err != nil {
+		panic("cannot get homedir")
+	}
+	mwroot := filepath.Join(dir, ".mw")
+
+	rootCmd.PersistentFlags().StringVarP(&flagPersist, "persist", "", mwroot, "directory to use to store databases and user's master secret key")
+	rootCmd.PersistentFlags().StringVarP(&flagOutput, "output", "o", outputText, "format to print out results in: "+outputText+" or "+outputJSON+" for scripts")
+
+	// Tendermint commands
+
+	tendermintRootCmd := tendermintCmd.RootCmd
+
+	tendermintRootCmd.AddCommand(
+		tendermintCmd.GenValidatorCmd,
+		tendermintCmd.InitFilesCmd,
+		tendermintCmd.ProbeUpnpCmd,
+		tendermintCmd.LiteCmd,
+		tendermintCmd.ReplayCmd,
+		tendermintCmd.ReplayConsoleCmd,
+		tendermintCmd.ResetAllCmd,
+		tendermintCmd.ResetPrivValidatorCmd,
+		tendermintCmd.ShowValidatorCmd,
+		tendermintCmd.TestnetFilesCmd,
+		tendermintCmd.ShowNodeIDCmd,
+		tendermintCmd.GenNodeKeyCmd,
+		tendermintCmd.VersionCmd)
+
+	tendermintBaseCmd := cli.PrepareBaseCmd(tendermintRootCmd, "TM", os.ExpandEnv(filepath.Join("$HOME", cfg.DefaultTendermintDir)))
+
+	rootCmd.AddCommand(tendermintBaseCmd.Command)
+
+	err = rootCmd.Execute()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// readSlate reads json slate or armored slatepack from the file, or from stdin if no file or - is given
+func readSlate(w *wallet.Wallet, args []string) (slateBytes []byte, pack *slatepack.Slatepack, err error) {
+	if len(args) == 0 || args[0] == "-" {
+		slateBytes, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot read slate from stdin")
+		}
+	} else {
+		slateBytes, err = ioutil.ReadFile(args[0])
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot read slate file "+args[0])
+		}
+	}
+
+	if slatepack.IsArmored(slateBytes) {
+		pack, err = w.ReadSlatepack(slateBytes)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot ReadSlatepack")
+		}
+		slateBytes = pack.Payload
+	}
+
+	return
+}
+
+// writeSlate writes json slate, or armored slatepack encrypted if recipient address is given and prints out the armor
+func writeSlate(w *wallet.Wallet, name string, slateBytes []byte, armored bool, recipient string) (fileName string, err error) {
+	if !armored {
+		fileName = name + ".json"
+		err = ioutil.WriteFile(fileName, slateBytes, 0644)
+		if err != nil {
+			return "", errors.Wrap(err, "cannot write file "+fileName)
+		}
+		return
+	}
+
+	armor, err := w.NewSlatepack(slateBytes, recipient)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot NewSlatepack")
+	}
+
+	fileName = name + ".slatepack"
+	err = ioutil.WriteFile(fileName, armor, 0644)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot write file "+fileName)
+	}
+	// scripts read the slatepack from the file
+	if !isJSONOutput() {
+		fmt.Println(string(armor))
+	}
+
+	return
+}
+
+// environment variables scripts set the wallet password, the one passwd changes it to and BIP39 passphrase of init,
+// instead of typing them in. Unlike flags they do not end up in shell history or in the process list
+const (
+	passwordEnv    = "MW_PASSWORD"
+	newPasswordEnv = "MW_NEW_PASSWORD"
+	passphraseEnv  = "MW_PASSPHRASE"
+)
+
+// readPassword takes the password from the env variable or prompts for it
+func readPassword(env string, prompt string) (password string, err error) {
+	password, ok := os.LookupEnv(env)
+	if ok {
+		return
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.Errorf("cannot prompt for password as stdin is not a terminal, set %v", env)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passwordBytes, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot ReadPassword")
+	}
+
+	return string(passwordBytes), nil
+}
+
+// readNewPassword takes the password from the env variable or prompts for it twice to make sure it is typed in right
+func readNewPassword(env string) (password string, err error) {
+	return readConfirmed(env, "new password")
+}
+
+// readPassphrase takes BIP39 passphrase from its env variable, or prompts for it twice with --passphrase.
+// There is no passphrase otherwise
+func readPassphrase() (passphrase string, err error) {
+	_, ok := os.LookupEnv(passphraseEnv)
+	if !ok && !flagPassphrase {
+		return "", nil
+	}
+
+	return readConfirmed(passphraseEnv, "passphrase")
+}
+
+// readConfirmed takes the secret from the env variable or prompts for it twice
+func readConfirmed(env string, name string) (secret string, err error) {
+	_, ok := os.LookupEnv(env)
+	if ok {
+		return readPassword(env, "")
+	}
+
+	secret, err = readPassword(env, name+": ")
+	if err != nil {
+		return
+	}
+
+	confirmation, err := readPassword(env, "repeat "+name+": ")
+	if err != nil {
+		return
+	}
+
+	if secret != confirmation {
+		return "", errors.Errorf("%vs do not match", name)
+	}
+
+	return
+}
+
+// openWallet opens the wallet in persist directory with its master key decrypted with the password
+func openWallet() (w *wallet.Wallet, err error) {
+	password, err := readPassword(passwordEnv, "password: ")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read password")
+	}
+
+	return wallet.NewWallet(flagPersist, password)
+}
+
+// setSelection overrides wallet's coin selection with the one in --selection flag
+func setSelection(w *wallet.Wallet) error {
+	if len(flagSelection) == 0 {
+		return nil
+	}
+
+	return w.SetSelection(flagSelection)
+}
+
+// setFee sets wallet's fee to --fee flag if given, or has it calculated with --fee-rate
+func setFee(cmd *cobra.Command, w *wallet.Wallet) {
+	if cmd.Flags().Changed("fee") {
+		w.SetFee(flagFee)
+	} else {
+		w.SetFeeRate(flagFeeRate)
+	}
+}
+
+// writeTransaction writes the transaction the wallet created alone to a file to broadcast
+func writeTransaction(txBytes []byte) error {
+	tx := ledger.Transaction{}
+	err := json.Unmarshal(txBytes, &tx)
+	if err != nil {
+		return errors.Wrap(err, "cannot unmarshal transaction")
+	}
+
+	id := tx.ID.String()
+	fileName := "tx-" + id + ".json"
+	err = ioutil.WriteFile(fileName, txBytes, 0644)
+	if err != nil {
+		return errors.Wrap(err, "cannot write file "+fileName)
+	}
+	fmt.Printf("wrote transaction %v, send it to the network to get validated: broadcast %v\nthen tell the wallet the transaction has been confirmed: confirm %v\n", id, fileName, id)
+	return nil
+}
+
+// readPayouts reads payouts from a csv file with rows of amount and optional asset, skipping a header row
+func readPayouts(fileName string) (payouts []wallet.Payout, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open payouts file "+fileName)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read payouts file "+fileName)
+	}
+
+	for i, record := range records {
+		amount, e := strconv.ParseUint(record[0], 10, 64)
+		if e != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, errors.Wrapf(e, "cannot parse amount in row %d", i+1)
+		}
+
+		asset := defaultAsset
+		if len(record) > 1 && len(record[1]) > 0 {
+			asset = record[1]
+		}
+
+		payouts = append(payouts, wallet.Payout{Amount: amount, Asset: asset})
+	}
+
+	return
+}
+
+// readSlates reads slates from files
+func readSlates(fileNames []string) (slates [][]byte, err error) {
+	for _, fileName := range fileNames {
+		slateBytes, e := ioutil.ReadFile(fileName)
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot read slate file "+fileName)
+		}
+		slates = append(slates, slateBytes)
+	}
+
+	return
+}
+
+// addExpiryFlags lets commands that start slates set when they expire
+func addExpiryFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&flagTTL, "ttl", wallet.DefaultSlateTTL, "time the slate is valid for, 0 for no time limit")
+	cmd.Flags().Uint64Var(&flagExpiryHeight, "expiry-height", 0, "height of the chain the slate expires at, 0 for no height limit")
+}
+
+// setExpiry sets when slates the wallet starts expire to --ttl and --expiry-height flags
+func setExpiry(w *wallet.Wallet) {
+	w.SetTTL(flagTTL)
+	w.SetExpiryHeight(flagExpiryHeight)
+}
+
+// addHeightFlags lets commands that check expiry of slates know the height of the chain
+func addHeightFlags(cmd *cobra.Command, usage string) {
+	cmd.Flags().Uint64Var(&flagHeight, "height", 0, "current height of the chain "+usage+", queried from the node when not given")
+	cmd.Flags().StringVarP(&flagAddress,
+		"address",
+		"",
+		"tcp://0.0.0.0:26657",
+		"address of tendermint socket to query the height of the chain")
+}
+
+// setHeight tells the wallet the height of the chain in --height flag, or of the last block of the node if it is
+// available, canceling slates expired by it. The height stays unknown when neither is.
+func setHeight(w *wallet.Wallet) error {
+	height := flagHeight
+	if height == 0 {
+		var err error
+		height, err = queryHeight(flagAddress)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errors.Wrap(err, "height of the chain is unknown"))
+			return nil
+		}
+	}
+
+	return w.SetHeight(height)
+}
+
+// queryHeight asks the node for the height of its last block
+func queryHeight(address string) (height uint64, err error) {
+	client, err := abci.NewClient(address)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot get new client")
+	}
+	defer client.Stop()
+
+	blockBytes, err := client.Query("block")
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot client.Query")
+	}
+
+	block := ledger.Block{}
+	err = json.Unmarshal(blockBytes, &block)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot unmarshal block")
+	}
+
+	return uint64(block.Height), nil
+}
+
+// result of a command for scripts: the slate or transaction it made or changed, the file it wrote and the status
+type result struct {
+	ID     string `json:"id,omitempty"`
+	File   string `json:"file,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+type postResult struct {
+	result
+	Broadcast *abci.BroadcastResult `json:"broadcast"`
+}
+
+type restoreResult struct {
+	// Scanned is the number of unspent outputs in the ledger
+	Scanned  int             `json:"scanned"`
+	Restored []wallet.Output `json:"restored"`
+}
+
+type auditResult struct {
+	Height     int64             `json:"height"`
+	StateRoot  string            `json:"state_root"`
+	NumOutputs int               `json:"num_outputs"`
+	NumKernels int               `json:"num_kernels"`
+	Assets     map[string]uint64 `json:"assets"`
+	Status     string            `json:"status"`
+}
+
+type accountResult struct {
+	wallet.Account
+	Current bool `json:"current"`
+}
+
+// jsonCommands print out their results as json with --output json, the others refuse to run with it
+var jsonCommands = map[string]bool{
+	"mw issue":        true,
+	"mw send":         true,
+	"mw invoice":      true,
+	"mw receive":      true,
+	"mw finalize":     true,
+	"mw post":         true,
+	"mw confirm":      true,
+	"mw cancel":       true,
+	"mw validate":     true,
+	"mw info":         true,
+	"mw broadcast":    true,
+	"mw events":       true,
+	"mw block":        true,
+	"mw restore":      true,
+	"mw ledger audit": true,
+	"mw account list": true,
+	"mw txs":          true,
+	"mw balance":      true,
+}
+
+func isJSONOutput() bool {
+	return flagOutput == outputJSON
+}
+
+// printResult prints out the result as json for scripts or the text for people
+func printResult(r result, text string) error {
+	if isJSONOutput() {
+		return printJSON(r)
+	}
+	fmt.Print(text)
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	jsonBytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal to json")
 	}
+	fmt.Println(string(jsonBytes))
+	return nil
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/olegabu/go-mimblewimble/internal/wallet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the test binary runs mw itself when called back by runMW
+func TestMain(m *testing.M) {
+	if os.Getenv("MW_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMW runs mw with the wallet in persist directory in the working directory dir and returns what it printed to stdout
+func runMW(t *testing.T, dir string, persist string, args ...string) (stdout []byte) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "MW_TEST_MAIN=1", "MW_PERSIST="+persist, "MW_PASSWORD=test")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+
+	err := cmd.Run()
+	require.NoError(t, err, "mw %v: %s", args, stderrBuf.String())
+
+	return stdoutBuf.Bytes()
+}
+
+// runMWJSON runs mw with --output json and unmarshals all of its stdout into v
+func runMWJSON(t *testing.T, dir string, persist string, v interface{}, args ...string) {
+	stdout := runMW(t, dir, persist, append(args, "--output", "json")...)
+	require.NoError(t, json.Unmarshal(stdout, v), "mw %v printed: %s", args, stdout)
+}
+
+func TestJSONOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mw_cli_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sender := filepath.Join(dir, "sender")
+	receiver := filepath.Join(dir, "receiver")
+	runMW(t, dir, sender, "init")
+	runMW(t, dir, receiver, "init")
+
+	var issued result
+	runMWJSON(t, dir, sender, &issued, "issue", "10", "cash")
+	assert.Equal(t, "issued", issued.Status)
+	assert.FileExists(t, filepath.Join(dir, issued.File))
+
+	var sent result
+	runMWJSON(t, dir, sender, &sent, "send", "3", "cash")
+	assert.Equal(t, "sent", sent.Status)
+	assert.NotEmpty(t, sent.ID)
+
+	var responded result
+	runMWJSON(t, dir, receiver, &responded, "receive", sent.File, "--height", "1")
+	assert.Equal(t, "responded", responded.Status)
+	assert.Equal(t, sent.ID, responded.ID)
+
+	var finalized result
+	runMWJSON(t, dir, sender, &finalized, "finalize", responded.File, "--height", "1")
+	assert.Equal(t, "finalized", finalized.Status)
+	assert.Equal(t, sent.ID, finalized.ID)
+
+	var validated result
+	runMWJSON(t, dir, sender, &validated, "validate", finalized.File)
+	assert.Equal(t, "valid", validated.Status)
+
+	var confirmed result
+	runMWJSON(t, dir, sender, &confirmed, "confirm", sent.ID)
+	assert.Equal(t, "confirmed", confirmed.Status)
+
+	var report wallet.Report
+	runMWJSON(t, dir, sender, &report, "info", "--height", "1")
+	assert.Equal(t, "default", report.Account)
+	values := make(map[uint64]string)
+	for _, output := range report.Outputs {
+		values[output.Value] = output.Status
+	}
+	assert.Equal(t, map[uint64]string{10: "Spent", 7: "Confirmed"}, values)
+	assert.Len(t, report.Transactions, 2)
+
+	var transactions []wallet.Transaction
+	runMWJSON(t, dir, sender, &transactions, "txs")
+	assert.Len(t, transactions, 2)
+
+	var balances []wallet.Balance
+	runMWJSON(t, dir, sender, &balances, "balance")
+	assert.Equal(t, []wallet.Balance{{Asset: "cash", Spendable: 7}}, balances)
+
+	var accounts []accountResult
+	runMWJSON(t, dir, sender, &accounts, "account", "list")
+	assert.Equal(t, []accountResult{{Account: wallet.Account{Name: "default"}, Current: true}}, accounts)
+
+	// commands that print text refuse json output
+	cmd := exec.Command(os.Args[0], "address", "--output", "json")
+	cmd.Env = append(os.Environ(), "MW_TEST_MAIN=1", "MW_PERSIST="+sender, "MW_PASSWORD=test")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	assert.Error(t, err)
+	assert.Empty(t, out)
+	assert.Contains(t, stderr.String(), "json output not supported by mw address")
+}
@@ -6,11 +6,13 @@ import (
 	_ "github.com/blockcypher/libgrin/core"
 	"github.com/olegabu/go-mimblewimble/pkg/ledger"
 	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
 	abcitypes "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/libs/common"
 	"github.com/tendermint/tendermint/libs/log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +20,15 @@ type MWApplication struct {
 	db          ledger.Database
 	logger      log.Logger
 	doublespend bool
+	block       *ledger.Block
+	offsets     []string
+	// commitments of outputs spent and created, and excesses of kernels added by the block being delivered
+	spent   map[string]bool
+	created map[string]bool
+	kernels map[string]bool
+	// digest of the committed ledger state, and of the state with the block being delivered
+	state        *ledger.StateDigest
+	pendingState *ledger.StateDigest
 }
 
 func NewMWApplication(db ledger.Database, doublespend bool) *MWApplication {
@@ -41,8 +52,26 @@ func (MWApplication) SetOption(req abcitypes.RequestSetOption) abcitypes.Respons
 func (app *MWApplication) InitChain(req abcitypes.RequestInitChain) abcitypes.ResponseInitChain {
 	err := app.db.ResetAssets()
 	if err != nil {
-		app.logger.Error(fmt.Sprintf("cannot ResetAssets while in InitChain %v", err))
+		panic(fmt.Sprintf("cannot ResetAssets while in InitChain %v", err))
 	}
+
+	// load ledger state exported from another network and placed into app_state of genesis,
+	// the node refuses to start on an empty ledger if the state cannot be loaded
+	if len(req.AppStateBytes) > 0 {
+		state := &ledger.State{}
+		err = json.Unmarshal(req.AppStateBytes, state)
+		if err != nil {
+			panic(fmt.Sprintf("cannot unmarshal app state while in InitChain %v", err))
+		}
+
+		err = ledger.ImportState(state, app.db)
+		if err != nil {
+			panic(fmt.Sprintf("cannot ImportState while in InitChain %v", err))
+		}
+
+		app.logger.Info(fmt.Sprintf("imported ledger state of height %v: %v outputs, %v kernels", state.Height, len(state.Outputs), len(state.Kernels)))
+	}
+
 	return abcitypes.ResponseInitChain{}
 }
 
@@ -72,7 +101,25 @@ func (app *MWApplication) CheckTx(req abcitypes.RequestCheckTx) abcitypes.Respon
 }
 
 func (app *MWApplication) BeginBlock(req abcitypes.RequestBeginBlock) abcitypes.ResponseBeginBlock {
+	if app.state == nil {
+		state, err := ledger.LoadStateDigest(app.db)
+		if err != nil {
+			panic(fmt.Sprintf("cannot LoadStateDigest while in BeginBlock %v", err))
+		}
+		app.state = state
+	}
+	app.pendingState = app.state.Copy()
+
 	app.db.Begin()
+	app.block = &ledger.Block{
+		Height:  req.Header.Height,
+		Time:    req.Header.Time,
+		Kernels: make([]string, 0),
+	}
+	app.offsets = nil
+	app.spent = make(map[string]bool)
+	app.created = make(map[string]bool)
+	app.kernels = make(map[string]bool)
 	return abcitypes.ResponseBeginBlock{}
 }
 
@@ -90,11 +137,35 @@ func (app *MWApplication) DeliverTx(req abcitypes.RequestDeliverTx) abcitypes.Re
 			return abcitypes.ResponseDeliverTx{Code: http.StatusUnauthorized, GasWanted: 1, Log: errors.Wrap(err, "transaction is invalid").Error()}
 		}
 
+		kernel, err := ledger.FullKernel(&tx.Transaction)
+		if err != nil {
+			return abcitypes.ResponseDeliverTx{Code: http.StatusInternalServerError, Log: errors.Wrap(err, "cannot get full kernel").Error()}
+		}
+
+		var inputs []string
+		if !app.doublespend {
+			for _, input := range tx.Body.Inputs {
+				inputs = append(inputs, input.Commit)
+			}
+		}
+		var outputs []string
+		for _, output := range tx.Body.Outputs {
+			outputs = append(outputs, output.Commit)
+		}
+		err = app.checkChanges(inputs, outputs, kernel.Excess)
+		if err != nil {
+			return abcitypes.ResponseDeliverTx{Code: http.StatusConflict, GasWanted: 1, Log: errors.Wrap(err, "transaction conflicts with the ledger").Error()}
+		}
+
 		err = ledger.PersistTransaction(tx, app.db, app.doublespend)
 		if err != nil {
 			return abcitypes.ResponseDeliverTx{Code: http.StatusInternalServerError, Log: errors.Wrap(err, "cannot persist transaction").Error()}
 		}
 
+		app.addChanges(inputs, outputs, kernel.Excess)
+		app.addToBlock(kernel.Excess, tx.Offset)
+		app.pendingState.AddTransaction(tx, kernel, app.doublespend)
+
 		events = transferEvents(*tx)
 	} else {
 		err := ledger.ValidateIssue(issue)
@@ -102,11 +173,21 @@ func (app *MWApplication) DeliverTx(req abcitypes.RequestDeliverTx) abcitypes.Re
 			return abcitypes.ResponseDeliverTx{Code: http.StatusUnauthorized, GasWanted: 1, Log: errors.Wrap(err, "issue is invalid").Error()}
 		}
 
+		outputs := []string{issue.Output.Commit}
+		err = app.checkChanges(nil, outputs, issue.Kernel.Excess)
+		if err != nil {
+			return abcitypes.ResponseDeliverTx{Code: http.StatusConflict, GasWanted: 1, Log: errors.Wrap(err, "issue conflicts with the ledger").Error()}
+		}
+
 		err = ledger.PersistIssue(issue, app.db)
 		if err != nil {
 			return abcitypes.ResponseDeliverTx{Code: http.StatusInternalServerError, Log: errors.Wrap(err, "cannot persist issue").Error()}
 		}
 
+		app.addChanges(nil, outputs, issue.Kernel.Excess)
+		app.addToBlock(issue.Kernel.Excess, "")
+		app.pendingState.AddIssue(issue)
+
 		events = issueEvents(*issue)
 	}
 
@@ -114,14 +195,89 @@ func (app *MWApplication) DeliverTx(req abcitypes.RequestDeliverTx) abcitypes.Re
 }
 
 func (app *MWApplication) Commit() abcitypes.ResponseCommit {
+	// the block header is written in the batch of the state it summarizes, so they are committed together
+	if app.block != nil {
+		err := ledger.PersistBlock(app.block, app.offsets, app.pendingState, app.db)
+		if err != nil {
+			panic(fmt.Sprintf("cannot PersistBlock while in Commit %v", err))
+		}
+	}
+
 	data := []byte{0}
 	err := app.db.Commit()
 	if err != nil {
 		data = []byte(err.Error())
+	} else if app.pendingState != nil {
+		app.state = app.pendingState
 	}
 	return abcitypes.ResponseCommit{Data: data}
 }
 
+// checkChanges refuses to spend outputs already spent in the block being delivered, and to create outputs and kernels
+// that are in the ledger or in the block already: they would be written once but counted twice in the state digest
+func (app *MWApplication) checkChanges(inputs []string, outputs []string, excess string) error {
+	seen := make(map[string]bool)
+
+	for _, commit := range inputs {
+		if app.spent[commit] || seen[commit] {
+			return errors.Errorf("input %v is already spent", commit)
+		}
+		seen[commit] = true
+	}
+
+	for _, commit := range outputs {
+		if app.created[commit] || seen[commit] {
+			return errors.Errorf("output %v already exists", commit)
+		}
+		seen[commit] = true
+
+		_, err := app.db.GetOutput([]byte(commit))
+		if err == nil {
+			return errors.Errorf("output %v already exists", commit)
+		}
+		if errors.Cause(err) != leveldb.ErrNotFound {
+			return errors.Wrapf(err, "cannot GetOutput %v", commit)
+		}
+	}
+
+	if app.kernels[excess] {
+		return errors.Errorf("kernel %v already exists", excess)
+	}
+	_, err := app.db.GetKernel([]byte(excess))
+	if err == nil {
+		return errors.Errorf("kernel %v already exists", excess)
+	}
+	if errors.Cause(err) != leveldb.ErrNotFound {
+		return errors.Wrapf(err, "cannot GetKernel %v", excess)
+	}
+
+	return nil
+}
+
+// addChanges remembers what a delivered transaction or issue changed in the block
+func (app *MWApplication) addChanges(inputs []string, outputs []string, excess string) {
+	if app.spent == nil {
+		return
+	}
+	for _, commit := range inputs {
+		app.spent[commit] = true
+	}
+	for _, commit := range outputs {
+		app.created[commit] = true
+	}
+	app.kernels[excess] = true
+}
+
+func (app *MWApplication) addToBlock(excess string, offset string) {
+	if app.block == nil {
+		return
+	}
+	app.block.Kernels = append(app.block.Kernels, excess)
+	if len(offset) > 0 {
+		app.offsets = append(app.offsets, offset)
+	}
+}
+
 func (app *MWApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcitypes.ResponseQuery) {
 	app.logger.Debug(fmt.Sprintf("reqQuery %v", reqQuery))
 
@@ -139,12 +295,57 @@ func (app *MWApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcit
 			bytes, err := app.db.GetOutput([]byte(paths[1]))
 			valueResponse(&resQuery, bytes, err)
 		}
+	} else if paths[0] == "outputs" {
+		// return a page of outputs: outputs/<limit>/<commit of the last output of the previous page>
+		limit := 0
+		if len(paths) > 1 {
+			limit, _ = strconv.Atoi(paths[1])
+		}
+		if limit <= 0 {
+			resQuery.Log = "expected a positive limit in outputs/<limit>/<after commit>"
+			resQuery.Code = http.StatusBadRequest
+		} else {
+			var after []byte
+			if len(paths) > 2 {
+				after = []byte(paths[2])
+			}
+			list, err := app.db.ListOutputsAfter(after, limit)
+			valueResponse(&resQuery, list, err)
+		}
 	} else if paths[0] == "kernel" {
-		list, err := app.db.ListKernels()
-		valueResponse(&resQuery, list, err)
+		if len(paths) == 1 {
+			// return all kernels
+			list, err := app.db.ListKernels()
+			valueResponse(&resQuery, list, err)
+		} else if len(paths) > 1 {
+			// return one kernel by its excess
+			kernel, err := app.db.GetKernel([]byte(paths[1]))
+			valueResponse(&resQuery, kernel, err)
+		}
 	} else if paths[0] == "asset" {
 		list, err := app.db.ListAssets()
 		valueResponse(&resQuery, list, err)
+	} else if paths[0] == "block" {
+		if len(paths) == 1 || len(paths[1]) == 0 {
+			// return the last block
+			height, err := app.db.GetHeight()
+			if err != nil {
+				errorResponse(&resQuery, err, "cannot get height")
+			} else {
+				block, err := app.db.GetBlock(height)
+				valueResponse(&resQuery, block, err)
+			}
+		} else {
+			// return block at height
+			height, err := strconv.ParseInt(paths[1], 10, 64)
+			if err != nil {
+				resQuery.Log = errors.Wrap(err, "cannot parse height").Error()
+				resQuery.Code = http.StatusBadRequest
+			} else {
+				block, err := app.db.GetBlock(height)
+				valueResponse(&resQuery, block, err)
+			}
+		}
 	} else if paths[0] == "validate" {
 		outputs, err := app.db.ListOutputs()
 		errorResponse(&resQuery, err, "cannot list outputs")
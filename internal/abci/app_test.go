@@ -0,0 +1,80 @@
+package abci
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/olegabu/go-mimblewimble/internal/wallet"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestDeliverConflicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mw_abci_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := NewLeveldbDatabase(dir)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	w, err := wallet.NewWalletWithoutMasterKey(dir + "/wallet")
+	assert.NoError(t, err)
+	defer w.Close()
+	_, err = w.InitMasterKey("", "", wallet.DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	app := NewMWApplication(db, false)
+	app.InitChain(abcitypes.RequestInitChain{})
+
+	deliver := func(txBytes []byte) uint32 {
+		return app.DeliverTx(abcitypes.RequestDeliverTx{Tx: txBytes}).Code
+	}
+
+	// an issue delivered twice in a block is written once
+	issueBytes, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+
+	app.BeginBlock(abcitypes.RequestBeginBlock{Header: abcitypes.Header{Height: 1}})
+	assert.Equal(t, abcitypes.CodeTypeOK, deliver(issueBytes))
+	assert.NotEqual(t, abcitypes.CodeTypeOK, deliver(issueBytes))
+	app.Commit()
+
+	// and is refused in a later block
+	app.BeginBlock(abcitypes.RequestBeginBlock{Header: abcitypes.Header{Height: 2}})
+	assert.NotEqual(t, abcitypes.CodeTypeOK, deliver(issueBytes))
+	app.Commit()
+
+	// two transactions spending the same output in one block
+	txBytes, err := w.Split(4, 2, "cash")
+	assert.NoError(t, err)
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	id, _ := tx.ID.MarshalText()
+	err = w.Cancel(id)
+	assert.NoError(t, err)
+
+	doubleSpendBytes, err := w.Split(6, 3, "cash")
+	assert.NoError(t, err)
+
+	app.BeginBlock(abcitypes.RequestBeginBlock{Header: abcitypes.Header{Height: 3}})
+	assert.Equal(t, abcitypes.CodeTypeOK, deliver(txBytes))
+	assert.NotEqual(t, abcitypes.CodeTypeOK, deliver(doubleSpendBytes))
+	app.Commit()
+
+	// the state root of the last block matches what is in the ledger
+	block, err := db.GetBlock(3)
+	assert.NoError(t, err)
+	outputs, err := db.ListOutputs()
+	assert.NoError(t, err)
+	kernels, err := db.ListKernels()
+	assert.NoError(t, err)
+	assets, err := db.ListAssets()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(outputs))
+	assert.Equal(t, 3, block.NumOutputs)
+	assert.Equal(t, hex.EncodeToString(ledger.StateRoot(outputs, kernels, assets)), block.StateRoot)
+}
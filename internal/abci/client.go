@@ -6,6 +6,7 @@ import (
 	"github.com/tendermint/tendermint/rpc/client"
 	"github.com/tendermint/tendermint/types"
 	"log"
+	"net/http"
 	"time"
 )
 
@@ -14,6 +15,56 @@ type Client struct {
 	httpClient   *client.HTTP
 }
 
+// BroadcastResult is of the check of a broadcast transaction and of the event of its delivery to the ledger
+type BroadcastResult struct {
+	Hash string `json:"hash"`
+	Code uint32 `json:"code"`
+	Log  string `json:"log,omitempty"`
+	// Tx is nil when the event is not of a transaction
+	Tx *TxEvent `json:"tx,omitempty"`
+}
+
+// TxEvent is the result of a transaction delivered to the ledger and events it emitted
+type TxEvent struct {
+	Code   uint32  `json:"code"`
+	Data   string  `json:"data,omitempty"`
+	Log    string  `json:"log,omitempty"`
+	Events []Event `json:"events,omitempty"`
+}
+
+type Event struct {
+	Type       string      `json:"type"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
+type Attribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ParseTxEvent reads the result and events of a transaction from the event data, ok is false for events of other kinds
+func ParseTxEvent(evt types.TMEventData) (txEvent *TxEvent, ok bool) {
+	txe, ok := evt.(types.EventDataTx)
+	if !ok {
+		return nil, false
+	}
+
+	txEvent = &TxEvent{
+		Code: txe.Result.Code,
+		Data: string(txe.Result.Data),
+		Log:  txe.Result.Log,
+	}
+	for _, event := range txe.Result.Events {
+		e := Event{Type: event.Type}
+		for _, kv := range event.Attributes {
+			e.Attributes = append(e.Attributes, Attribute{Key: string(kv.Key), Value: string(kv.Value)})
+		}
+		txEvent.Events = append(txEvent.Events, e)
+	}
+
+	return txEvent, true
+}
+
 func NewClient(broadcastUrl string) (*Client, error) {
 	httpClient := client.NewHTTP(broadcastUrl, "/websocket")
 	err := httpClient.Start()
@@ -35,34 +86,55 @@ func (t *Client) Stop() {
 	}
 }
 
-func (t *Client) Broadcast(transactionBytes []byte) error {
+func (t *Client) Broadcast(transactionBytes []byte) (broadcastResult *BroadcastResult, err error) {
 	result, err := t.httpClient.BroadcastTxSync(transactionBytes)
 	if err != nil {
-		return errors.Wrap(err, "cannot broadcast transaction")
+		return nil, errors.Wrap(err, "cannot broadcast transaction")
 	}
 
 	log.Printf("broadcast with result code=%v log=%v\n", result.Code, result.Log)
 
+	broadcastResult = &BroadcastResult{
+		Hash: result.Hash.String(),
+		Code: result.Code,
+		Log:  result.Log,
+	}
+
 	// and wait for confirmation
-	err = t.waitForOneEvent()
+	broadcastResult.Tx, err = t.waitForOneEvent()
 	if err != nil {
-		return errors.Wrap(err, "cannot waitForOneEvent after broadcast")
+		return nil, errors.Wrap(err, "cannot waitForOneEvent after broadcast")
 	}
 
-	return nil
+	return
 }
 
-func (t *Client) waitForOneEvent() error {
+func (t *Client) Query(path string) ([]byte, error) {
+	result, err := t.httpClient.ABCIQuery(path, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot query %v", path)
+	}
+
+	if result.Response.Code != http.StatusOK {
+		return nil, errors.Errorf("query %v failed with code=%v log=%v", path, result.Response.Code, result.Response.Log)
+	}
+
+	return result.Response.Value, nil
+}
+
+func (t *Client) waitForOneEvent() (txEvent *TxEvent, err error) {
 	const timeoutSeconds = 5
 
 	evt, err := client.WaitForOneEvent(t.httpClient, types.EventTx, timeoutSeconds*time.Second)
 	if err != nil {
-		return errors.Wrap(err, "cannot WaitForOneEvent")
+		return nil, errors.Wrap(err, "cannot WaitForOneEvent")
 	}
 
 	t.PrintTxEvent(evt)
 
-	return nil
+	txEvent, _ = ParseTxEvent(evt)
+
+	return
 }
 
 func (t *Client) PrintTxEvent(evt types.TMEventData) {
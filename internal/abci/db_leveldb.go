@@ -10,6 +10,7 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 	"log"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +19,8 @@ var dbFilename string
 type leveldbDatabase struct {
 	db           *leveldb.DB
 	currentBatch *leveldb.Batch
+	// totals of assets issued in the current batch
+	currentAssets map[string]uint64
 }
 
 func NewLeveldbDatabase(dbDir string) (d ledger.Database, err error) {
@@ -70,6 +73,7 @@ func (t *leveldbDatabase) PutKernel(o core.TxKernel) error {
 
 func (t *leveldbDatabase) Begin() {
 	t.currentBatch = new(leveldb.Batch)
+	t.currentAssets = make(map[string]uint64)
 }
 
 func (t *leveldbDatabase) Commit() (err error) {
@@ -94,6 +98,20 @@ func (t *leveldbDatabase) GetOutput(id []byte) (output core.Output, err error) {
 	return
 }
 
+func (t *leveldbDatabase) GetKernel(id []byte) (kernel core.TxKernel, err error) {
+	kernel = core.TxKernel{}
+
+	kernelBytes, err := t.db.Get(kernelKey(string(id)), nil)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot db.Get")
+		return
+	}
+
+	err = json.Unmarshal(kernelBytes, &kernel)
+
+	return
+}
+
 func (t *leveldbDatabase) ListOutputs() (list []core.Output, err error) {
 	list = make([]core.Output, 0)
 
@@ -101,10 +119,45 @@ func (t *leveldbDatabase) ListOutputs() (list []core.Output, err error) {
 	for iter.Next() {
 		o := core.Output{}
 		err = json.Unmarshal(iter.Value(), &o)
+		if err != nil {
+			iter.Release()
+			return nil, errors.Wrap(err, "cannot unmarshal output in iterator")
+		}
 		list = append(list, o)
 	}
 	iter.Release()
 	err = iter.Error()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot iterate")
+	}
+
+	return
+}
+
+// ListOutputsAfter returns a page of up to limit outputs following the one with the commit, or the first page if it's empty
+func (t *leveldbDatabase) ListOutputsAfter(commit []byte, limit int) (list []core.Output, err error) {
+	list = make([]core.Output, 0)
+
+	r := outputRange()
+	if len(commit) > 0 {
+		r.Start = append(outputKey(string(commit)), 0)
+	}
+
+	iter := t.db.NewIterator(r, nil)
+	for len(list) < limit && iter.Next() {
+		o := core.Output{}
+		err = json.Unmarshal(iter.Value(), &o)
+		if err != nil {
+			iter.Release()
+			return nil, errors.Wrap(err, "cannot unmarshal output in iterator")
+		}
+		list = append(list, o)
+	}
+	iter.Release()
+	err = iter.Error()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot iterate")
+	}
 
 	return
 }
@@ -116,10 +169,17 @@ func (t *leveldbDatabase) ListKernels() (list []core.TxKernel, err error) {
 	for iter.Next() {
 		o := core.TxKernel{}
 		err = json.Unmarshal(iter.Value(), &o)
+		if err != nil {
+			iter.Release()
+			return nil, errors.Wrap(err, "cannot unmarshal kernel in iterator")
+		}
 		list = append(list, o)
 	}
 	iter.Release()
 	err = iter.Error()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot iterate")
+	}
 
 	return
 }
@@ -128,13 +188,20 @@ func (t *leveldbDatabase) AddAsset(asset string, value uint64) {
 	var total uint64
 	totalBytes := make([]byte, 8)
 
-	currentTotalBytes, err := t.db.Get(assetKey(asset), nil)
-	if err != nil {
-		total = value
-	} else {
-		currentTotal, _ := binary.Uvarint(currentTotalBytes)
+	// the asset may have been issued earlier in the batch
+	currentTotal, ok := t.currentAssets[asset]
+	if ok {
 		total = currentTotal + value
+	} else {
+		currentTotalBytes, err := t.db.Get(assetKey(asset), nil)
+		if err != nil {
+			total = value
+		} else {
+			currentTotal, _ := binary.Uvarint(currentTotalBytes)
+			total = currentTotal + value
+		}
 	}
+	t.currentAssets[asset] = total
 
 	binary.PutUvarint(totalBytes, total)
 	t.currentBatch.Put(assetKey(asset), totalBytes)
@@ -171,6 +238,65 @@ func (t *leveldbDatabase) ResetAssets() error {
 	return nil
 }
 
+func (t *leveldbDatabase) PutBlock(block ledger.Block) error {
+	bytes, err := json.Marshal(block)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal block")
+	}
+
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, uint64(block.Height))
+
+	t.currentBatch.Put(blockKey(block.Height), bytes)
+	t.currentBatch.Put(heightKey(), heightBytes)
+
+	return nil
+}
+
+func (t *leveldbDatabase) PutStateDigest(digest []byte) error {
+	t.currentBatch.Put(stateDigestKey(), digest)
+	return nil
+}
+
+func (t *leveldbDatabase) GetStateDigest() (digest []byte, err error) {
+	digest, err = t.db.Get(stateDigestKey(), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot db.Get state digest")
+	}
+
+	return
+}
+
+func (t *leveldbDatabase) GetBlock(height int64) (block ledger.Block, err error) {
+	blockBytes, err := t.db.Get(blockKey(height), nil)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot db.Get block %v", height)
+		return
+	}
+
+	err = json.Unmarshal(blockBytes, &block)
+
+	return
+}
+
+func (t *leveldbDatabase) GetHeight() (height int64, err error) {
+	heightBytes, err := t.db.Get(heightKey(), nil)
+	if err == leveldb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		err = errors.Wrap(err, "cannot db.Get height")
+		return
+	}
+
+	height = int64(binary.BigEndian.Uint64(heightBytes))
+
+	return
+}
+
 func outputKey(o string) []byte {
 	return []byte("output." + o)
 }
@@ -199,3 +325,15 @@ func assetFromKey(key []byte) string {
 func assetRange() *util.Range {
 	return util.BytesPrefix([]byte("asset."))
 }
+
+func blockKey(height int64) []byte {
+	return []byte("block." + strconv.FormatInt(height, 10))
+}
+
+func heightKey() []byte {
+	return []byte("height")
+}
+
+func stateDigestKey() []byte {
+	return []byte("digest")
+}
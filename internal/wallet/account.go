@@ -0,0 +1,144 @@
+package wallet
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/tyler-smith/go-bip32"
+)
+
+// default account every wallet has, its number is 0
+const defaultAccountName = "default"
+
+// loadAccount makes the account saved as current the one outputs, slates and balances are scoped to
+func (t *Wallet) loadAccount() (err error) {
+	_, err = t.db.GetAccount(defaultAccountName)
+	if errors.Cause(err) == leveldb.ErrNotFound {
+		err = t.db.PutAccount(Account{Name: defaultAccountName, Number: 0})
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot get default account")
+	}
+
+	name, err := t.db.GetCurrentAccount()
+	if errors.Cause(err) == leveldb.ErrNotFound {
+		name = defaultAccountName
+	} else if err != nil {
+		return errors.Wrap(err, "cannot GetCurrentAccount")
+	}
+
+	t.account, err = t.db.GetAccount(name)
+	if err != nil {
+		return errors.Wrapf(err, "cannot GetAccount %v", name)
+	}
+
+	return
+}
+
+// Account is the current account
+func (t *Wallet) Account() Account {
+	return t.account
+}
+
+func (t *Wallet) ListAccounts() (accounts []Account, err error) {
+	return t.db.ListAccounts()
+}
+
+// CreateAccount adds an account numbered after the last one, it does not switch to it
+func (t *Wallet) CreateAccount(name string) (account Account, err error) {
+	if len(name) == 0 {
+		err = errors.New("account name is empty")
+		return
+	}
+
+	_, err = t.db.GetAccount(name)
+	if err == nil {
+		err = errors.Errorf("account %v already exists", name)
+		return
+	}
+	if errors.Cause(err) != leveldb.ErrNotFound {
+		err = errors.Wrap(err, "cannot GetAccount")
+		return
+	}
+
+	accounts, err := t.db.ListAccounts()
+	if err != nil {
+		err = errors.Wrap(err, "cannot ListAccounts")
+		return
+	}
+
+	// account keys are hardened children, their numbers are below the first hardened index
+	number := accounts[len(accounts)-1].Number + 1
+	if number >= bip32.FirstHardenedChild {
+		err = errors.Errorf("cannot create more than %d accounts", bip32.FirstHardenedChild)
+		return
+	}
+
+	account = Account{Name: name, Number: number}
+
+	err = t.db.PutAccount(account)
+	if err != nil {
+		err = errors.Wrap(err, "cannot PutAccount")
+		return
+	}
+
+	return
+}
+
+// SwitchAccount makes the account current for this and later runs of the wallet
+func (t *Wallet) SwitchAccount(name string) (err error) {
+	account, err := t.db.GetAccount(name)
+	if err != nil {
+		return errors.Wrapf(err, "cannot GetAccount %v", name)
+	}
+
+	err = t.db.PutCurrentAccount(name)
+	if err != nil {
+		return errors.Wrap(err, "cannot PutCurrentAccount")
+	}
+
+	t.account = account
+
+	return
+}
+
+// accountByNumber finds the account with the number or adds one named after it, with a suffix if another account
+// already has that name
+func (t *Wallet) accountByNumber(number uint32) (account Account, err error) {
+	accounts, err := t.db.ListAccounts()
+	if err != nil {
+		err = errors.Wrap(err, "cannot ListAccounts")
+		return
+	}
+
+	for _, a := range accounts {
+		if a.Number == number {
+			return a, nil
+		}
+	}
+
+	base := "account" + strconv.Itoa(int(number))
+	name := base
+	for i := 2; ; i++ {
+		_, err = t.db.GetAccount(name)
+		if errors.Cause(err) == leveldb.ErrNotFound {
+			break
+		}
+		if err != nil {
+			err = errors.Wrap(err, "cannot GetAccount")
+			return
+		}
+		name = base + "-" + strconv.Itoa(i)
+	}
+
+	account = Account{Name: name, Number: number}
+
+	err = t.db.PutAccount(account)
+	if err != nil {
+		err = errors.Wrap(err, "cannot PutAccount")
+		return
+	}
+
+	return
+}
@@ -0,0 +1,119 @@
+package wallet
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/tyler-smith/go-bip32"
+)
+
+func TestAccounts(t *testing.T) {
+	dir := testDbDir() + "_accounts"
+	err := os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	w, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	mnemonic, err := w.InitMasterKey("", "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, defaultAccountName, w.Account().Name)
+
+	_, err = w.Issue(5, "cash")
+	assert.NoError(t, err)
+
+	savings, err := w.CreateAccount("savings")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), savings.Number)
+
+	_, err = w.CreateAccount("savings")
+	assert.Error(t, err)
+
+	err = w.SwitchAccount("savings")
+	assert.NoError(t, err)
+
+	// outputs of the default account cannot be spent from savings
+	_, err = w.Send(1, "cash", 0, "", SlateVersion4)
+	assert.Error(t, err)
+
+	_, err = w.Issue(5, "cash")
+	assert.NoError(t, err)
+
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(outputs))
+
+	// both accounts start their key indexes at 0 but derive different keys
+	assert.Equal(t, outputs[0].Index, outputs[1].Index)
+	assert.NotEqual(t, outputs[0].Account, outputs[1].Account)
+	assert.NotEqual(t, outputs[0].Commit, outputs[1].Commit)
+
+	_, err = w.Send(1, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	slates, err := w.db.ListSlates()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(slates))
+	assert.Equal(t, savings.Number, slates[0].Account)
+
+	info, err := w.Info()
+	assert.NoError(t, err)
+	assert.Contains(t, info, "Account savings")
+
+	// current account is remembered
+	w.Close()
+	w, err = NewWallet(dir, "")
+	assert.NoError(t, err)
+	assert.Equal(t, savings, w.Account())
+
+	accounts, err := w.ListAccounts()
+	assert.NoError(t, err)
+	assert.Equal(t, []Account{{Name: defaultAccountName, Number: 0}, savings}, accounts)
+
+	var ledgerOutputs []core.Output
+	outputs, err = w.db.ListOutputs()
+	assert.NoError(t, err)
+	for _, o := range outputs {
+		ledgerOutputs = append(ledgerOutputs, o.Output)
+	}
+	w.Close()
+
+	// restore puts outputs back into their accounts
+	dir = testDbDir() + "_accounts_restored"
+	err = os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	restored, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer restored.Close()
+	_, err = restored.InitMasterKey(mnemonic, "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	// the name restore gives account 1 is taken by another account
+	taken := Account{Name: "account1", Number: 7}
+	err = restored.db.PutAccount(taken)
+	assert.NoError(t, err)
+
+	restoredOutputs, err := restored.Restore(ledgerOutputs, []string{"cash"})
+	assert.NoError(t, err)
+	assert.Equal(t, len(outputs), len(restoredOutputs))
+
+	for _, o := range outputs {
+		r, err := restored.db.GetOutput(o.Commit)
+		assert.NoError(t, err)
+		assert.Equal(t, o.Account, r.Account)
+		assert.Equal(t, o.Index, r.Index)
+	}
+
+	accounts, err = restored.ListAccounts()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Account{{Name: defaultAccountName, Number: 0}, {Name: "account1-2", Number: 1}, taken}, accounts)
+
+	// account numbers stay below hardened child key indexes
+	err = restored.db.PutAccount(Account{Name: "last", Number: bip32.FirstHardenedChild - 1})
+	assert.NoError(t, err)
+	_, err = restored.CreateAccount("one too many")
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package wallet
+
+import (
+	"github.com/olegabu/go-mimblewimble/pkg/shamir"
+	"github.com/pkg/errors"
+	"github.com/tyler-smith/go-bip32"
+)
+
+// master key secret split into shares is its private key followed by its chain code
+const masterKeySecretSize = 64
+
+// SplitMasterKey splits the master key into count mnemonic shares any threshold of which recover it,
+// they replace the mnemonic and the passphrase the key was made from
+func (t *Wallet) SplitMasterKey(threshold int, count int) (mnemonics []string, err error) {
+	secret := append(append([]byte{}, t.masterKey.Key...), t.masterKey.ChainCode...)
+
+	shares, err := shamir.Split(secret, threshold, count)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot Split master key")
+	}
+
+	for _, share := range shares {
+		mnemonics = append(mnemonics, share.Mnemonic())
+	}
+
+	return
+}
+
+// InitMasterKeyFromShares recovers the master key from threshold of its mnemonic shares and encrypts it
+// with the password, like InitMasterKey does with a mnemonic
+func (t *Wallet) InitMasterKeyFromShares(mnemonics []string, password string) (err error) {
+	if t.MasterKeyExists() {
+		return errors.New("don't want to overwrite existing key by one recovered from your shares, remove existing first")
+	}
+
+	var shares []shamir.Share
+	for i, mnemonic := range mnemonics {
+		share, err := shamir.ShareFromMnemonic(mnemonic)
+		if err != nil {
+			return errors.Wrapf(err, "cannot decode share %d", i+1)
+		}
+		shares = append(shares, share)
+	}
+
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		return errors.Wrap(err, "cannot Combine shares")
+	}
+
+	if len(secret) != masterKeySecretSize {
+		return errors.New("shares are not of a master key")
+	}
+
+	masterKey := &bip32.Key{
+		Version:     bip32.PrivateWalletVersion,
+		ChildNumber: []byte{0, 0, 0, 0},
+		FingerPrint: []byte{0, 0, 0, 0},
+		ChainCode:   secret[32:],
+		Key:         secret[:32],
+		Depth:       0,
+		IsPrivate:   true,
+	}
+
+	err = t.putMasterKey(masterKey, password)
+	if err != nil {
+		return errors.Wrap(err, "cannot putMasterKey")
+	}
+
+	t.masterKey = masterKey
+
+	err = t.unlock()
+	if err != nil {
+		return errors.Wrap(err, "cannot unlock")
+	}
+
+	return
+}
@@ -0,0 +1,54 @@
+package wallet
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMasterKey(t *testing.T) {
+	w := newTestWallet(t)
+	masterKey := w.masterKey.String()
+
+	_, err := w.Issue(3, "cash")
+	assert.NoError(t, err)
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+
+	mnemonics, err := w.SplitMasterKey(2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(mnemonics))
+	w.Close()
+
+	for _, pair := range [][]int{{0, 1}, {2, 0}} {
+		dir := testDbDir() + "_shares"
+		err = os.RemoveAll(dir)
+		assert.NoError(t, err)
+
+		recovered, err := NewWalletWithoutMasterKey(dir)
+		assert.NoError(t, err)
+
+		// one share is not enough
+		err = recovered.InitMasterKeyFromShares([]string{mnemonics[pair[0]]}, testPassword)
+		assert.Error(t, err)
+
+		err = recovered.InitMasterKeyFromShares([]string{mnemonics[pair[0]], mnemonics[pair[1]]}, testPassword)
+		assert.NoError(t, err)
+		assert.Equal(t, masterKey, recovered.masterKey.String())
+
+		// the same keys are derived, so the output can be restored
+		_, err = recovered.Rewind(outputs[0].Output, []string{"cash"})
+		assert.NoError(t, err)
+
+		// the recovered key is saved encrypted with the password
+		err = recovered.InitMasterKeyFromShares([]string{mnemonics[pair[0]], mnemonics[pair[1]]}, testPassword)
+		assert.Error(t, err)
+		recovered.Close()
+
+		recovered, err = NewWallet(dir, testPassword)
+		assert.NoError(t, err)
+		assert.Equal(t, masterKey, recovered.masterKey.String())
+		recovered.Close()
+	}
+}
@@ -0,0 +1,118 @@
+package wallet
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+// Balance sums values of outputs of the current account in one asset by what the wallet can do with them
+type Balance struct {
+	Asset string `json:"asset"`
+	// Spendable is confirmed and can be spent by the wallet now
+	Spendable uint64 `json:"spendable"`
+	// Locked is in inputs of transactions waiting to be finalized or confirmed
+	Locked uint64 `json:"locked"`
+	// Unconfirmed is received or change waiting for its transaction to be confirmed
+	Unconfirmed uint64 `json:"unconfirmed"`
+	// Immature is confirmed but cannot be spent until it matures. The ledger has no coinbase maturity
+	// so issued outputs are spendable once confirmed and this stays 0
+	Immature uint64 `json:"immature"`
+	// Frozen is confirmed but kept from spending until it is unfrozen
+	Frozen uint64 `json:"frozen"`
+	// Shared is in multisig outputs the wallet owns together with another wallet, each of them sees all of it
+	Shared uint64 `json:"shared"`
+}
+
+// Total is all the wallet holds in the asset, multisig outputs are left out not to be counted by every co-owner
+func (t Balance) Total() uint64 {
+	return t.Spendable + t.Locked + t.Unconfirmed + t.Immature + t.Frozen
+}
+
+// Balances sums outputs of the current account per asset, sorted by asset
+func (t *Wallet) Balances() (balances []Balance, err error) {
+	outputs, err := t.db.ListOutputs()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListOutputs")
+	}
+
+	byAsset := make(map[string]*Balance)
+	for _, output := range outputs {
+		if output.Account != t.account.Number {
+			continue
+		}
+
+		balance, ok := byAsset[output.Asset]
+		if !ok {
+			balance = &Balance{Asset: output.Asset}
+			byAsset[output.Asset] = balance
+		}
+
+		if output.Multisig {
+			if output.Status == OutputConfirmed || output.Status == OutputLocked || output.Status == OutputUnconfirmed {
+				balance.Shared += output.Value
+			}
+			continue
+		}
+
+		switch output.Status {
+		case OutputConfirmed:
+			if output.Frozen {
+				balance.Frozen += output.Value
+			} else {
+				balance.Spendable += output.Value
+			}
+		case OutputLocked:
+			balance.Locked += output.Value
+		case OutputUnconfirmed:
+			balance.Unconfirmed += output.Value
+		}
+	}
+
+	balances = make([]Balance, 0, len(byAsset))
+	for _, balance := range byAsset {
+		// assets of only spent and canceled outputs are not held anymore
+		if balance.Total() > 0 || balance.Shared > 0 {
+			balances = append(balances, *balance)
+		}
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Asset < balances[j].Asset
+	})
+
+	return
+}
+
+// BalanceInfo prints out the balance of every asset of the current account
+func (t *Wallet) BalanceInfo() (string, error) {
+	balances, err := t.Balances()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get Balances")
+	}
+
+	tableString := &strings.Builder{}
+
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"asset", "spendable", "locked", "unconfirmed", "immature", "frozen", "total", "shared"})
+	table.SetCaption(true, "Balances of account "+t.account.Name)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	for _, balance := range balances {
+		table.Append([]string{
+			balance.Asset,
+			strconv.FormatUint(balance.Spendable, 10),
+			strconv.FormatUint(balance.Locked, 10),
+			strconv.FormatUint(balance.Unconfirmed, 10),
+			strconv.FormatUint(balance.Immature, 10),
+			strconv.FormatUint(balance.Frozen, 10),
+			strconv.FormatUint(balance.Total(), 10),
+			strconv.FormatUint(balance.Shared, 10),
+		})
+	}
+	table.Render()
+
+	return tableString.String(), nil
+}
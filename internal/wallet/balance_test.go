@@ -0,0 +1,76 @@
+package wallet
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalances(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	_, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+	_, err = w.Issue(5, "apple")
+	assert.NoError(t, err)
+	issueBytes, err := w.Issue(4, "apple")
+	assert.NoError(t, err)
+
+	issue := ledger.Issue{}
+	err = json.Unmarshal(issueBytes, &issue)
+	assert.NoError(t, err)
+	_, err = w.FreezeOutput(issue.Output.Commit)
+	assert.NoError(t, err)
+
+	w.SetFee(1)
+
+	slateBytes, err := w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	balances, err := w.Balances()
+	assert.NoError(t, err)
+	assert.Equal(t, []Balance{
+		{Asset: "apple", Spendable: 5, Frozen: 4},
+		{Asset: "cash", Locked: 10, Unconfirmed: 6},
+	}, balances)
+
+	responseBytes, err := receiver.Respond(slateBytes)
+	assert.NoError(t, err)
+	txBytes, err := w.Finalize(responseBytes)
+	assert.NoError(t, err)
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	id := []byte(tx.ID.String())
+
+	received, err := receiver.Balances()
+	assert.NoError(t, err)
+	assert.Equal(t, []Balance{{Asset: "cash", Unconfirmed: 3}}, received)
+
+	err = w.Confirm(id)
+	assert.NoError(t, err)
+	err = receiver.Confirm(id)
+	assert.NoError(t, err)
+
+	balances, err = w.Balances()
+	assert.NoError(t, err)
+	assert.Equal(t, []Balance{
+		{Asset: "apple", Spendable: 5, Frozen: 4},
+		{Asset: "cash", Spendable: 6},
+	}, balances)
+	assert.Equal(t, uint64(6), balances[1].Total())
+
+	received, err = receiver.Balances()
+	assert.NoError(t, err)
+	assert.Equal(t, []Balance{{Asset: "cash", Spendable: 3}}, received)
+
+	info, err := w.BalanceInfo()
+	assert.NoError(t, err)
+	assert.Contains(t, info, "apple")
+	assert.Contains(t, info, "cash")
+}
@@ -0,0 +1,306 @@
+package wallet
+
+import (
+	"encoding/json"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/blockcypher/libgrin/libwallet"
+	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/pkg/errors"
+)
+
+// Batch payouts send to many receivers in one transaction with the multiparty protocol run in parallel.
+// The initiator creates one slate per payout, each receiver joins its own copy adding its output, public blind and nonce.
+// The initiator combines the joined slates into one, every receiver signs it and the initiator merges their partial
+// signatures to finalize. The initiator pays the fee in the asset of the first payout.
+
+// Payout is an amount of an asset one receiver of a batch gets
+type Payout struct {
+	Amount uint64
+	Asset  string
+}
+
+// NewBatch selects inputs for the sum of payouts of every asset and returns a slate for each payout to send to its receiver
+func (t *Wallet) NewBatch(payouts []Payout) (slatesBytes [][]byte, err error) {
+	if len(payouts) == 0 {
+		return nil, errors.New("expected at least one payout")
+	}
+
+	// sums to pay in each asset, in order of first payout of the asset
+	var assets []string
+	totals := make(map[string]uint64)
+	for _, payout := range payouts {
+		if payout.Amount == 0 {
+			return nil, errors.Errorf("cannot pay zero %v", payout.Asset)
+		}
+		if _, ok := totals[payout.Asset]; !ok {
+			assets = append(assets, payout.Asset)
+		}
+		totals[payout.Asset] += payout.Amount
+	}
+
+	// the fee counts outputs of all receivers and change of assets other than the one it is paid in
+	feeAsset := assets[0]
+	inputs, change, fee, err := t.selectInputs(totals[feeAsset], feeAsset, t.feeFunc(len(payouts)+len(assets)-1))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot selectInputs")
+	}
+
+	_, outputs, savedSlate, err := t.NewSlate(totals[feeAsset], fee, feeAsset, change, inputs, 0, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot NewSlate")
+	}
+
+	// inputs and change of other assets add to the initiator's blind excess
+	blinds := [][]byte{savedSlate.Blind[:]}
+
+	for _, asset := range assets[1:] {
+		assetInputs, assetChange, _, e := t.selectInputs(totals[asset], asset, noFee)
+		if e != nil {
+			return nil, errors.Wrapf(e, "cannot selectInputs of %v", asset)
+		}
+
+		coreInputs, assetOutputs, blindExcess, e := t.inputsAndOutputs(totals[asset], 0, asset, assetChange, assetInputs, 0, "")
+		if e != nil {
+			return nil, errors.Wrapf(e, "cannot create slate inputs and outputs of %v", asset)
+		}
+
+		savedSlate.Transaction.Body.Inputs = append(savedSlate.Transaction.Body.Inputs, coreInputs...)
+		for _, o := range assetOutputs {
+			savedSlate.Transaction.Body.Outputs = append(savedSlate.Transaction.Body.Outputs, o.Output)
+		}
+		outputs = append(outputs, assetOutputs...)
+
+		blinds = append(blinds, blindExcess[:])
+	}
+
+	if len(blinds) > 1 {
+		savedSlate.Blind, err = secp256k1.BlindSum(t.context, blinds, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot BlindSum")
+		}
+
+		publicBlind, e := t.pubKeyFromSecretKey(savedSlate.Blind[:])
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot create publicBlind")
+		}
+		savedSlate.ParticipantData[0].PublicBlindExcess = publicBlind.Hex(t.context)
+	}
+
+	savedSlate.NumParticipants = uint(len(payouts) + 1)
+	// payment proofs are between a sender and a receiver only
+	savedSlate.PaymentProof = nil
+
+	// each receiver learns only its own payout
+	for _, payout := range payouts {
+		slate := savedSlate.Slate
+		slate.Amount = core.Uint64(payout.Amount)
+		slate.Asset = payout.Asset
+		slate.ReceiveAmount = 0
+		slate.ReceiveAsset = ""
+
+		slateBytes, e := json.Marshal(slate)
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot marshal slate to json")
+		}
+		slatesBytes = append(slatesBytes, slateBytes)
+	}
+
+	for _, o := range outputs {
+		err = t.db.PutOutput(o)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+	}
+
+	err = t.db.PutSenderSlate(savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutSenderSlate")
+	}
+
+	return
+}
+
+// JoinBatch adds the receiver's output for the payout in the slate, its public blind and nonce
+func (t *Wallet) JoinBatch(inSlateBytes []byte) (outSlateBytes []byte, err error) {
+	slate, _, err := parseSlate(inSlateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parseSlate")
+	}
+
+	if slate.Amount == 0 {
+		return nil, errors.New("expected a payout amount in the slate")
+	}
+
+	if len(slate.ParticipantData) != 1 {
+		return nil, errors.Errorf("expected a slate of the initiator only, got %d participants", len(slate.ParticipantData))
+	}
+
+	// the wallet keeps one slate per transaction so it can receive only one payout of a batch
+	id, _ := slate.ID.MarshalText()
+	_, err = t.db.GetReceiverSlate(id)
+	if err == nil {
+		return nil, errors.Errorf("already joined batch %v", slate.ID)
+	}
+
+	// the initiator pays the fee in the asset of the first payout, a fee in another asset counts as none
+	fee, e := assetFee(uint64(slate.Fee), slate.Asset)
+	if e != nil {
+		fee = 0
+	}
+	err = t.checkFeePolicy(fee, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot accept fee")
+	}
+
+	outSlateBytes, err = t.JoinMultiparty(inSlateBytes, 0, "", uint64(slate.Amount), slate.Asset)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot JoinMultiparty")
+	}
+
+	return
+}
+
+// CombineBatch is called by the initiator to collect outputs and participant data of all receivers into one slate for them to sign
+func (t *Wallet) CombineBatch(joinedSlatesBytes [][]byte) (slateBytes []byte, err error) {
+	var senderSlate *SavedSlate
+	var combined Slate
+
+	// commits of inputs and outputs already in the combined slate, and of the initiator's
+	commits := make(map[string]bool)
+	senderCommits := make(map[string]bool)
+
+	for i, joinedSlateBytes := range joinedSlatesBytes {
+		slate, _, e := parseSlate(joinedSlateBytes)
+		if e != nil {
+			return nil, errors.Wrapf(e, "cannot parseSlate %d", i)
+		}
+
+		if i == 0 {
+			id, _ := slate.ID.MarshalText()
+			senderSlate, err = t.db.GetSenderSlate(id)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot GetSenderSlate")
+			}
+
+			combined = senderSlate.Slate
+			combined.Transaction.Body.Inputs = append([]core.Input{}, senderSlate.Transaction.Body.Inputs...)
+			combined.Transaction.Body.Outputs = append([]core.Output{}, senderSlate.Transaction.Body.Outputs...)
+			combined.ParticipantData = append([]libwallet.ParticipantData{}, senderSlate.ParticipantData...)
+
+			// amounts of each participant are its own business
+			combined.Amount = 0
+			combined.Asset = ""
+
+			for _, input := range combined.Transaction.Body.Inputs {
+				senderCommits["i"+input.Commit] = true
+			}
+			for _, output := range combined.Transaction.Body.Outputs {
+				senderCommits["o"+output.Commit] = true
+			}
+		} else if slate.ID != senderSlate.ID {
+			return nil, errors.Errorf("slate %d is of another batch %v", i, slate.ID)
+		}
+
+		if len(slate.ParticipantData) != 2 ||
+			slate.ParticipantData[0].PublicBlindExcess != senderSlate.ParticipantData[0].PublicBlindExcess ||
+			slate.ParticipantData[0].PublicNonce != senderSlate.ParticipantData[0].PublicNonce {
+			return nil, errors.Errorf("slate %d is not joined by one receiver to the initiator", i)
+		}
+
+		// the receiver must keep the initiator's part of the transaction intact
+		err = checkIntact(slate, senderSlate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot checkIntact slate %d", i)
+		}
+
+		for _, input := range slate.Transaction.Body.Inputs {
+			if senderCommits["i"+input.Commit] {
+				continue
+			}
+			if commits["i"+input.Commit] {
+				return nil, errors.Errorf("input %v of slate %d is in another slate", input.Commit, i)
+			}
+			commits["i"+input.Commit] = true
+			combined.Transaction.Body.Inputs = append(combined.Transaction.Body.Inputs, input)
+		}
+		for _, output := range slate.Transaction.Body.Outputs {
+			if senderCommits["o"+output.Commit] {
+				continue
+			}
+			if commits["o"+output.Commit] {
+				return nil, errors.Errorf("output %v of slate %d is in another slate", output.Commit, i)
+			}
+			commits["o"+output.Commit] = true
+			combined.Transaction.Body.Outputs = append(combined.Transaction.Body.Outputs, output)
+		}
+
+		participant := slate.ParticipantData[1]
+		participant.ID = core.Uint64(len(combined.ParticipantData))
+		participant.PartSig = nil
+		combined.ParticipantData = append(combined.ParticipantData, participant)
+	}
+
+	if senderSlate == nil {
+		return nil, errors.New("expected slates joined by receivers")
+	}
+
+	if uint(len(combined.ParticipantData)) != combined.NumParticipants {
+		return nil, errors.Errorf("expected %d receivers, got %d", combined.NumParticipants-1, len(combined.ParticipantData)-1)
+	}
+
+	slateBytes, err = json.Marshal(combined)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate to json")
+	}
+
+	return
+}
+
+// FinalizeBatch is called by the initiator to merge partial signatures of receivers of the combined slate
+// and finalize the transaction
+func (t *Wallet) FinalizeBatch(signedSlatesBytes [][]byte) (txBytes []byte, err error) {
+	var merged *Slate
+
+	for i, signedSlateBytes := range signedSlatesBytes {
+		slate, _, e := parseSlate(signedSlateBytes)
+		if e != nil {
+			return nil, errors.Wrapf(e, "cannot parseSlate %d", i)
+		}
+
+		if merged == nil {
+			merged = slate
+			continue
+		}
+
+		if slate.ID != merged.ID || len(slate.ParticipantData) != len(merged.ParticipantData) {
+			return nil, errors.Errorf("slate %d is not of the same batch", i)
+		}
+
+		for j, participant := range slate.ParticipantData {
+			if participant.PublicBlindExcess != merged.ParticipantData[j].PublicBlindExcess ||
+				participant.PublicNonce != merged.ParticipantData[j].PublicNonce {
+				return nil, errors.Errorf("participant %d of slate %d has changed", j, i)
+			}
+			if participant.PartSig != nil {
+				merged.ParticipantData[j].PartSig = participant.PartSig
+			}
+		}
+	}
+
+	if merged == nil {
+		return nil, errors.New("expected slates signed by receivers")
+	}
+
+	slateBytes, err := json.Marshal(merged)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate to json")
+	}
+
+	txBytes, err = t.FinalizeMultiparty(slateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot FinalizeMultiparty")
+	}
+
+	return
+}
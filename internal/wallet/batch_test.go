@@ -0,0 +1,106 @@
+package wallet
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	// a pays out to b, c and d
+	var wallets []*Wallet
+	for i := 0; i < 4; i++ {
+		dir := testDbDir() + "_batch_" + strconv.Itoa(i)
+
+		err := os.RemoveAll(dir)
+		assert.NoError(t, err)
+
+		w, err := NewWalletWithoutMasterKey(dir)
+		assert.NoError(t, err)
+		defer w.Close()
+
+		_, err = w.InitMasterKey("", "", DefaultMnemonicWords, "")
+		assert.NoError(t, err)
+
+		wallets = append(wallets, w)
+	}
+	a, receivers := wallets[0], wallets[1:]
+
+	_, err := a.Issue(10, "cash")
+	assert.NoError(t, err)
+	_, err = a.Issue(5, "apple")
+	assert.NoError(t, err)
+
+	a.SetFee(1)
+
+	slates, err := a.NewBatch([]Payout{{3, "cash"}, {2, "apple"}, {4, "cash"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(slates))
+
+	// a receiver refuses a fee below its minimum, in the asset of its payout or not
+	receivers[0].SetFeePolicy(FeePolicy{MinFee: 2})
+	_, err = receivers[0].JoinBatch(slates[0])
+	assert.Error(t, err)
+	receivers[1].SetFeePolicy(FeePolicy{MinFee: 1})
+	_, err = receivers[1].JoinBatch(slates[1])
+	assert.Error(t, err)
+	receivers[0].SetFeePolicy(FeePolicy{MinFee: 1})
+	receivers[1].SetFeePolicy(FeePolicy{})
+
+	var joined [][]byte
+	for i, receiver := range receivers {
+		slateBytes, err := receiver.JoinBatch(slates[i])
+		assert.NoError(t, err)
+		joined = append(joined, slateBytes)
+	}
+
+	// a receiver cannot join twice
+	_, err = receivers[0].JoinBatch(slates[0])
+	assert.Error(t, err)
+
+	// all receivers must join
+	_, err = a.CombineBatch(joined[:2])
+	assert.Error(t, err)
+
+	slateBytes, err := a.CombineBatch(joined)
+	assert.NoError(t, err)
+
+	var signed [][]byte
+	for _, receiver := range receivers {
+		signedBytes, err := receiver.SignMultiparty(slateBytes)
+		assert.NoError(t, err)
+		signed = append(signed, signedBytes)
+	}
+
+	// all receivers must sign
+	_, err = a.FinalizeBatch(signed[:2])
+	assert.Error(t, err)
+
+	txBytes, err := a.FinalizeBatch(signed)
+	assert.NoError(t, err)
+
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+
+	// 2 inputs, 3 payouts and change of cash and apples in one kernel paying the fee in cash
+	assert.Equal(t, 2, len(tx.Body.Inputs))
+	assert.Equal(t, 5, len(tx.Body.Outputs))
+	assert.Equal(t, 1, len(tx.Body.Kernels))
+	assert.Equal(t, core.Uint64(kernelFee(1, "cash")), tx.Body.Kernels[0].Fee)
+
+	id := []byte(tx.ID.String())
+	for _, w := range wallets {
+		err = w.Confirm(id)
+		assert.NoError(t, err)
+	}
+
+	assert.ElementsMatch(t, []uint64{2}, spendableValues(t, a, "cash"))
+	assert.ElementsMatch(t, []uint64{3}, spendableValues(t, a, "apple"))
+	assert.ElementsMatch(t, []uint64{3}, spendableValues(t, receivers[0], "cash"))
+	assert.ElementsMatch(t, []uint64{2}, spendableValues(t, receivers[1], "apple"))
+	assert.ElementsMatch(t, []uint64{4}, spendableValues(t, receivers[2], "cash"))
+}
@@ -0,0 +1,131 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20"
+)
+
+// secp256k1 curve order, bulletproof scalars are calculated modulo it
+var curveOrder, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+
+// bulletproofChallenges recovers challenges x and z the prover derived from the commitment and A, S, T1, T2 points
+func bulletproofChallenges(proof []byte, commitment *secp256k1.Commitment) (x *big.Int, z *big.Int, err error) {
+	// proof starts with tau x and mu, then a byte of y parity bits of A, S, T1, T2 points followed by their x coordinates
+	if len(proof) < 64+1+4*32 {
+		return nil, nil, errors.New("bulletproof is too short")
+	}
+	parity := proof[64]
+	points := proof[65:]
+	point := func(i int) (byte, []byte) {
+		return (parity >> i) & 1, points[i*32 : (i+1)*32]
+	}
+
+	// serialized commitment and generator keep y parity in the lowest bit of the first byte
+	commitBytes := commitment.Bytes()
+	generatorBytes := secp256k1.GeneratorH.Bytes()
+
+	var hash [32]byte
+	hash = bulletproofChallenge(hash, commitBytes[0]&1, commitBytes[1:], generatorBytes[0]&1, generatorBytes[1:])
+
+	aParity, a := point(0)
+	sParity, s := point(1)
+	hash = bulletproofChallenge(hash, aParity, a, sParity, s) // y
+	hash = bulletproofChallenge(hash, aParity, a, sParity, s) // z
+	z = new(big.Int).Mod(new(big.Int).SetBytes(hash[:]), curveOrder)
+
+	tOneParity, tOne := point(2)
+	tTwoParity, tTwo := point(3)
+	hash = bulletproofChallenge(hash, tOneParity, tOne, tTwoParity, tTwo)
+	x = new(big.Int).Mod(new(big.Int).SetBytes(hash[:]), curveOrder)
+
+	return
+}
+
+// bulletproofChallenge hashes the previous challenge with two points the way the bulletproof prover does
+func bulletproofChallenge(previous [32]byte, lParity byte, lx []byte, rParity byte, rx []byte) [32]byte {
+	hash := sha256.New()
+	hash.Write(previous[:])
+	hash.Write([]byte{lParity<<1 + rParity})
+	hash.Write(lx)
+	hash.Write(rx)
+
+	var sum [32]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
+
+// rewindBulletproof recovers the committed value and the message from a bulletproof made with the rewind nonce.
+// The prover hides value and message in mu = alpha + rho*x, where alpha and rho are derived from the nonce.
+// The blind is not recovered as it is hidden with tau1 and tau2 derived from the separate private nonce
+func rewindBulletproof(
+	proof []byte,
+	commitment *secp256k1.Commitment,
+	nonce []byte,
+) (
+	value uint64,
+	message []byte,
+	err error,
+) {
+	x, _, err := bulletproofChallenges(proof, commitment)
+	if err != nil {
+		err = errors.Wrap(err, "cannot get bulletproofChallenges")
+		return
+	}
+
+	alpha, rho, err := scalarChacha20(nonce, 0)
+	if err != nil {
+		err = errors.Wrap(err, "cannot derive alpha and rho")
+		return
+	}
+
+	// mu in the proof is negated, so that -mu + alpha + rho*x leaves value and message
+	mu := new(big.Int).SetBytes(proof[32:64])
+	mu.Add(mu, alpha)
+	mu.Add(mu, new(big.Int).Mul(rho, x))
+	mu.Mod(mu, curveOrder)
+
+	var muBytes [32]byte
+	mu.FillBytes(muBytes[:])
+	if !bytes.Equal(muBytes[:4], []byte{0, 0, 0, 0}) {
+		err = errors.Wrap(ErrNotOurs, "bulletproof was not made with this nonce")
+		return
+	}
+
+	message = muBytes[4:24]
+	value = new(big.Int).SetBytes(muBytes[24:]).Uint64()
+
+	return
+}
+
+// scalarChacha20 derives two scalars from a 32 byte seed the way the bulletproof prover does: from chacha20
+// key stream block number idx, with the nonce counting the blocks rejected for overflowing the curve order
+func scalarChacha20(seed []byte, idx uint64) (r1 *big.Int, r2 *big.Int, err error) {
+	for overCount := uint32(0); ; overCount++ {
+		nonce := make([]byte, 12)
+		nonce[8] = byte(overCount)
+		nonce[9] = byte(overCount >> 8)
+		nonce[10] = byte(overCount >> 16)
+		nonce[11] = byte(overCount >> 24)
+
+		cipher, e := chacha20.NewUnauthenticatedCipher(seed, nonce)
+		if e != nil {
+			return nil, nil, errors.Wrap(e, "cannot create chacha20 cipher")
+		}
+
+		// the counter starts at zero, skip to block idx
+		stream := make([]byte, 64*(idx+1))
+		cipher.XORKeyStream(stream, stream)
+		block := stream[64*idx:]
+
+		r1 = new(big.Int).SetBytes(block[:32])
+		r2 = new(big.Int).SetBytes(block[32:])
+		if r1.Cmp(curveOrder) < 0 && r2.Cmp(curveOrder) < 0 {
+			return
+		}
+	}
+}
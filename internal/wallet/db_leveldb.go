@@ -1,18 +1,24 @@
 package wallet
 
 import (
+	"crypto/cipher"
+	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
 	"github.com/pkg/errors"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/util"
+	"golang.org/x/crypto/chacha20poly1305"
 	"log"
 	"path/filepath"
 	"sort"
+	"strconv"
 )
 
+// leveldbDatabase encrypts values with the key set by Unlock, leveldb keys are not encrypted
 type leveldbDatabase struct {
-	db *leveldb.DB
+	db   *leveldb.DB
+	aead cipher.AEAD
 }
 
 func NewLeveldbDatabase(dbDir string) (d Database, err error) {
@@ -29,6 +35,132 @@ func NewLeveldbDatabase(dbDir string) (d Database, err error) {
 	return
 }
 
+// Unlock sets the key values are encrypted with, database cannot be read or written before it is unlocked
+func (t *leveldbDatabase) Unlock(key []byte) error {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return errors.Wrap(err, "cannot create xchacha20poly1305 cipher")
+	}
+
+	t.aead = aead
+
+	return nil
+}
+
+// schemaVersion of the database: values are encrypted since version 1
+const schemaVersion = 1
+
+// schemaKey holds the version the database is migrated to, its value is not encrypted
+func schemaKey() []byte {
+	return []byte("schema")
+}
+
+// Migrate upgrades the database written by an earlier version of the wallet once it is unlocked.
+// Version 1 encrypts values written in plaintext before values were encrypted
+func (t *leveldbDatabase) Migrate() error {
+	if t.aead == nil {
+		return errors.New("database is locked")
+	}
+
+	var version uint64
+	versionBytes, err := t.db.Get(schemaKey(), nil)
+	if err == nil {
+		version, _ = binary.Uvarint(versionBytes)
+	} else if err != leveldb.ErrNotFound {
+		return errors.Wrap(err, "cannot get schema version")
+	}
+
+	if version >= schemaVersion {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+
+	iter := t.db.NewIterator(nil, nil)
+	for iter.Next() {
+		key := iter.Key()
+		if string(key) == string(schemaKey()) {
+			continue
+		}
+		// values written since encryption but before the schema version was recorded are left as they are
+		if _, e := t.open(key, iter.Value()); e == nil {
+			continue
+		}
+		sealed, e := t.seal(key, iter.Value())
+		if e != nil {
+			iter.Release()
+			return errors.Wrap(e, "cannot seal")
+		}
+		batch.Put(append([]byte{}, key...), sealed)
+	}
+	iter.Release()
+	err = iter.Error()
+	if err != nil {
+		return errors.Wrap(err, "cannot iterate")
+	}
+
+	versionBytes = make([]byte, binary.MaxVarintLen64)
+	batch.Put(schemaKey(), versionBytes[:binary.PutUvarint(versionBytes, schemaVersion)])
+
+	err = t.db.Write(batch, nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot write migrated values")
+	}
+
+	return nil
+}
+
+// seal encrypts the value with a random nonce it is prepended with, the leveldb key is authenticated
+// so that values cannot be swapped
+func (t *leveldbDatabase) seal(key []byte, value []byte) (sealed []byte, err error) {
+	if t.aead == nil {
+		return nil, errors.New("database is locked")
+	}
+
+	nonce := make([]byte, t.aead.NonceSize(), t.aead.NonceSize()+len(value)+t.aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read random nonce")
+	}
+
+	return t.aead.Seal(nonce, nonce, value, key), nil
+}
+
+func (t *leveldbDatabase) open(key []byte, sealed []byte) (value []byte, err error) {
+	if t.aead == nil {
+		return nil, errors.New("database is locked")
+	}
+
+	if len(sealed) < t.aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	value, err = t.aead.Open(nil, sealed[:t.aead.NonceSize()], sealed[t.aead.NonceSize():], key)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decrypt value")
+	}
+
+	return
+}
+
+func (t *leveldbDatabase) put(key []byte, value []byte) error {
+	sealed, err := t.seal(key, value)
+	if err != nil {
+		return errors.Wrap(err, "cannot seal")
+	}
+
+	return t.db.Put(key, sealed, nil)
+}
+
+func (t *leveldbDatabase) get(key []byte) (value []byte, err error) {
+	sealed, err := t.db.Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.open(key, sealed)
+}
+
 func (t *leveldbDatabase) Close() {
 	err := t.db.Close()
 	if err != nil {
@@ -46,7 +178,7 @@ func (t *leveldbDatabase) PutSenderSlate(slate *SavedSlate) error {
 		return errors.Wrap(err, "cannot marshal SenderSlate into json")
 	}
 
-	err = t.db.Put(senderSlateKey(slate.ID.String()), slateBytes, nil)
+	err = t.put(senderSlateKey(slate.ID.String()), slateBytes)
 	if err != nil {
 		return errors.Wrap(err, "cannot Put slate")
 	}
@@ -64,7 +196,7 @@ func (t *leveldbDatabase) PutReceiverSlate(slate *SavedSlate) error {
 		return errors.Wrap(err, "cannot marshal ReceiverSlate into json")
 	}
 
-	err = t.db.Put(receiverSlateKey(slate.ID.String()), slateBytes, nil)
+	err = t.put(receiverSlateKey(slate.ID.String()), slateBytes)
 	if err != nil {
 		return errors.Wrap(err, "cannot Put slate")
 	}
@@ -80,7 +212,7 @@ func (t *leveldbDatabase) PutTransaction(transaction Transaction) error {
 
 	key := transactionKey(transaction.ID.String())
 
-	err = t.db.Put(key, transactionBytes, nil)
+	err = t.put(key, transactionBytes)
 	if err != nil {
 		return errors.Wrap(err, "cannot Put transaction")
 	}
@@ -106,7 +238,7 @@ func (t *leveldbDatabase) PutOutput(output Output) error {
 		return errors.Wrap(err, "cannot marshal output into json")
 	}
 
-	err = t.db.Put(outputKey(output.Commit), outputBytes, nil)
+	err = t.put(outputKey(output.Commit), outputBytes)
 	if err != nil {
 		return errors.Wrap(err, "cannot Put output")
 	}
@@ -115,7 +247,7 @@ func (t *leveldbDatabase) PutOutput(output Output) error {
 }
 
 func (t *leveldbDatabase) GetSenderSlate(id []byte) (slate *SavedSlate, err error) {
-	slateBytes, err := t.db.Get(senderSlateKey(string(id)), nil)
+	slateBytes, err := t.get(senderSlateKey(string(id)))
 	if err != nil {
 		err = errors.Wrap(err, "cannot Get slate")
 		return
@@ -132,63 +264,52 @@ func (t *leveldbDatabase) GetSenderSlate(id []byte) (slate *SavedSlate, err erro
 	return slate, nil
 }
 
-func (t *leveldbDatabase) GetInputs(amount uint64, asset string) (inputs []Output, change uint64, err error) {
-	// collect valid outputs whose amount is less or equal to the amount to send
+func (t *leveldbDatabase) GetReceiverSlate(id []byte) (slate *SavedSlate, err error) {
+	slateBytes, err := t.get(receiverSlateKey(string(id)))
+	if err != nil {
+		err = errors.Wrap(err, "cannot Get slate")
+		return
+	}
+
+	slate = &SavedSlate{}
+
+	err = json.Unmarshal(slateBytes, slate)
+	if err != nil {
+		err = errors.Wrap(err, "cannot unmarshal slateBytes")
+		return
+	}
+
+	return slate, nil
+}
 
-	outputs := make([]Output, 0)
+// ListSpendable returns confirmed outputs of the account in the asset this wallet can spend alone and has not frozen
+func (t *leveldbDatabase) ListSpendable(account uint32, asset string) (outputs []Output, err error) {
+	outputs = make([]Output, 0)
 
 	iter := t.db.NewIterator(outputRange(), nil)
 	for iter.Next() {
 		output := Output{}
-		err = json.Unmarshal(iter.Value(), &output)
+		value, e := t.open(iter.Key(), iter.Value())
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot open output in iterator")
+		}
+		err = json.Unmarshal(value, &output)
 		if err != nil {
-			return nil, 0, errors.Wrap(err, "cannot unmarshal output in iterator")
+			return nil, errors.Wrap(err, "cannot unmarshal output in iterator")
 		}
-		if output.Asset == asset && output.Status == OutputConfirmed {
+		// shared multisig outputs cannot be spent by this wallet alone
+		if output.Account == account && output.Asset == asset && output.Status == OutputConfirmed && !output.Multisig && !output.Frozen {
 			outputs = append(outputs, output)
 		}
 	}
 
-	// sort outputs increasing by value
-
-	sort.Slice(outputs, func(i, j int) bool {
-		return outputs[i].Value < outputs[j].Value
-	})
-
-	// loop thru outputs and collect into inputs only enough to cover the amount
-
-	inputs = make([]Output, 0)
-
-	var sumValues uint64
-
-	for _, output := range outputs {
-		sumValues += output.Value
-		inputs = append(inputs, output)
-
-		if sumValues >= amount {
-			break
-		}
-	}
-
-	// calculate value of change output
-
-	if sumValues < amount {
-		return nil, 0, errors.New("sum of sender input values is less than the amount to send")
-	}
-
-	change = sumValues - amount
-
-	// lock outputs as they are now inputs to a new transaction
-
-	for _, input := range inputs {
-		input.Status = OutputLocked
-		err = t.PutOutput(input)
-		if err != nil {
-			return nil, 0, errors.Wrap(err, "cannot lock input")
-		}
+	iter.Release()
+	err = iter.Error()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot iterate")
 	}
 
-	return inputs, change, nil
+	return outputs, nil
 }
 
 func (t *leveldbDatabase) ListSlates() (slates []SavedSlate, err error) {
@@ -197,7 +318,11 @@ func (t *leveldbDatabase) ListSlates() (slates []SavedSlate, err error) {
 	iter := t.db.NewIterator(util.BytesPrefix([]byte("slate")), nil)
 	for iter.Next() {
 		slate := SavedSlate{}
-		err = json.Unmarshal(iter.Value(), &slate)
+		value, e := t.open(iter.Key(), iter.Value())
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot open slate in iterator")
+		}
+		err = json.Unmarshal(value, &slate)
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot unmarshal slate in iterator")
 		}
@@ -219,7 +344,11 @@ func (t *leveldbDatabase) ListTransactions() (transactions []Transaction, err er
 	iter := t.db.NewIterator(util.BytesPrefix([]byte("transaction")), nil)
 	for iter.Next() {
 		transaction := Transaction{}
-		err = json.Unmarshal(iter.Value(), &transaction)
+		value, e := t.open(iter.Key(), iter.Value())
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot open transaction in iterator")
+		}
+		err = json.Unmarshal(value, &transaction)
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot unmarshal transaction in iterator")
 		}
@@ -241,7 +370,11 @@ func (t *leveldbDatabase) ListOutputs() (outputs []Output, err error) {
 	iter := t.db.NewIterator(outputRange(), nil)
 	for iter.Next() {
 		output := Output{}
-		err = json.Unmarshal(iter.Value(), &output)
+		value, e := t.open(iter.Key(), iter.Value())
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot open output in iterator")
+		}
+		err = json.Unmarshal(value, &output)
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot unmarshal output in iterator")
 		}
@@ -258,7 +391,7 @@ func (t *leveldbDatabase) ListOutputs() (outputs []Output, err error) {
 }
 
 func (t *leveldbDatabase) GetTransaction(id []byte) (transaction Transaction, err error) {
-	transactionBytes, err := t.db.Get(transactionKey(string(id)), nil)
+	transactionBytes, err := t.get(transactionKey(string(id)))
 	if err != nil {
 		return Transaction{}, errors.Wrap(err, "cannot Get transaction")
 	}
@@ -274,7 +407,7 @@ func (t *leveldbDatabase) GetTransaction(id []byte) (transaction Transaction, er
 }
 
 func (t *leveldbDatabase) GetOutput(commit string) (output Output, err error) {
-	outputBytes, err := t.db.Get(outputKey(commit), nil)
+	outputBytes, err := t.get(outputKey(commit))
 	if err != nil {
 		return Output{}, errors.Wrap(err, "cannot Get output")
 	}
@@ -353,10 +486,13 @@ func (t *leveldbDatabase) update(transactionID []byte, transactionStatus Transac
 	return nil
 }
 
-const indexKey = "index"
+// key indexes are counted separately for each account
+func indexKey(account uint32) []byte {
+	return []byte("index." + strconv.Itoa(int(account)))
+}
 
-func (t *leveldbDatabase) NextIndex() (uint32, error) {
-	exists, err := t.db.Has([]byte(indexKey), nil)
+func (t *leveldbDatabase) NextIndex(account uint32) (uint32, error) {
+	exists, err := t.db.Has(indexKey(account), nil)
 	if err != nil {
 		return 0, errors.Wrap(err, "cannot check if Has index")
 	}
@@ -365,7 +501,7 @@ func (t *leveldbDatabase) NextIndex() (uint32, error) {
 	var indexBytes = make([]byte, 4)
 
 	if exists {
-		indexBytes, err := t.db.Get([]byte(indexKey), nil)
+		indexBytes, err := t.get(indexKey(account))
 		if err != nil {
 			return 0, errors.Wrap(err, "cannot Get index")
 		}
@@ -376,10 +512,134 @@ func (t *leveldbDatabase) NextIndex() (uint32, error) {
 
 	binary.BigEndian.PutUint32(indexBytes, index)
 
-	err = t.db.Put([]byte(indexKey), indexBytes, nil)
+	err = t.put(indexKey(account), indexBytes)
 	if err != nil {
 		return 0, errors.Wrap(err, "cannot Put index")
 	}
 
 	return index, nil
 }
+
+// PutIndex makes NextIndex return key indexes after the given one, it never moves the index back
+func (t *leveldbDatabase) PutIndex(account uint32, index uint32) error {
+	indexBytes, err := t.get(indexKey(account))
+	if err == nil && binary.BigEndian.Uint32(indexBytes) >= index {
+		return nil
+	}
+	if err != nil && err != leveldb.ErrNotFound {
+		return errors.Wrap(err, "cannot Get index")
+	}
+
+	indexBytes = make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+
+	err = t.put(indexKey(account), indexBytes)
+	if err != nil {
+		return errors.Wrap(err, "cannot Put index")
+	}
+
+	return nil
+}
+
+func accountKey(name string) []byte {
+	return []byte("account." + name)
+}
+
+const currentAccountKey = "current_account"
+
+const selectionKey = "selection"
+
+func (t *leveldbDatabase) PutAccount(account Account) error {
+	accountBytes, err := json.Marshal(account)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal account into json")
+	}
+
+	err = t.put(accountKey(account.Name), accountBytes)
+	if err != nil {
+		return errors.Wrap(err, "cannot Put account")
+	}
+
+	return nil
+}
+
+func (t *leveldbDatabase) GetAccount(name string) (account Account, err error) {
+	accountBytes, err := t.get(accountKey(name))
+	if err != nil {
+		return Account{}, errors.Wrap(err, "cannot Get account")
+	}
+
+	err = json.Unmarshal(accountBytes, &account)
+	if err != nil {
+		return Account{}, errors.Wrap(err, "cannot unmarshal accountBytes")
+	}
+
+	return account, nil
+}
+
+// ListAccounts returns accounts sorted by number
+func (t *leveldbDatabase) ListAccounts() (accounts []Account, err error) {
+	accounts = make([]Account, 0)
+
+	iter := t.db.NewIterator(util.BytesPrefix([]byte("account.")), nil)
+	for iter.Next() {
+		account := Account{}
+		value, e := t.open(iter.Key(), iter.Value())
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot open account in iterator")
+		}
+		err = json.Unmarshal(value, &account)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot unmarshal account in iterator")
+		}
+		accounts = append(accounts, account)
+	}
+
+	iter.Release()
+	err = iter.Error()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot iterate")
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Number < accounts[j].Number
+	})
+
+	return accounts, nil
+}
+
+func (t *leveldbDatabase) PutCurrentAccount(name string) error {
+	err := t.put([]byte(currentAccountKey), []byte(name))
+	if err != nil {
+		return errors.Wrap(err, "cannot Put current account")
+	}
+
+	return nil
+}
+
+func (t *leveldbDatabase) GetCurrentAccount() (name string, err error) {
+	nameBytes, err := t.get([]byte(currentAccountKey))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot Get current account")
+	}
+
+	return string(nameBytes), nil
+}
+
+func (t *leveldbDatabase) PutSelection(name string) error {
+	err := t.put([]byte(selectionKey), []byte(name))
+	if err != nil {
+		return errors.Wrap(err, "cannot Put selection")
+	}
+
+	return nil
+}
+
+func (t *leveldbDatabase) GetSelection() (name string, err error) {
+	nameBytes, err := t.get([]byte(selectionKey))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot Get selection")
+	}
+
+	return string(nameBytes), nil
+}
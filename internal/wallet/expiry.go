@@ -0,0 +1,192 @@
+package wallet
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// DefaultSlateTTL is how long slates the wallet initiates are valid, after that their inputs are unlocked
+const DefaultSlateTTL = 24 * time.Hour
+
+// Expiry is when the slate is no longer valid: at the time or the height, whichever is given and comes first
+type Expiry struct {
+	// Time in seconds since Unix epoch
+	Time int64 `json:"time,omitempty"`
+	// Height of the block
+	Height uint64 `json:"height,omitempty"`
+}
+
+// Expired checks the expiry against the time and the height, height 0 is unknown and is not checked
+func (t *Expiry) Expired(now time.Time, height uint64) bool {
+	if t == nil {
+		return false
+	}
+
+	if t.Time > 0 && now.Unix() >= t.Time {
+		return true
+	}
+
+	return t.Height > 0 && height > 0 && height >= t.Height
+}
+
+// Remaining tells how long from now the slate is valid for
+func (t *Expiry) Remaining(now time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	var s string
+	if t.Time > 0 {
+		s = time.Unix(t.Time, 0).Sub(now).Round(time.Second).String()
+	}
+	if t.Height > 0 {
+		if len(s) > 0 {
+			s += " or "
+		}
+		s += "height " + strconv.FormatUint(t.Height, 10)
+	}
+
+	return s
+}
+
+// SetTTL sets how long slates the wallet initiates are valid until it is closed, zero is for no time limit
+func (t *Wallet) SetTTL(ttl time.Duration) {
+	t.ttl = ttl
+}
+
+// SetExpiryHeight sets the height slates the wallet initiates expire at until it is closed, zero is for no height limit
+func (t *Wallet) SetExpiryHeight(height uint64) {
+	t.expiryHeight = height
+}
+
+// SetHeight tells the wallet the current height of the chain and cancels slates expired by it
+func (t *Wallet) SetHeight(height uint64) error {
+	t.height = height
+
+	_, err := t.CancelExpired()
+	if err != nil {
+		return errors.Wrap(err, "cannot CancelExpired")
+	}
+
+	return nil
+}
+
+// expiry of a new slate, nil when it does not expire
+func (t *Wallet) expiry() *Expiry {
+	if t.ttl <= 0 && t.expiryHeight == 0 {
+		return nil
+	}
+
+	expiry := &Expiry{Height: t.expiryHeight}
+	if t.ttl > 0 {
+		expiry.Time = time.Now().Add(t.ttl).Unix()
+	}
+
+	return expiry
+}
+
+// checkExpiry refuses slates expired by now or by the height the wallet knows
+func (t *Wallet) checkExpiry(slate *Slate) error {
+	if slate.Expiry.Expired(time.Now(), t.height) {
+		return errors.Errorf("slate %v has expired", slate.ID)
+	}
+
+	return nil
+}
+
+// checkOpen refuses to finalize slates that have been canceled or have expired,
+// a slate that expires at a height is finalized only when the wallet knows the height of the chain
+func (t *Wallet) checkOpen(senderSlate *SavedSlate) error {
+	id, _ := senderSlate.ID.MarshalText()
+
+	tx, err := t.db.GetTransaction(id)
+	if err == nil && tx.Status == TransactionCanceled {
+		return errors.Errorf("slate %v has been canceled", senderSlate.ID)
+	}
+
+	if senderSlate.Expiry != nil && senderSlate.Expiry.Height > 0 && t.height == 0 {
+		return errors.Errorf("slate %v expires at height %v but the height of the chain is unknown", senderSlate.ID, senderSlate.Expiry.Height)
+	}
+
+	return t.checkExpiry(&senderSlate.Slate)
+}
+
+// CancelExpired cancels slates the wallet initiated that were not finalized before they expired,
+// unlocking their inputs and canceling their outputs
+func (t *Wallet) CancelExpired() (ids [][]byte, err error) {
+	slates, err := t.db.ListSlates()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListSlates")
+	}
+
+	now := time.Now()
+
+	for _, slate := range slates {
+		if !slate.Expiry.Expired(now, t.height) {
+			continue
+		}
+
+		id, _ := slate.ID.MarshalText()
+
+		canceled, e := t.cancelSlate(id)
+		if e != nil {
+			return nil, errors.Wrapf(e, "cannot cancelSlate %v", string(id))
+		}
+		if canceled {
+			ids = append(ids, id)
+		}
+	}
+
+	return
+}
+
+// cancelSlate cancels the slate the wallet initiated if it has not been finalized into a transaction.
+// The transaction is recorded as canceled so the slate cannot be finalized later.
+func (t *Wallet) cancelSlate(id []byte) (canceled bool, err error) {
+	_, err = t.db.GetTransaction(id)
+	if err == nil {
+		return false, nil
+	}
+	if errors.Cause(err) != leveldb.ErrNotFound {
+		return false, errors.Wrap(err, "cannot GetTransaction")
+	}
+
+	slate, err := t.db.GetSenderSlate(id)
+	if errors.Cause(err) == leveldb.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "cannot GetSenderSlate")
+	}
+
+	tx := Transaction{
+		Transaction: ledger.Transaction{
+			Transaction: slate.Transaction,
+			ID:          slate.ID,
+		},
+		Account: slate.Account,
+		Status:  TransactionUnconfirmed,
+	}
+	tx.setInitiated(slate)
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	err = t.db.Cancel(id)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot Cancel")
+	}
+
+	err = t.forgetSlateSecrets(id)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot forgetSlateSecrets")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,126 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiry(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	_, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+
+	// slate expires at height 10
+	w.SetTTL(0)
+	w.SetExpiryHeight(10)
+
+	slateBytes, err := w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	info, err := w.Info()
+	assert.NoError(t, err)
+	assert.Contains(t, info, "height 10")
+
+	err = w.SetHeight(9)
+	assert.NoError(t, err)
+	assert.Empty(t, spendableValues(t, w, "cash"))
+
+	// inputs are unlocked and change canceled
+	err = w.SetHeight(10)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{10}, spendableValues(t, w, "cash"))
+
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+	for _, output := range outputs {
+		if output.Value == 7 {
+			assert.Equal(t, OutputStatus(OutputCanceled), output.Status)
+		}
+	}
+
+	// the receiver that knows the height refuses the expired slate
+	err = receiver.SetHeight(10)
+	assert.NoError(t, err)
+	_, err = receiver.Respond(slateBytes)
+	assert.Error(t, err)
+
+	// slate expires in time
+	w.SetExpiryHeight(0)
+	w.SetTTL(time.Second)
+
+	slateBytes, err = w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	responseBytes, err := receiver.Respond(slateBytes)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	_, err = w.Finalize(responseBytes)
+	assert.Error(t, err)
+
+	canceled, err := w.CancelExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(canceled))
+	assert.Equal(t, []uint64{10}, spendableValues(t, w, "cash"))
+
+	// slate not answered is canceled on demand
+	w.SetTTL(DefaultSlateTTL)
+
+	slateBytes, err = w.Send(2, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	canceled, err = w.CancelExpired()
+	assert.NoError(t, err)
+	assert.Empty(t, canceled)
+
+	id, err := ParseIDFromSlate(slateBytes)
+	assert.NoError(t, err)
+
+	err = w.Cancel(id)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{10}, spendableValues(t, w, "cash"))
+
+	// and cannot be finalized after
+	responseBytes, err = receiver.Respond(slateBytes)
+	assert.NoError(t, err)
+
+	_, err = w.Finalize(responseBytes)
+	assert.Error(t, err)
+}
+
+func TestExpiryHeightUnknown(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	_, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+
+	w.SetTTL(0)
+	w.SetExpiryHeight(20)
+
+	slateBytes, err := w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	responseBytes, err := receiver.Respond(slateBytes)
+	assert.NoError(t, err)
+
+	// the sender cannot tell whether the slate has expired
+	_, err = w.Finalize(responseBytes)
+	assert.Error(t, err)
+
+	err = w.SetHeight(19)
+	assert.NoError(t, err)
+	_, err = w.Finalize(responseBytes)
+	assert.NoError(t, err)
+}
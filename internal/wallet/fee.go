@@ -0,0 +1,107 @@
+package wallet
+
+import (
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/pkg/errors"
+)
+
+// DefaultFeeRate is the fee per weight unit of transactions the wallet initiates, networks of this ledger
+// do not require fees so it is zero until set with SetFeeRate
+const DefaultFeeRate = 0
+
+// weights of transaction parts as in Grin: outputs are costly to keep in the ledger, spending inputs removes outputs
+const (
+	inputWeight  = -1
+	outputWeight = 4
+	kernelWeight = 1
+)
+
+// FeePolicy bounds fees of slates the wallet responds to, in units of the asset the fee is paid in
+type FeePolicy struct {
+	// MinFee makes sure transactions paying the wallet are not left unconfirmed
+	MinFee uint64
+	// MaxFee is the most the wallet pays when it pays an invoice, zero is for no limit
+	MaxFee uint64
+}
+
+// TransactionWeight is the weight of a transaction, outputs and kernels add to it, inputs reduce it, but not below 1
+func TransactionWeight(numInputs int, numOutputs int, numKernels int) uint64 {
+	weight := numInputs*inputWeight + numOutputs*outputWeight + numKernels*kernelWeight
+	if weight < 1 {
+		weight = 1
+	}
+	return uint64(weight)
+}
+
+// CalculateFee is the fee of a transaction at the rate per weight unit
+func CalculateFee(rate uint64, numInputs int, numOutputs int, numKernels int) uint64 {
+	return rate * TransactionWeight(numInputs, numOutputs, numKernels)
+}
+
+// kernelFee is the fee in the kernel, committed to in units of the asset it is paid in as values of outputs are,
+// so the ledger balances it against them
+func kernelFee(fee uint64, asset string) uint64 {
+	return ledger.CommitValue(fee, asset)
+}
+
+// assetFee is the kernel fee in units of the asset it is paid in
+func assetFee(kernelFee uint64, asset string) (fee uint64, err error) {
+	unit := ledger.CommitValue(1, asset)
+	if kernelFee%unit != 0 {
+		return 0, errors.Errorf("fee %v is not in units of asset %v", kernelFee, asset)
+	}
+	return kernelFee / unit, nil
+}
+
+// SetFeeRate sets the fee per weight unit of transactions the wallet initiates until it is closed
+func (t *Wallet) SetFeeRate(rate uint64) {
+	t.feeRate = rate
+	t.fixedFee = false
+}
+
+// SetFee sets the fee of transactions the wallet initiates until it is closed, instead of calculating it
+func (t *Wallet) SetFee(fee uint64) {
+	t.fee = fee
+	t.fixedFee = true
+}
+
+// SetFeePolicy sets the fees the wallet accepts in slates it responds to until it is closed
+func (t *Wallet) SetFeePolicy(policy FeePolicy) {
+	t.feePolicy = policy
+}
+
+// feeFunc calculates the fee of a transaction the wallet initiates by the number of inputs and change it selects,
+// counting in outputs the counterparties are expected to add
+func (t *Wallet) feeFunc(otherOutputs int) FeeFunc {
+	if t.fixedFee {
+		return func(numInputs int, change bool) uint64 {
+			return t.fee
+		}
+	}
+
+	return func(numInputs int, change bool) uint64 {
+		numOutputs := otherOutputs
+		if change {
+			numOutputs++
+		}
+		return CalculateFee(t.feeRate, numInputs, numOutputs, 1)
+	}
+}
+
+// invoiceFee is the fee the payer of an invoice is asked to pay, estimated for its one input and change
+func (t *Wallet) invoiceFee() uint64 {
+	return t.feeFunc(1)(1, true)
+}
+
+// checkFeePolicy refuses fees below the minimum, or above the maximum when this wallet pays them
+func (t *Wallet) checkFeePolicy(fee uint64, pay bool) error {
+	if fee < t.feePolicy.MinFee {
+		return errors.Errorf("fee %v is less than minimum %v", fee, t.feePolicy.MinFee)
+	}
+
+	if pay && t.feePolicy.MaxFee > 0 && fee > t.feePolicy.MaxFee {
+		return errors.Errorf("fee %v is more than maximum %v", fee, t.feePolicy.MaxFee)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculateFee(t *testing.T) {
+	// 1 input, 2 outputs, 1 kernel
+	assert.Equal(t, uint64(8), TransactionWeight(1, 2, 1))
+	assert.Equal(t, uint64(16), CalculateFee(2, 1, 2, 1))
+
+	// weight is at least 1
+	assert.Equal(t, uint64(1), TransactionWeight(10, 1, 1))
+	assert.Equal(t, uint64(0), CalculateFee(0, 1, 2, 1))
+}
+
+func TestSendWithFee(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	_, err := w.Issue(20, "cash")
+	assert.NoError(t, err)
+
+	// fee for 1 input, change and the receiver's output is 8
+	w.SetFeeRate(1)
+
+	slateBytes, err := w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	// a receiver asking for more refuses the slate
+	w.SetFeePolicy(FeePolicy{MinFee: 9})
+	_, err = w.Respond(slateBytes)
+	assert.Error(t, err)
+
+	w.SetFeePolicy(FeePolicy{MinFee: 8})
+	responseSlateBytes, err := w.Respond(slateBytes)
+	assert.NoError(t, err)
+
+	txBytes, err := w.Finalize(responseSlateBytes)
+	assert.NoError(t, err)
+
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, core.Uint64(kernelFee(8, "cash")), tx.Body.Kernels[0].Fee)
+
+	err = w.Confirm([]byte(tx.ID.String()))
+	assert.NoError(t, err)
+
+	outputs, err := w.db.ListSpendable(w.account.Number, "cash")
+	assert.NoError(t, err)
+	var values []uint64
+	for _, output := range outputs {
+		values = append(values, output.Value)
+	}
+	assert.ElementsMatch(t, []uint64{3, 9}, values)
+}
+
+func TestInvoiceWithFee(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	_, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+
+	w.SetFee(2)
+
+	slateBytes, err := w.Send(0, "", 5, "cash", SlateVersion4)
+	assert.NoError(t, err)
+
+	// the payer refuses to pay more than it is willing to
+	w.SetFeePolicy(FeePolicy{MaxFee: 1})
+	_, err = w.Respond(slateBytes)
+	assert.Error(t, err)
+
+	w.SetFeePolicy(FeePolicy{MaxFee: 2})
+	responseSlateBytes, err := w.Respond(slateBytes)
+	assert.NoError(t, err)
+
+	txBytes, err := w.Finalize(responseSlateBytes)
+	assert.NoError(t, err)
+
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, core.Uint64(kernelFee(2, "cash")), tx.Body.Kernels[0].Fee)
+
+	// payer's change is what is left after the amount and the fee
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+	var values []uint64
+	for _, output := range outputs {
+		if output.Status == OutputUnconfirmed {
+			values = append(values, output.Value)
+		}
+	}
+	assert.ElementsMatch(t, []uint64{5, 3}, values)
+}
@@ -0,0 +1,218 @@
+package wallet
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+// TransactionDirection tells which way value moved between the wallet and its counterparties
+type TransactionDirection int
+
+const (
+	// DirectionSelf is of transactions of the wallet alone, like consolidating and splitting outputs
+	DirectionSelf = iota
+	DirectionSent
+	DirectionReceived
+	DirectionExchanged
+	DirectionIssued
+)
+
+func (t TransactionDirection) String() string {
+	switch t {
+	case DirectionSelf:
+		return "Self"
+	case DirectionSent:
+		return "Sent"
+	case DirectionReceived:
+		return "Received"
+	case DirectionExchanged:
+		return "Exchanged"
+	case DirectionIssued:
+		return "Issued"
+	default:
+		return fmt.Sprintf("%d", int(t))
+	}
+}
+
+// ParseTransactionStatus finds the status by its name, in any case
+func ParseTransactionStatus(name string) (status TransactionStatus, err error) {
+	for _, status := range []TransactionStatus{TransactionUnconfirmed, TransactionConfirmed, TransactionCanceled} {
+		if strings.EqualFold(name, status.String()) {
+			return status, nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown transaction status %v", name)
+}
+
+// TransactionFilter selects transactions of the history, zero values of its fields select all
+type TransactionFilter struct {
+	// Asset sent or received
+	Asset string
+	// Status, nil for any
+	Status *TransactionStatus
+	// Since and Until bound the time the transaction was created, Until excluded
+	Since time.Time
+	Until time.Time
+}
+
+func (t TransactionFilter) matches(tx Transaction) bool {
+	if len(t.Asset) > 0 && (tx.Asset != t.Asset || tx.Amount == 0) && (tx.ReceiveAsset != t.Asset || tx.ReceiveAmount == 0) {
+		return false
+	}
+
+	if t.Status != nil && tx.Status != *t.Status {
+		return false
+	}
+
+	created := time.Unix(tx.Created, 0)
+	if !t.Since.IsZero() && created.Before(t.Since) {
+		return false
+	}
+	if !t.Until.IsZero() && !created.Before(t.Until) {
+		return false
+	}
+
+	return true
+}
+
+// setAmounts fills in what the wallet sends, receives and the fee of the transaction
+func (t *Transaction) setAmounts(amount uint64, asset string, receiveAmount uint64, receiveAsset string, fee uint64, feeAsset string) {
+	t.Amount = amount
+	t.Asset = asset
+	t.ReceiveAmount = receiveAmount
+	t.ReceiveAsset = receiveAsset
+	t.Fee = fee
+	t.FeeAsset = feeAsset
+
+	switch {
+	case amount > 0 && receiveAmount > 0:
+		t.Direction = DirectionExchanged
+	case amount > 0:
+		t.Direction = DirectionSent
+	case receiveAmount > 0:
+		t.Direction = DirectionReceived
+	default:
+		t.Direction = DirectionSelf
+	}
+}
+
+// setInitiated fills in the history of the transaction from the slate the wallet initiated
+func (t *Transaction) setInitiated(slate *SavedSlate) {
+	// the sender pays the fee, the payer of an invoice pays it in the asset invoiced
+	feeAsset := slate.Asset
+	if slate.Amount == 0 {
+		feeAsset = slate.ReceiveAsset
+	}
+	fee, err := assetFee(uint64(slate.Fee), feeAsset)
+	if err != nil {
+		fee = 0
+	}
+
+	t.setAmounts(uint64(slate.Amount), slate.Asset, uint64(slate.ReceiveAmount), slate.ReceiveAsset, fee, feeAsset)
+
+	t.Created = slate.Created
+
+	if t.PaymentProof != nil {
+		t.Counterparty = t.PaymentProof.ReceiverAddress
+	}
+}
+
+// putTransaction saves the transaction, noting when it was created unless it was already
+func (t *Wallet) putTransaction(tx Transaction) error {
+	if tx.Created == 0 {
+		tx.Created = time.Now().Unix()
+	}
+
+	return t.db.PutTransaction(tx)
+}
+
+// Transactions lists transactions of the current account selected by the filter, the latest first
+func (t *Wallet) Transactions(filter TransactionFilter) (transactions []Transaction, err error) {
+	all, err := t.db.ListTransactions()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListTransactions")
+	}
+
+	transactions = make([]Transaction, 0)
+	for _, tx := range all {
+		if tx.Account == t.account.Number && filter.matches(tx) {
+			transactions = append(transactions, tx)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Created > transactions[j].Created
+	})
+
+	return
+}
+
+// History lists transactions of the current account selected by the filter with what was sent and received, when and notes
+func (t *Wallet) History(filter TransactionFilter) (string, error) {
+	transactions, err := t.Transactions(filter)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get Transactions")
+	}
+
+	tableString := &strings.Builder{}
+
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"id", "created", "direction", "sent", "received", "fee", "status", "confirmed", "counterparty", "note"})
+	table.SetCaption(true, "Transactions of account "+t.account.Name)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	for _, tx := range transactions {
+		table.Append([]string{
+			tx.ID.String(),
+			formatTime(tx.Created),
+			tx.Direction.String(),
+			formatAmount(tx.Amount, tx.Asset),
+			formatAmount(tx.ReceiveAmount, tx.ReceiveAsset),
+			formatAmount(tx.Fee, tx.FeeAsset),
+			tx.Status.String(),
+			formatTime(tx.Confirmed),
+			tx.Counterparty,
+			tx.Note,
+		})
+	}
+	table.Render()
+
+	return tableString.String(), nil
+}
+
+// SetNote attaches a free text note to the transaction
+func (t *Wallet) SetNote(transactionID []byte, note string) error {
+	tx, err := t.db.GetTransaction(transactionID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetTransaction")
+	}
+
+	tx.Note = note
+
+	err = t.db.PutTransaction(tx)
+	if err != nil {
+		return errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	return nil
+}
+
+func formatTime(unix int64) string {
+	if unix == 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).Format("2006-01-02 15:04:05")
+}
+
+func formatAmount(amount uint64, asset string) string {
+	if amount == 0 {
+		return ""
+	}
+	return strconv.FormatUint(amount, 10) + " " + asset
+}
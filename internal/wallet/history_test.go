@@ -0,0 +1,101 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	_, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+	_, err = w.Issue(5, "apple")
+	assert.NoError(t, err)
+
+	w.SetFee(1)
+
+	slateBytes, err := w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+	responseBytes, err := receiver.Respond(slateBytes)
+	assert.NoError(t, err)
+	txBytes, err := w.Finalize(responseBytes)
+	assert.NoError(t, err)
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	id := []byte(tx.ID.String())
+
+	senderAddress, err := w.Address()
+	assert.NoError(t, err)
+	receiverAddress, err := receiver.Address()
+	assert.NoError(t, err)
+
+	transactions, err := w.Transactions(TransactionFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(transactions))
+
+	sent := transactions[0]
+	for _, transaction := range transactions {
+		if transaction.ID == tx.ID {
+			sent = transaction
+		}
+	}
+	assert.Equal(t, TransactionDirection(DirectionSent), sent.Direction)
+	assert.Equal(t, uint64(3), sent.Amount)
+	assert.Equal(t, "cash", sent.Asset)
+	assert.Equal(t, uint64(1), sent.Fee)
+	assert.Equal(t, receiverAddress, sent.Counterparty)
+	assert.NotZero(t, sent.Created)
+	assert.Zero(t, sent.Confirmed)
+
+	received, err := receiver.Transactions(TransactionFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, TransactionDirection(DirectionReceived), received[0].Direction)
+	assert.Equal(t, uint64(3), received[0].ReceiveAmount)
+	assert.Equal(t, senderAddress, received[0].Counterparty)
+
+	err = w.Confirm(id)
+	assert.NoError(t, err)
+
+	// filters
+	apples, err := w.Transactions(TransactionFilter{Asset: "apple"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(apples))
+	assert.Equal(t, TransactionDirection(DirectionIssued), apples[0].Direction)
+
+	status, err := ParseTransactionStatus("confirmed")
+	assert.NoError(t, err)
+	confirmed, err := w.Transactions(TransactionFilter{Asset: "cash", Status: &status})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(confirmed))
+	for _, transaction := range confirmed {
+		assert.NotZero(t, transaction.Confirmed)
+	}
+
+	later, err := w.Transactions(TransactionFilter{Since: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Empty(t, later)
+
+	earlier, err := w.Transactions(TransactionFilter{Until: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Empty(t, earlier)
+
+	err = w.SetNote(id, "rent for may")
+	assert.NoError(t, err)
+
+	history, err := w.History(TransactionFilter{})
+	assert.NoError(t, err)
+	assert.Contains(t, history, "rent for may")
+	assert.Contains(t, history, "Issued")
+
+	_, err = ParseTransactionStatus("pending")
+	assert.Error(t, err)
+}
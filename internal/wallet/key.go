@@ -1,19 +1,59 @@
 package wallet
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
 	"github.com/olegabu/go-secp256k1-zkp"
 	"github.com/tyler-smith/go-bip32"
 	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 
 	"github.com/pkg/errors"
 )
 
-const mnemonicPassword = ""
 const masterKeyFilename = "master.key"
-const entropyBitSize = 128
+
+// DefaultMnemonicWords is how many words a new mnemonic has unless asked for more
+const DefaultMnemonicWords = 12
+
+// entropyBitSize is how much entropy a mnemonic of this many words encodes, each word is 11 bits
+// of entropy and checksum, checksum takes a bit per 32 bits of entropy
+func entropyBitSize(words int) (bitSize int, err error) {
+	switch words {
+	case 12, 15, 18, 21, 24:
+		return words * 11 * 32 / 33, nil
+	default:
+		return 0, errors.Errorf("mnemonic can have 12, 15, 18, 21 or 24 words, not %d", words)
+	}
+}
+
+// hardened child key index reserved for the wallet address, never used for outputs
+const addressKeyIndex = bip32.FirstHardenedChild
+
+// hardened child key index reserved for the x25519 key slatepacks are encrypted to
+const slatepackKeyIndex = bip32.FirstHardenedChild + 1
+
+// hardened child key index reserved for the key bulletproof rewind nonces are derived from
+const rewindKeyIndex = bip32.FirstHardenedChild + 2
+
+// hardened child key index of the key accounts are derived from, see outputSecret
+const accountsKeyIndex = bip32.FirstHardenedChild + 3
+
+// branch of an account's key output keys are derived from, other branches are reserved
+const outputBranch = 0
+
+// hardened child key index reserved for the key wallet database values are encrypted with
+const databaseKeyIndex = bip32.FirstHardenedChild + 4
+
+// compressed public key J of switch commitments, the same nothing-up-my-sleeve point Grin uses
+const switchPublicKey = "02b860f56795fc03f3c21685383d1b5a2f2954f49b7e398b8d2a0193933621155f"
 
 func (t *Wallet) nonce() (rnd32 [32]byte, err error) {
 	seed32 := secp256k1.Random256()
@@ -25,42 +65,193 @@ func (t *Wallet) masterKeyPath() string {
 	return filepath.Join(t.persistDir, masterKeyFilename)
 }
 
-func (t *Wallet) putMasterKey(masterKey *bip32.Key) error {
+// encryptedMasterKey is the content of the master key file: serialized master key sealed with chacha20poly1305
+// under a key derived from the password with scrypt
+type encryptedMasterKey struct {
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// scrypt cost parameters of the key the master key is encrypted with
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+func passwordKey(password string, salt []byte) (key []byte, err error) {
+	key, err = scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot derive scrypt Key")
+	}
+
+	return
+}
+
+func (t *Wallet) putMasterKey(masterKey *bip32.Key, password string) error {
 	masterKeyBytes, err := masterKey.Serialize()
 	if err != nil {
 		return errors.Wrap(err, "cannot Serialize masterKey")
 	}
 
-	err = ioutil.WriteFile(t.masterKeyPath(), masterKeyBytes, 0600)
+	salt := make([]byte, 16)
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	for _, b := range [][]byte{salt, nonce} {
+		_, err = rand.Read(b)
+		if err != nil {
+			return errors.Wrap(err, "cannot read random bytes")
+		}
+	}
+
+	key, err := passwordKey(password, salt)
+	if err != nil {
+		return errors.Wrap(err, "cannot get passwordKey")
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return errors.Wrap(err, "cannot create chacha20poly1305 cipher")
+	}
+
+	encrypted := encryptedMasterKey{
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, masterKeyBytes, nil)),
+	}
+
+	encryptedBytes, err := json.Marshal(encrypted)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal encryptedMasterKey")
+	}
+
+	err = writeFileAtomic(t.masterKeyPath(), encryptedBytes, 0600)
+	if err != nil {
+		return errors.Wrap(err, "cannot writeFileAtomic with masterKey")
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to the file and renames it over the file once it is synced,
+// so a failed write leaves the old file in place
+func writeFileAtomic(fileName string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(fileName)
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "cannot create temporary file")
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot write temporary file")
+	}
+
+	err = os.Rename(tmp.Name(), fileName)
+	if err != nil {
+		return errors.Wrap(err, "cannot rename temporary file")
+	}
+
+	// sync the directory for the rename to survive a crash
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "cannot open directory")
+	}
+	defer d.Close()
+	err = d.Sync()
 	if err != nil {
-		return errors.Wrap(err, "cannot WriteFile with masterKey")
+		return errors.Wrap(err, "cannot sync directory")
 	}
 
 	return nil
 }
 
-func (t *Wallet) masterKeyFromFile() (masterKey *bip32.Key, err error) {
-	masterKeyBytes, err := ioutil.ReadFile(t.masterKeyPath())
+// masterKeyFromFile decrypts the master key with the password.
+// Keys written before they were encrypted are read as they are and encrypted with the password on first open
+func (t *Wallet) masterKeyFromFile(password string) (masterKey *bip32.Key, err error) {
+	fileBytes, err := ioutil.ReadFile(t.masterKeyPath())
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot ReadFile with masterKey")
 	}
 
+	var encrypted encryptedMasterKey
+	masterKeyBytes := fileBytes
+
+	isEncrypted := json.Unmarshal(fileBytes, &encrypted) == nil
+	if isEncrypted {
+		salt, err := hex.DecodeString(encrypted.Salt)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode salt from hex")
+		}
+		nonce, err := hex.DecodeString(encrypted.Nonce)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode nonce from hex")
+		}
+		ciphertext, err := hex.DecodeString(encrypted.Ciphertext)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode ciphertext from hex")
+		}
+
+		key, err := passwordKey(password, salt)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get passwordKey")
+		}
+
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create chacha20poly1305 cipher")
+		}
+
+		masterKeyBytes, err = aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return nil, errors.New("cannot decrypt master key, wrong password")
+		}
+	}
+
 	masterKey, err = bip32.Deserialize(masterKeyBytes)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot Deserialize masterKey")
 	}
 
+	if !isEncrypted {
+		err = t.putMasterKey(masterKey, password)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot putMasterKey to encrypt it")
+		}
+	}
+
 	return
 }
 
-func (t *Wallet) newMasterKey() (mnemonic string, err error) {
+func (t *Wallet) newMasterKey(passphrase string, words int, password string) (mnemonic string, err error) {
 	//seed, err := bip32.NewSeed()
 	//if err != nil {
 	//	return nil, errors.Wrap(err, "cannot get NewSeed from bip32")
 	//}
 
 	// Generate a mnemonic for memorization or user-friendly seeds
-	entropy, err := bip39.NewEntropy(entropyBitSize)
+	bitSize, err := entropyBitSize(words)
+	if err != nil {
+		err = errors.Wrap(err, "cannot get entropyBitSize")
+		return
+	}
+
+	entropy, err := bip39.NewEntropy(bitSize)
 	if err != nil {
 		err = errors.Wrap(err, "cannot get NewEntropy from bip39")
 		return
@@ -72,7 +263,7 @@ func (t *Wallet) newMasterKey() (mnemonic string, err error) {
 		return
 	}
 
-	err = t.masterKeyFromMnemonic(mnemonic)
+	err = t.masterKeyFromMnemonic(mnemonic, passphrase, password)
 	if err != nil {
 		err = errors.Wrap(err, "cannot create masterKeyFromMnemonic")
 	}
@@ -80,8 +271,14 @@ func (t *Wallet) newMasterKey() (mnemonic string, err error) {
 	return
 }
 
-func (t *Wallet) masterKeyFromMnemonic(mnemonic string) (err error) {
-	seed := bip39.NewSeed(mnemonic, mnemonicPassword)
+// masterKeyFromMnemonic creates the master key from the seed of the mnemonic and the BIP39 passphrase,
+// another passphrase makes another key from the same mnemonic
+func (t *Wallet) masterKeyFromMnemonic(mnemonic string, passphrase string, password string) (err error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return errors.New("mnemonic is not valid")
+	}
+
+	seed := bip39.NewSeed(mnemonic, passphrase)
 
 	masterKey, err := bip32.NewMasterKey(seed)
 	if err != nil {
@@ -89,7 +286,7 @@ func (t *Wallet) masterKeyFromMnemonic(mnemonic string) (err error) {
 		return
 	}
 
-	err = t.putMasterKey(masterKey)
+	err = t.putMasterKey(masterKey, password)
 	if err != nil {
 		err = errors.Wrap(err, "cannot putMasterKey")
 		return
@@ -100,16 +297,14 @@ func (t *Wallet) masterKeyFromMnemonic(mnemonic string) (err error) {
 	return
 }
 
-func (t *Wallet) masterKeyExists() (ret bool) {
-	_, err := t.masterKeyFromFile()
-	if err != nil {
-		return false
-	}
-	return true
+// MasterKeyExists tells if the wallet was initialized
+func (t *Wallet) MasterKeyExists() (ret bool) {
+	_, err := os.Stat(t.masterKeyPath())
+	return err == nil
 }
 
-func (t *Wallet) readMasterKey() (err error) {
-	masterKey, err := t.masterKeyFromFile()
+func (t *Wallet) readMasterKey(password string) (err error) {
+	masterKey, err := t.masterKeyFromFile(password)
 	if err != nil {
 		return errors.Wrap(err, "cannot masterKeyFromFile")
 	}
@@ -119,15 +314,15 @@ func (t *Wallet) readMasterKey() (err error) {
 	return
 }
 
-func (t *Wallet) newMasterKeyIfDoesntExist() (err error) {
-	if !t.masterKeyExists() {
-		mnemonic, err := t.newMasterKey()
+func (t *Wallet) newMasterKeyIfDoesntExist(password string) (err error) {
+	if !t.MasterKeyExists() {
+		mnemonic, err := t.newMasterKey("", DefaultMnemonicWords, password)
 		if err != nil {
 			return errors.Wrap(err, "cannot newMasterKey")
 		}
 		fmt.Println("created new master secret key with mnemonic: ", mnemonic)
 	} else {
-		err := t.readMasterKey()
+		err := t.readMasterKey(password)
 		if err != nil {
 			return errors.Wrap(err, "cannot readMasterKey")
 		}
@@ -136,13 +331,23 @@ func (t *Wallet) newMasterKeyIfDoesntExist() (err error) {
 	return
 }
 
-func (t *Wallet) InitMasterKey(mnemonic string) (createdMnemonic string, err error) {
-	if t.masterKeyExists() {
+// InitMasterKey reads the master key encrypted with the password, or creates and encrypts it.
+// The key is created from the given mnemonic or a new one of this many words, and the BIP39 passphrase
+func (t *Wallet) InitMasterKey(
+	mnemonic string,
+	passphrase string,
+	words int,
+	password string,
+) (
+	createdMnemonic string,
+	err error,
+) {
+	if t.MasterKeyExists() {
 		if len(mnemonic) > 0 {
 			err = errors.New("don't want to overwrite existing key by one created from your mnemonic, remove existing first")
 			return
 		} else {
-			err = t.readMasterKey()
+			err = t.readMasterKey(password)
 			if err != nil {
 				err = errors.Wrap(err, "cannot read master key")
 				return
@@ -150,13 +355,13 @@ func (t *Wallet) InitMasterKey(mnemonic string) (createdMnemonic string, err err
 		}
 	} else {
 		if len(mnemonic) == 0 {
-			createdMnemonic, err = t.newMasterKey()
+			createdMnemonic, err = t.newMasterKey(passphrase, words, password)
 			if err != nil {
 				err = errors.Wrap(err, "cannot create master key")
 				return
 			}
 		} else {
-			err = t.masterKeyFromMnemonic(mnemonic)
+			err = t.masterKeyFromMnemonic(mnemonic, passphrase, password)
 			if err != nil {
 				err = errors.Wrap(err, "cannot create master key from mnemonic")
 				return
@@ -164,23 +369,102 @@ func (t *Wallet) InitMasterKey(mnemonic string) (createdMnemonic string, err err
 		}
 	}
 
+	err = t.unlock()
+	if err != nil {
+		err = errors.Wrap(err, "cannot unlock")
+		return
+	}
+
+	return
+}
+
+// unlock lets the database decrypt its values with the key derived from the master key, migrates values written
+// by an earlier version and loads the current account
+func (t *Wallet) unlock() (err error) {
+	databaseKey, err := t.secret(databaseKeyIndex)
+	if err != nil {
+		return errors.Wrap(err, "cannot get database secret")
+	}
+
+	err = t.db.Unlock(databaseKey[:])
+	if err != nil {
+		return errors.Wrap(err, "cannot Unlock database")
+	}
+
+	err = t.db.Migrate()
+	if err != nil {
+		return errors.Wrap(err, "cannot Migrate database")
+	}
+
+	err = t.loadAccount()
+	if err != nil {
+		return errors.Wrap(err, "cannot loadAccount")
+	}
+
+	err = t.loadSelection()
+	if err != nil {
+		return errors.Wrap(err, "cannot loadSelection")
+	}
+
+	_, err = t.CancelExpired()
+	if err != nil {
+		return errors.Wrap(err, "cannot CancelExpired")
+	}
+
 	return
 }
 
+// ChangePassword encrypts the master key with the new password
+func (t *Wallet) ChangePassword(password string) error {
+	err := t.putMasterKey(t.masterKey, password)
+	if err != nil {
+		return errors.Wrap(err, "cannot putMasterKey")
+	}
+
+	return nil
+}
+
+// newSecret derives the key at the next index of the current account
 func (t *Wallet) newSecret() (secret [32]byte, index uint32, err error) {
-	index, err = t.db.NextIndex()
+	index, err = t.db.NextIndex(t.account.Number)
 	if err != nil {
 		return [32]byte{}, 0, errors.Wrap(err, "cannot get NextIndex from db")
 	}
 
-	secret, err = t.secret(index)
+	secret, err = t.outputSecret(t.account.Number, index)
 	if err != nil {
-		return [32]byte{}, 0, errors.Wrap(err, "cannot get secretFromIndex")
+		return [32]byte{}, 0, errors.Wrap(err, "cannot get outputSecret")
 	}
 
 	return
 }
 
+// outputSecret derives the key of an output at path m / 3' / account' / 0 / index.
+// Account keys are hardened so that a leaked output key and account public key do not reveal other accounts
+func (t *Wallet) outputSecret(account uint32, index uint32) (secret [32]byte, err error) {
+	key := t.masterKey
+	for _, childIndex := range []uint32{accountsKeyIndex, bip32.FirstHardenedChild + account, outputBranch, index} {
+		key, err = key.NewChildKey(childIndex)
+		if err != nil {
+			return [32]byte{}, errors.Wrapf(err, "cannot get NewChildKey %d", childIndex)
+		}
+	}
+
+	copy(secret[:], key.Key[:32])
+
+	return
+}
+
+// outputKey derives the key of the wallet's output at its path, outputs made before accounts are at m / index
+func (t *Wallet) outputKey(output Output) (secret [32]byte, err error) {
+	if !output.AccountPath {
+		return t.secret(output.Index)
+	}
+
+	return t.outputSecret(output.Account, output.Index)
+}
+
+// secret derives a child of the master key, keys reserved for the wallet are at hardened indexes
 func (t *Wallet) secret(index uint32) (secret [32]byte, err error) {
 	childKey, err := t.masterKey.NewChildKey(index)
 	if err != nil {
@@ -205,3 +489,49 @@ func (t *Wallet) secret(index uint32) (secret [32]byte, err error) {
 
 	return secret, nil
 }
+
+// outputBlind is the blinding factor of the wallet's output: the switch commitment blind derived from the key
+// at its index and its value, or the key itself for outputs made before switch commitments
+func (t *Wallet) outputBlind(output Output) (blind [32]byte, err error) {
+	secret, err := t.outputKey(output)
+	if err != nil {
+		return [32]byte{}, errors.Wrap(err, "cannot get outputKey")
+	}
+
+	if !output.SwitchCommit {
+		return secret, nil
+	}
+
+	return t.switchBlind(secret, ledger.CommitValue(output.Value, output.Asset))
+}
+
+// switchBlind turns a child key x into the blind of a switch commitment x'G+vH where x' = x + hash(xG+vH | xJ),
+// so that the commitment can be switched to an ElGamal one binding the value should discrete log be broken
+func (t *Wallet) switchBlind(secret [32]byte, commitValue uint64) (blind [32]byte, err error) {
+	switchKeyBytes, err := hex.DecodeString(switchPublicKey)
+	if err != nil {
+		return [32]byte{}, errors.Wrap(err, "cannot decode switch public key from hex")
+	}
+
+	_, switchKey, err := secp256k1.EcPubkeyParse(t.context, switchKeyBytes)
+	if err != nil {
+		return [32]byte{}, errors.Wrap(err, "cannot parse switch public key")
+	}
+
+	blind, err = secp256k1.BlindSwitch(
+		t.context,
+		secret[:],
+		commitValue,
+		&secp256k1.GeneratorH,
+		&secp256k1.GeneratorG,
+		switchKey)
+	if err != nil {
+		return [32]byte{}, errors.Wrap(err, "cannot BlindSwitch")
+	}
+
+	return
+}
+
+func (t *Wallet) addressSecret() (secret [32]byte, err error) {
+	return t.secret(addressKeyIndex)
+}
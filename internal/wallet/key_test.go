@@ -1,13 +1,22 @@
 package wallet
 
 import (
+	"encoding/hex"
 	"fmt"
+	"github.com/blockcypher/libgrin/core"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/olegabu/go-secp256k1-zkp"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
 const testMnemonic = "dish salon sea unlock asthma rigid grass gather action dignity quiz vacuum"
+const testPassword = "correct horse battery staple"
 const testMasterKey = "xprv9s21ZrQH143K24mEfYXCoeYDgPT5y18UJvNUc9JZZU37fRsS9znJF78KS2epJAzEbz6aRNH4fb2ptkf1AzDuBxivRx6LH9VQymyVRvw94hv"
 
 func TestInitMasterKeyWhenDoesntExist(t *testing.T) {
@@ -20,7 +29,7 @@ func TestInitMasterKeyWhenDoesntExist(t *testing.T) {
 	assert.NoError(t, err)
 	defer w.Close()
 
-	createdMnemonic, err := w.InitMasterKey("")
+	createdMnemonic, err := w.InitMasterKey("", "", DefaultMnemonicWords, "")
 	assert.NoError(t, err)
 	assert.NotNil(t, w.masterKey)
 	assert.NotEmpty(t, createdMnemonic)
@@ -33,11 +42,11 @@ func TestInitMasterKeyWhenExists(t *testing.T) {
 
 	dir := testDbDir()
 
-	w, err := NewWallet(dir)
+	w, err := NewWallet(dir, "")
 	assert.NoError(t, err)
 	defer w.Close()
 
-	createdMnemonic, err := w.InitMasterKey("")
+	createdMnemonic, err := w.InitMasterKey("", "", DefaultMnemonicWords, "")
 	assert.NoError(t, err)
 	assert.NotNil(t, w.masterKey)
 	assert.Empty(t, createdMnemonic)
@@ -48,11 +57,11 @@ func TestInitMasterKeyWithMnemonicWhenExists(t *testing.T) {
 
 	dir := testDbDir()
 
-	w, err := NewWallet(dir)
+	w, err := NewWallet(dir, "")
 	assert.NoError(t, err)
 	defer w.Close()
 
-	_, err = w.InitMasterKey(testMnemonic)
+	_, err = w.InitMasterKey(testMnemonic, "", DefaultMnemonicWords, "")
 	assert.Error(t, err)
 
 	fmt.Printf("err %v\n", err)
@@ -68,7 +77,7 @@ func TestInitMasterKeyWithMnemonicWhenDoesntExist(t *testing.T) {
 	assert.NoError(t, err)
 	defer w.Close()
 
-	createdMnemonic, err := w.InitMasterKey(testMnemonic)
+	createdMnemonic, err := w.InitMasterKey(testMnemonic, "", DefaultMnemonicWords, "")
 	assert.NoError(t, err)
 	assert.NotNil(t, w.masterKey)
 	assert.Empty(t, createdMnemonic)
@@ -86,7 +95,7 @@ func TestMasterKeyFromMnemonic(t *testing.T) {
 	assert.NoError(t, err)
 	defer w.Close()
 
-	err = w.masterKeyFromMnemonic(testMnemonic)
+	err = w.masterKeyFromMnemonic(testMnemonic, "", "")
 	assert.NoError(t, err)
 	assert.NotNil(t, w.masterKey)
 
@@ -103,18 +112,96 @@ func TestCreateAndGetMasterKey(t *testing.T) {
 	assert.NoError(t, err)
 	defer w.Close()
 
-	mnemonic, err := w.newMasterKey()
+	mnemonic, err := w.newMasterKey("", DefaultMnemonicWords, testPassword)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, mnemonic)
 	assert.NotNil(t, w.masterKey)
 
 	fmt.Printf("created masterKey\t%s\n", w.masterKey.String())
 
-	masterKey, err := w.masterKeyFromFile()
+	masterKey, err := w.masterKeyFromFile(testPassword)
 	assert.NoError(t, err)
 	assert.NotNil(t, masterKey)
+	assert.Equal(t, w.masterKey.String(), masterKey.String())
 
 	fmt.Printf("got masterKey\t\t%s\n", masterKey.String())
+
+	// the file does not reveal the key and cannot be decrypted with another password
+	fileBytes, err := ioutil.ReadFile(w.masterKeyPath())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(fileBytes), masterKey.String())
+
+	_, err = w.masterKeyFromFile("wrong")
+	assert.Error(t, err)
+}
+
+func TestChangePassword(t *testing.T) {
+	dir := testDbDir()
+
+	err := os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	w, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	_, err = w.InitMasterKey(testMnemonic, "", DefaultMnemonicWords, testPassword)
+	assert.NoError(t, err)
+
+	err = w.ChangePassword("new " + testPassword)
+	assert.NoError(t, err)
+	w.Close()
+
+	// the key is replaced by renaming a temporary file over it
+	tmpFiles, err := filepath.Glob(filepath.Join(dir, masterKeyFilename+".tmp*"))
+	assert.NoError(t, err)
+	assert.Empty(t, tmpFiles)
+	info, err := os.Stat(filepath.Join(dir, masterKeyFilename))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = NewWallet(dir, testPassword)
+	assert.Error(t, err)
+
+	w, err = NewWallet(dir, "new "+testPassword)
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, testMasterKey, w.masterKey.String())
+}
+
+func TestPlaintextMasterKey(t *testing.T) {
+	dir := testDbDir()
+
+	err := os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	w, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	_, err = w.InitMasterKey(testMnemonic, "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+	masterKeyBytes, err := w.masterKey.Serialize()
+	assert.NoError(t, err)
+	w.Close()
+
+	// key written before master keys were encrypted
+	err = ioutil.WriteFile(filepath.Join(dir, masterKeyFilename), masterKeyBytes, 0600)
+	assert.NoError(t, err)
+
+	// is encrypted with the password it is first opened with
+	w, err = NewWallet(dir, testPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, testMasterKey, w.masterKey.String())
+	w.Close()
+
+	fileBytes, err := ioutil.ReadFile(filepath.Join(dir, masterKeyFilename))
+	assert.NoError(t, err)
+	assert.NotEqual(t, masterKeyBytes, fileBytes)
+
+	_, err = NewWallet(dir, "another "+testPassword)
+	assert.Error(t, err)
+
+	w, err = NewWallet(dir, testPassword)
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, testMasterKey, w.masterKey.String())
 }
 
 func TestSecretFromHDWallet(t *testing.T) {
@@ -127,7 +214,7 @@ func TestSecretFromHDWallet(t *testing.T) {
 	assert.NoError(t, err)
 	defer w.Close()
 
-	_, err = w.InitMasterKey("")
+	_, err = w.InitMasterKey("", "", DefaultMnemonicWords, "")
 	assert.NoError(t, err)
 
 	secrets := map[uint32][32]byte{}
@@ -142,7 +229,7 @@ func TestSecretFromHDWallet(t *testing.T) {
 	fmt.Printf("created secrets %v\n", secrets)
 
 	for i := uint32(0); i < 3; i++ {
-		secret, err := w.secret(i)
+		secret, err := w.outputSecret(0, i)
 		assert.NoError(t, err)
 		fmt.Printf("got i %d secret %v\n", i, secret)
 
@@ -166,3 +253,159 @@ func TestNonce(t *testing.T) {
 
 	fmt.Printf("nonce %v\n", nonceBytes)
 }
+
+func TestSwitchCommitment(t *testing.T) {
+	dir := testDbDir()
+
+	err := os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	w, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer w.Close()
+	_, err = w.InitMasterKey("", "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	_, err = w.Issue(3, "cash")
+	assert.NoError(t, err)
+
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(outputs))
+	output := outputs[0]
+
+	commitValue := ledger.CommitValue(output.Value, output.Asset)
+
+	// the same commitment is recreated from key index and value
+	assert.True(t, output.SwitchCommit)
+	assert.True(t, output.AccountPath)
+	blind, err := w.outputBlind(output)
+	assert.NoError(t, err)
+	commitment, err := secp256k1.Commit(w.context, blind[:], commitValue, &secp256k1.GeneratorH, &secp256k1.GeneratorG)
+	assert.NoError(t, err)
+	assert.Equal(t, output.Commit, commitment.String())
+
+	// the child key alone is not the blind
+	secret, err := w.outputSecret(output.Account, output.Index)
+	assert.NoError(t, err)
+	assert.NotEqual(t, secret, blind)
+	commitment, err = secp256k1.Commit(w.context, secret[:], commitValue, &secp256k1.GeneratorH, &secp256k1.GeneratorG)
+	assert.NoError(t, err)
+	assert.NotEqual(t, output.Commit, commitment.String())
+
+	// and depends on the value
+	output.Value++
+	other, err := w.outputBlind(output)
+	assert.NoError(t, err)
+	assert.NotEqual(t, blind, other)
+}
+
+// newLegacyOutput saves a confirmed output the way outputs were made before accounts and switch commitments:
+// its key is at m / index and blinds it
+func newLegacyOutput(t *testing.T, w *Wallet, value uint64, asset string) Output {
+	index, err := w.db.NextIndex(w.account.Number)
+	assert.NoError(t, err)
+	secret, err := w.secret(index)
+	assert.NoError(t, err)
+
+	commitValue := ledger.CommitValue(value, asset)
+	commitment, err := secp256k1.Commit(w.context, secret[:], commitValue, &secp256k1.GeneratorH, &secp256k1.GeneratorG)
+	assert.NoError(t, err)
+
+	rewindNonce, err := w.rewindNonce(commitment)
+	assert.NoError(t, err)
+	privateNonce := blake2b.Sum256(secret[:])
+	message := proofMessage(w.account.Number, index, asset)
+	proof, err := secp256k1.BulletproofRangeproofProveSingle(w.context, nil, nil, commitValue, secret[:], rewindNonce[:], privateNonce[:], nil, message[:])
+	assert.NoError(t, err)
+
+	output := Output{
+		Output: core.Output{
+			Features: core.PlainOutput,
+			Commit:   commitment.String(),
+			Proof:    hex.EncodeToString(proof),
+		},
+		Account: w.account.Number,
+		Index:   index,
+		Value:   value,
+		Asset:   asset,
+		Status:  OutputConfirmed,
+	}
+	err = w.db.PutOutput(output)
+	assert.NoError(t, err)
+
+	return output
+}
+
+func TestLegacyOutput(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	output := newLegacyOutput(t, w, 10, "cash")
+
+	// the output is recognized as blinded with its key at the legacy path
+	rewound, err := w.Rewind(output.Output, []string{"cash"})
+	assert.NoError(t, err)
+	assert.False(t, rewound.SwitchCommit)
+	assert.False(t, rewound.AccountPath)
+
+	// and spent with that key as the blind
+	txBytes, err := w.Split(4, 2, "cash")
+	assert.NoError(t, err)
+	_, err = ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+}
+
+func TestMnemonicWords(t *testing.T) {
+	for _, words := range []int{12, 15, 18, 21, 24} {
+		dir := testDbDir()
+		err := os.RemoveAll(dir)
+		assert.NoError(t, err)
+
+		w, err := NewWalletWithoutMasterKey(dir)
+		assert.NoError(t, err)
+
+		mnemonic, err := w.InitMasterKey("", "", words, "")
+		assert.NoError(t, err)
+		assert.Equal(t, words, len(strings.Fields(mnemonic)))
+
+		w.Close()
+	}
+
+	dir := testDbDir()
+	err := os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	w, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	_, err = w.InitMasterKey("", "", 13, "")
+	assert.Error(t, err)
+}
+
+func TestMnemonicPassphrase(t *testing.T) {
+	masterKey := func(mnemonic string, passphrase string) string {
+		dir := testDbDir()
+		err := os.RemoveAll(dir)
+		assert.NoError(t, err)
+
+		w, err := NewWalletWithoutMasterKey(dir)
+		assert.NoError(t, err)
+		defer w.Close()
+
+		_, err = w.InitMasterKey(mnemonic, passphrase, DefaultMnemonicWords, "")
+		assert.NoError(t, err)
+
+		return w.masterKey.String()
+	}
+
+	assert.Equal(t, testMasterKey, masterKey(testMnemonic, ""))
+
+	withPassphrase := masterKey(testMnemonic, "25th word")
+	assert.NotEqual(t, testMasterKey, withPassphrase)
+	assert.NotEqual(t, withPassphrase, masterKey(testMnemonic, "26th word"))
+
+	// recovery with the same passphrase gets the same key
+	assert.Equal(t, withPassphrase, masterKey(testMnemonic, "25th word"))
+}
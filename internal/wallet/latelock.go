@@ -0,0 +1,101 @@
+package wallet
+
+import (
+	"encoding/hex"
+
+	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/pkg/errors"
+)
+
+// Late locking leaves inputs out of the slate the sender starts, its participant data is of a random blind excess.
+// The sender picks inputs and change when it finalizes and the kernel offset makes up the difference between their
+// blind excess and the one the kernel is signed with, so outputs stay spendable during the round trip
+// and several outstanding slates can be paid from the same outputs. Late locked slates carry no payment proof.
+
+// SetLateLock makes the wallet pick inputs of slates it sends when it finalizes them, until it is closed
+func (t *Wallet) SetLateLock(lateLock bool) {
+	t.lateLock = lateLock
+}
+
+// sendLate starts a slate without inputs, with the fee for inputs the wallet would pick now
+func (t *Wallet) sendLate(amount uint64, asset string, receiveAmount uint64, slateVersion uint16) (slateBytes []byte, err error) {
+	if amount == 0 || receiveAmount > 0 {
+		return nil, errors.New("late locking is for sending only, not for invoices or exchanges")
+	}
+
+	if len(t.inputs) > 0 {
+		return nil, errors.New("cannot choose inputs of a late locked slate")
+	}
+
+	_, _, fee, err := t.pickInputs(amount, asset, t.feeFunc(1))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot pickInputs")
+	}
+
+	blind, err := t.nonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get nonce for blind")
+	}
+
+	_, savedSlate, err := t.initiatorSlate(amount, fee, asset, 0, "", nil, nil, blind, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create initiatorSlate")
+	}
+
+	savedSlate.LateLock = true
+	// the receiver signs payment proofs for the kernel excess with the offset, not known till finalize
+	savedSlate.PaymentProof = nil
+
+	slateBytes, err = marshalSlate(&savedSlate.Slate, slateVersion, stateSend1, savedSlate.ParticipantData, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshalSlate")
+	}
+
+	err = t.db.PutSenderSlate(savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutSenderSlate")
+	}
+
+	return
+}
+
+// lockLate picks inputs and change of the late locked slate and sets its kernel offset,
+// the inputs are to be locked and the change saved once the transaction is finalized
+func (t *Wallet) lockLate(senderSlate *SavedSlate) (walletInputs []Output, outputs []Output, err error) {
+	if senderSlate.Account != t.account.Number {
+		return nil, nil, errors.Errorf("slate %v is sent from account %d, switch to it to finalize", senderSlate.ID, senderSlate.Account)
+	}
+
+	amount := uint64(senderSlate.Amount)
+	asset := senderSlate.Asset
+
+	fee, err := assetFee(uint64(senderSlate.Fee), asset)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get assetFee")
+	}
+
+	// the fee is signed for already
+	walletInputs, change, _, err := t.pickInputs(amount, asset, func(numInputs int, change bool) uint64 { return fee })
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot pickInputs")
+	}
+
+	inputs, outputs, blindExcess, err := t.inputsAndOutputs(amount, fee, asset, change, walletInputs, 0, "")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot create slate inputs and outputs")
+	}
+
+	offset, err := secp256k1.BlindSum(t.context, [][]byte{blindExcess[:]}, [][]byte{senderSlate.Blind[:]})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot BlindSum")
+	}
+
+	senderSlate.Transaction.Offset = hex.EncodeToString(offset[:])
+	senderSlate.Transaction.Body.Inputs = inputs
+	senderSlate.Transaction.Body.Outputs = nil
+	for _, o := range outputs {
+		senderSlate.Transaction.Body.Outputs = append(senderSlate.Transaction.Body.Outputs, o.Output)
+	}
+
+	return
+}
@@ -0,0 +1,66 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLateLock(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	receiver := newTestReceiver(t)
+	defer receiver.Close()
+
+	_, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+
+	w.SetLateLock(true)
+	w.SetFee(1)
+
+	_, err = w.Send(0, "", 3, "cash", SlateVersion4)
+	assert.Error(t, err)
+
+	// outstanding slates do not lock the output they are to be paid from
+	var responses [][]byte
+	for _, version := range []uint16{SlateVersion4, SlateVersion3} {
+		slateBytes, err := w.Send(3, "cash", 0, "", version)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{10}, spendableValues(t, w, "cash"))
+
+		responseBytes, err := receiver.Respond(slateBytes)
+		assert.NoError(t, err)
+		responses = append(responses, responseBytes)
+	}
+
+	txBytes, err := w.Finalize(responses[0])
+	assert.NoError(t, err)
+
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tx.Body.Inputs))
+	assert.Equal(t, 2, len(tx.Body.Outputs))
+	assert.Equal(t, core.Uint64(kernelFee(1, "cash")), tx.Body.Kernels[0].Fee)
+
+	// the output is locked at finalize, the other slate waits for the change to be confirmed
+	assert.Empty(t, spendableValues(t, w, "cash"))
+	_, err = w.Finalize(responses[1])
+	assert.Error(t, err)
+
+	err = w.Confirm([]byte(tx.ID.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{6}, spendableValues(t, w, "cash"))
+
+	txBytes, err = w.Finalize(responses[1])
+	assert.NoError(t, err)
+
+	tx, err = ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+
+	err = w.Confirm([]byte(tx.ID.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{2}, spendableValues(t, w, "cash"))
+}
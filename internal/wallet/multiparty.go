@@ -0,0 +1,478 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/blockcypher/libgrin/libwallet"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/pkg/errors"
+)
+
+// Multiparty slates are built by N wallets in two rounds.
+// In the first round the initiator creates the slate and every other participant joins it adding its inputs, outputs,
+// public blind and nonce. In the second round each participant but the initiator adds its partial signature
+// and the initiator finalizes by adding its own and aggregating all of them into the kernel signature.
+// Each participant spends and receives its own amounts, the transaction is valid only when they sum up for every asset.
+
+// NewMultiparty starts a slate for numParticipants wallets
+func (t *Wallet) NewMultiparty(
+	amount uint64,
+	asset string,
+	receiveAmount uint64,
+	receiveAsset string,
+	numParticipants uint,
+) (
+	slateBytes []byte,
+	err error,
+) {
+	if numParticipants < 2 {
+		return nil, errors.Errorf("expected at least 2 participants, got %d", numParticipants)
+	}
+
+	inputs, change, fee, err := t.selectInputs(amount, asset, noFee)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot selectInputs")
+	}
+
+	_, outputs, savedSlate, err := t.NewSlate(amount, fee, asset, change, inputs, receiveAmount, receiveAsset)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot NewSlate")
+	}
+
+	savedSlate.NumParticipants = numParticipants
+	// payment proofs are between a sender and a receiver only
+	savedSlate.PaymentProof = nil
+
+	// amounts of each participant are its own business
+	slate := savedSlate.Slate
+	slate.Amount = 0
+	slate.Asset = ""
+	slate.ReceiveAmount = 0
+	slate.ReceiveAsset = ""
+
+	slateBytes, err = json.Marshal(slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate to json")
+	}
+
+	for _, o := range outputs {
+		err = t.db.PutOutput(o)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+	}
+
+	err = t.db.PutSenderSlate(savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutSenderSlate")
+	}
+
+	return
+}
+
+// JoinMultiparty adds participant's inputs, outputs, public blind and nonce to the slate in the first round
+func (t *Wallet) JoinMultiparty(
+	inSlateBytes []byte,
+	amount uint64,
+	asset string,
+	receiveAmount uint64,
+	receiveAsset string,
+) (
+	outSlateBytes []byte,
+	err error,
+) {
+	slate, _, err := parseSlate(inSlateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parseSlate")
+	}
+
+	err = t.checkExpiry(slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot checkExpiry")
+	}
+
+	if uint(len(slate.ParticipantData)) >= slate.NumParticipants {
+		return nil, errors.Errorf("all %d participants have already joined", slate.NumParticipants)
+	}
+
+	walletInputs, change, _, err := t.selectInputs(amount, asset, noFee)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot selectInputs")
+	}
+
+	inputs, outputs, blindExcess, err := t.inputsAndOutputs(amount, 0, asset, change, walletInputs, receiveAmount, receiveAsset)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create slate inputs and outputs")
+	}
+
+	nonce, err := t.nonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get nonce")
+	}
+
+	publicBlind, err := t.pubKeyFromSecretKey(blindExcess[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publicBlind")
+	}
+
+	publicNonce, err := t.pubKeyFromSecretKey(nonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publicNonce")
+	}
+
+	slate.Transaction.Body.Inputs = append(slate.Transaction.Body.Inputs, inputs...)
+	for _, o := range outputs {
+		slate.Transaction.Body.Outputs = append(slate.Transaction.Body.Outputs, o.Output)
+	}
+
+	slate.ParticipantData = append(slate.ParticipantData, libwallet.ParticipantData{
+		ID:                core.Uint64(len(slate.ParticipantData)),
+		PublicBlindExcess: publicBlind.Hex(t.context),
+		PublicNonce:       publicNonce.Hex(t.context),
+	})
+
+	outSlateBytes, err = json.Marshal(slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate to json")
+	}
+
+	// remember own amounts to show them in wallet info
+	savedSlate := &SavedSlate{
+		Slate:   *slate,
+		Account: t.account.Number,
+		Nonce:   nonce,
+		Blind:   blindExcess,
+		Created: time.Now().Unix(),
+	}
+	savedSlate.Amount = core.Uint64(amount)
+	savedSlate.Asset = asset
+	savedSlate.ReceiveAmount = core.Uint64(receiveAmount)
+	savedSlate.ReceiveAsset = receiveAsset
+
+	for _, o := range outputs {
+		err = t.db.PutOutput(o)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+	}
+
+	err = t.db.PutReceiverSlate(savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutReceiverSlate")
+	}
+
+	return
+}
+
+// SignMultiparty adds participant's partial signature to the slate in the second round
+func (t *Wallet) SignMultiparty(inSlateBytes []byte) (outSlateBytes []byte, err error) {
+	slate, _, err := parseSlate(inSlateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parseSlate")
+	}
+
+	id, _ := slate.ID.MarshalText()
+
+	savedSlate, err := t.db.GetReceiverSlate(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetReceiverSlate")
+	}
+
+	// signing again with the same nonce and another challenge would reveal the blind,
+	// and the nonce is wiped after the first signature anyway
+	if savedSlate.Signed || savedSlate.Nonce == [32]byte{} {
+		return nil, errors.Errorf("slate %s is already signed", id)
+	}
+
+	err = t.checkExpiry(&savedSlate.Slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot checkExpiry")
+	}
+
+	err = t.checkMultiparty(slate, savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot checkMultiparty")
+	}
+
+	index, err := t.participantIndex(slate, savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find participant")
+	}
+
+	err = t.addPartialSignature(slate, index, savedSlate.Blind[:], savedSlate.Nonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot addPartialSignature")
+	}
+
+	savedSlate.forgetSecrets()
+	savedSlate.Signed = true
+
+	err = t.db.PutReceiverSlate(savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutReceiverSlate")
+	}
+
+	outSlateBytes, err = json.Marshal(slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate to json")
+	}
+
+	tx := Transaction{
+		Transaction: ledger.Transaction{
+			Transaction: slate.Transaction,
+			ID:          slate.ID,
+		},
+		Account: savedSlate.Account,
+		Status:  TransactionUnconfirmed,
+	}
+	tx.setAmounts(uint64(savedSlate.Amount), savedSlate.Asset, uint64(savedSlate.ReceiveAmount), savedSlate.ReceiveAsset, 0, "")
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	return
+}
+
+// FinalizeMultiparty is called by the initiator to verify partial signatures of all participants,
+// add its own and create the transaction
+func (t *Wallet) FinalizeMultiparty(slateBytes []byte) (txBytes []byte, err error) {
+	slate, _, err := parseSlate(slateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parseSlate")
+	}
+
+	id, _ := slate.ID.MarshalText()
+
+	senderSlate, err := t.db.GetSenderSlate(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetSenderSlate")
+	}
+
+	err = t.checkOpen(senderSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot checkOpen")
+	}
+
+	txBytes, tx, err := t.finalizeMultiparty(slate, senderSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot finalizeMultiparty")
+	}
+
+	tx.setInitiated(senderSlate)
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	err = t.forgetSlateSecrets(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot forgetSlateSecrets")
+	}
+
+	return
+}
+
+func (t *Wallet) finalizeMultiparty(slate *Slate, senderSlate *SavedSlate) (txBytes []byte, tx Transaction, err error) {
+	err = t.checkMultiparty(slate, senderSlate)
+	if err != nil {
+		err = errors.Wrap(err, "cannot checkMultiparty")
+		return
+	}
+
+	index, err := t.participantIndex(slate, senderSlate)
+	if err != nil {
+		err = errors.Wrap(err, "cannot find initiator")
+		return
+	}
+
+	sumPublicBlinds, sumPublicNonces, err := t.sumParticipants(slate)
+	if err != nil {
+		err = errors.Wrap(err, "cannot sumParticipants")
+		return
+	}
+
+	msg := ledger.KernelSignatureMessage(slate.Transaction.Body.Kernels[0])
+
+	var partSigs []*secp256k1.AggsigSignaturePartial
+
+	for i, participant := range slate.ParticipantData {
+		if i == index {
+			partSig, e := secp256k1.AggsigSignPartial(
+				t.context,
+				senderSlate.Blind[:],
+				senderSlate.Nonce[:],
+				sumPublicNonces,
+				sumPublicBlinds,
+				msg,
+			)
+			if e != nil {
+				err = errors.Wrap(e, "cannot calculate initiator partial signature")
+				return
+			}
+			partSigs = append(partSigs, &partSig)
+			continue
+		}
+
+		if participant.PartSig == nil {
+			err = errors.Errorf("participant %d has not signed", participant.ID)
+			return
+		}
+
+		partSigBytes, e := hex.DecodeString(*participant.PartSig)
+		if e != nil {
+			err = errors.Wrapf(e, "cannot decode partial signature of participant %d from hex", participant.ID)
+			return
+		}
+
+		partSig, e := secp256k1.AggsigSignaturePartialParse(partSigBytes)
+		if e != nil {
+			err = errors.Wrapf(e, "cannot parse partial signature of participant %d", participant.ID)
+			return
+		}
+
+		err = secp256k1.AggsigVerifyPartial(
+			t.context,
+			&partSig,
+			sumPublicNonces,
+			t.context.PublicKeyFromHex(participant.PublicBlindExcess),
+			sumPublicBlinds,
+			msg,
+		)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot verify partial signature of participant %d", participant.ID)
+			return
+		}
+
+		partSigs = append(partSigs, &partSig)
+	}
+
+	txBytes, tx, err = t.aggregateTransaction(slate, partSigs, sumPublicNonces, sumPublicBlinds, msg)
+	if err != nil {
+		err = errors.Wrap(err, "cannot aggregateTransaction")
+		return
+	}
+
+	tx.Account = senderSlate.Account
+
+	return
+}
+
+// checkMultiparty makes sure all participants have joined and none of the inputs, outputs or terms the wallet
+// has seen when it joined were taken out or changed
+func (t *Wallet) checkMultiparty(slate *Slate, savedSlate *SavedSlate) error {
+	if uint(len(slate.ParticipantData)) != slate.NumParticipants {
+		return errors.Errorf("expected %d participants, got %d", slate.NumParticipants, len(slate.ParticipantData))
+	}
+
+	return checkIntact(slate, savedSlate)
+}
+
+// checkIntact makes sure none of the inputs, outputs or terms of the saved slate were taken out of the slate or changed
+func checkIntact(slate *Slate, savedSlate *SavedSlate) error {
+	if slate.Transaction.Offset != savedSlate.Transaction.Offset ||
+		len(slate.Transaction.Body.Kernels) != 1 ||
+		slate.Transaction.Body.Kernels[0].Fee != savedSlate.Transaction.Body.Kernels[0].Fee ||
+		slate.Transaction.Body.Kernels[0].Features != savedSlate.Transaction.Body.Kernels[0].Features {
+		return errors.New("kernel or offset of the slate have changed since joined")
+	}
+
+	commits := make(map[string]bool)
+	for _, input := range slate.Transaction.Body.Inputs {
+		commits["i"+input.Commit] = true
+	}
+	for _, output := range slate.Transaction.Body.Outputs {
+		commits["o"+output.Commit] = true
+	}
+
+	for _, input := range savedSlate.Transaction.Body.Inputs {
+		if !commits["i"+input.Commit] {
+			return errors.Errorf("input %v is missing from the slate", input.Commit)
+		}
+	}
+	for _, output := range savedSlate.Transaction.Body.Outputs {
+		if !commits["o"+output.Commit] {
+			return errors.Errorf("output %v is missing from the slate", output.Commit)
+		}
+	}
+
+	return nil
+}
+
+// participantIndex finds participant data of this wallet by its public nonce
+func (t *Wallet) participantIndex(slate *Slate, savedSlate *SavedSlate) (index int, err error) {
+	publicNonce, err := t.pubKeyFromSecretKey(savedSlate.Nonce[:])
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot create publicNonce")
+	}
+
+	for i, participant := range slate.ParticipantData {
+		participantNonce := t.context.PublicKeyFromHex(participant.PublicNonce)
+		if participantNonce != nil && bytes.Equal(publicNonce.Bytes(t.context), participantNonce.Bytes(t.context)) {
+			return i, nil
+		}
+	}
+
+	return 0, errors.New("cannot find own public nonce in participant data")
+}
+
+// addPartialSignature signs the kernel with participant's blind excess and nonce
+func (t *Wallet) addPartialSignature(slate *Slate, index int, blind []byte, nonce []byte) error {
+	sumPublicBlinds, sumPublicNonces, err := t.sumParticipants(slate)
+	if err != nil {
+		return errors.Wrap(err, "cannot sumParticipants")
+	}
+
+	msg := ledger.KernelSignatureMessage(slate.Transaction.Body.Kernels[0])
+
+	partSig, err := secp256k1.AggsigSignPartial(
+		t.context,
+		blind,
+		nonce,
+		sumPublicNonces,
+		sumPublicBlinds,
+		msg,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot calculate partial signature")
+	}
+
+	partSigBytes := secp256k1.AggsigSignaturePartialSerialize(&partSig)
+	partSigString := hex.EncodeToString(partSigBytes[:])
+	slate.ParticipantData[index].PartSig = &partSigString
+
+	return nil
+}
+
+func (t *Wallet) sumParticipants(slate *Slate) (sumPublicBlinds *secp256k1.PublicKey, sumPublicNonces *secp256k1.PublicKey, err error) {
+	var publicBlinds, publicNonces []*secp256k1.PublicKey
+
+	for _, participant := range slate.ParticipantData {
+		publicBlind := t.context.PublicKeyFromHex(participant.PublicBlindExcess)
+		publicNonce := t.context.PublicKeyFromHex(participant.PublicNonce)
+		if publicBlind == nil || publicNonce == nil {
+			return nil, nil, errors.Errorf("cannot parse public blind or nonce of participant %d", participant.ID)
+		}
+		publicBlinds = append(publicBlinds, publicBlind)
+		publicNonces = append(publicNonces, publicNonce)
+	}
+
+	sumPublicBlinds, err = t.sumPubKeys(publicBlinds)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get sumPublicBlinds")
+	}
+
+	sumPublicNonces, err = t.sumPubKeys(publicNonces)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get sumPublicNonces")
+	}
+
+	return
+}
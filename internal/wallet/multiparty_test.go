@@ -0,0 +1,94 @@
+package wallet
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiparty(t *testing.T) {
+	// three wallets with their own keys
+	var wallets []*Wallet
+	for i := 0; i < 3; i++ {
+		dir := testDbDir() + "_" + strconv.Itoa(i)
+
+		err := os.RemoveAll(dir)
+		assert.NoError(t, err)
+
+		w, err := NewWalletWithoutMasterKey(dir)
+		assert.NoError(t, err)
+		defer w.Close()
+
+		_, err = w.InitMasterKey("", "", DefaultMnemonicWords, "")
+		assert.NoError(t, err)
+
+		wallets = append(wallets, w)
+	}
+	a, b, c := wallets[0], wallets[1], wallets[2]
+
+	for _, value := range []uint64{1, 2} {
+		_, err := a.Issue(value, "cash")
+		assert.NoError(t, err)
+	}
+	_, err := b.Issue(5, "apple")
+	assert.NoError(t, err)
+
+	// a pays 2 cash to b and 1 cash to c, b pays 5 apples to a
+	slateBytes, err := a.NewMultiparty(3, "cash", 5, "apple", 3)
+	assert.NoError(t, err)
+	fmt.Println("new  " + string(slateBytes))
+
+	slateBytes, err = b.JoinMultiparty(slateBytes, 5, "apple", 2, "cash")
+	assert.NoError(t, err)
+	fmt.Println("join " + string(slateBytes))
+
+	// initiator cannot finalize before all participants join
+	_, err = a.FinalizeMultiparty(slateBytes)
+	assert.Error(t, err)
+
+	slateBytes, err = c.JoinMultiparty(slateBytes, 0, "", 1, "cash")
+	assert.NoError(t, err)
+	fmt.Println("join " + string(slateBytes))
+
+	// no one can join after all participants have joined
+	_, err = c.JoinMultiparty(slateBytes, 0, "", 1, "cash")
+	assert.Error(t, err)
+
+	joinedBytes := slateBytes
+	slateBytes, err = b.SignMultiparty(slateBytes)
+	assert.NoError(t, err)
+	fmt.Println("sign " + string(slateBytes))
+
+	// participant refuses to sign twice
+	_, err = b.SignMultiparty(joinedBytes)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already signed")
+
+	// initiator cannot finalize before all participants sign
+	_, err = a.FinalizeMultiparty(slateBytes)
+	assert.Error(t, err)
+
+	slateBytes, err = c.SignMultiparty(slateBytes)
+	assert.NoError(t, err)
+	fmt.Println("sign " + string(slateBytes))
+
+	txBytes, err := a.FinalizeMultiparty(slateBytes)
+	assert.NoError(t, err)
+	fmt.Println("tx   " + string(txBytes))
+
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+
+	// 3 inputs: 1+2 cash 5 apples, 3 outputs: 5 apples to a, 2 cash to b, 1 cash to c
+	assert.Equal(t, 3, len(tx.Body.Inputs))
+	assert.Equal(t, 3, len(tx.Body.Outputs))
+
+	for _, w := range wallets {
+		err = w.Confirm([]byte(tx.ID.String()))
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,731 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/blockcypher/libgrin/libwallet"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Multisig outputs are owned by two wallets together: the commitment is made with the sum of their blind shares
+// R = R1 + R2, so the output can be spent only when both of them co-sign.
+// Funding takes two steps. The funder spends its inputs to the shared output and sends the slate with its part
+// of the commitment and of the bulletproof. The other party adds its blind share to the commitment, computes its part
+// of the bulletproof, signs and returns the slate. The funder completes the bulletproof, signs and creates the transaction.
+// Spending takes the same two steps: one party proposes a spend sending the other its part of the value,
+// the other co-signs, then the proposer finalizes.
+// Blind shares are the child keys themselves, not switch commitment blinds like those of single owner outputs:
+// the switch blind hashes xJ of the whole blind x, which neither party knows alone.
+
+// NewMultisig starts a slate funding a multisig output of value of asset from this wallet's inputs
+func (t *Wallet) NewMultisig(value uint64, asset string) (slateBytes []byte, err error) {
+	inputs, change, fee, err := t.selectInputs(value, asset, noFee)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot selectInputs")
+	}
+
+	_, outputs, savedSlate, err := t.NewSlate(value, fee, asset, change, inputs, 0, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot NewSlate")
+	}
+
+	// the value stays with the funder
+	savedSlate.PaymentProof = nil
+
+	blindShare, index, err := t.newSecret()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get newSecret")
+	}
+
+	// nonce of the joint bulletproof is known to both parties
+	proofNonce, err := t.nonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get nonce")
+	}
+
+	commitment, err := secp256k1.Commit(
+		t.context,
+		blindShare[:],
+		ledger.CommitValue(value, asset),
+		&secp256k1.GeneratorH,
+		&secp256k1.GeneratorG)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create commitment to value")
+	}
+
+	share, err := t.multisigShare(blindShare[:], proofNonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create multisigShare")
+	}
+
+	savedSlate.Multisig = &Multisig{
+		Value:  core.Uint64(value),
+		Asset:  asset,
+		Commit: commitment.String(),
+		Nonce:  hex.EncodeToString(proofNonce[:]),
+		Shares: []MultisigShare{share},
+	}
+	savedSlate.MultisigIndex = index
+
+	// funder's blind excess includes its share of the multisig output
+	savedSlate.Blind, err = secp256k1.BlindSum(t.context, [][]byte{savedSlate.Blind[:], blindShare[:]}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot BlindSum")
+	}
+
+	publicBlind, err := t.pubKeyFromSecretKey(savedSlate.Blind[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publicBlind")
+	}
+	savedSlate.ParticipantData[0].PublicBlindExcess = publicBlind.Hex(t.context)
+
+	slateBytes, err = json.Marshal(savedSlate.Slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate to json")
+	}
+
+	for _, o := range outputs {
+		err = t.db.PutOutput(o)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+	}
+
+	err = t.db.PutSenderSlate(savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutSenderSlate")
+	}
+
+	return
+}
+
+// JoinMultisig adds this wallet's blind share to the commitment of the multisig output, computes its part of
+// the bulletproof and signs the funding slate
+func (t *Wallet) JoinMultisig(inSlateBytes []byte) (outSlateBytes []byte, err error) {
+	slate, _, err := parseSlate(inSlateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parseSlate")
+	}
+
+	if slate.Multisig == nil || len(slate.Multisig.Shares) != 1 || len(slate.ParticipantData) != 1 {
+		return nil, errors.New("expected a slate funding a multisig output with the funder's share only")
+	}
+
+	blindShare, index, err := t.newSecret()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get newSecret")
+	}
+
+	nonce, err := t.nonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get nonce")
+	}
+
+	proofNonce, err := hex.DecodeString(slate.Multisig.Nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode multisig nonce from hex")
+	}
+
+	share, err := t.multisigShare(blindShare[:], proofNonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create multisigShare")
+	}
+
+	// complete the commitment with own blind share: C = R1*G + v*H + R2*G
+	funderCommitment, err := secp256k1.CommitmentFromString(slate.Multisig.Commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode multisig commitment")
+	}
+
+	shareCommitment, err := secp256k1.Commit(t.context, blindShare[:], 0, &secp256k1.GeneratorH, &secp256k1.GeneratorG)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create commitment to blind share")
+	}
+
+	commitment, err := secp256k1.CommitSum(t.context, []*secp256k1.Commitment{funderCommitment, shareCommitment}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot CommitSum")
+	}
+
+	slate.Multisig.Commit = commitment.String()
+	slate.Multisig.Shares = append(slate.Multisig.Shares, share)
+
+	tauX, err := t.multisigTauX(slate.Multisig, blindShare[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot calculate multisigTauX")
+	}
+	slate.Multisig.Shares[1].TauX = hex.EncodeToString(tauX[:])
+
+	publicNonce, err := t.pubKeyFromSecretKey(nonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publicNonce")
+	}
+
+	// the only contribution of this party to the kernel excess is its blind share
+	slate.ParticipantData = append(slate.ParticipantData, libwallet.ParticipantData{
+		ID:                1,
+		PublicBlindExcess: share.PublicBlind,
+		PublicNonce:       publicNonce.Hex(t.context),
+	})
+
+	err = t.addPartialSignature(slate, 1, blindShare[:], nonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot addPartialSignature")
+	}
+
+	outSlateBytes, err = json.Marshal(slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate to json")
+	}
+
+	output := Output{
+		Output: core.Output{
+			Features: core.PlainOutput,
+			Commit:   commitment.String(),
+		},
+		Account:     t.account.Number,
+		Index:       index,
+		Value:       uint64(slate.Multisig.Value),
+		Asset:       slate.Multisig.Asset,
+		Status:      OutputUnconfirmed,
+		Multisig:    true,
+		AccountPath: true,
+	}
+
+	err = t.db.PutOutput(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutOutput")
+	}
+
+	// the share is signed for, its key is derived again from the index when the output is spent
+	err = t.db.PutReceiverSlate(&SavedSlate{
+		Slate:   *slate,
+		Account: t.account.Number,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutReceiverSlate")
+	}
+
+	// the funder will add the output with the completed bulletproof, remember it to confirm it with the transaction
+	tx := Transaction{
+		Transaction: ledger.Transaction{
+			Transaction: slate.Transaction,
+			ID:          slate.ID,
+		},
+		Account: t.account.Number,
+		Status:  TransactionUnconfirmed,
+	}
+	tx.Body.Outputs = append(append([]core.Output{}, slate.Transaction.Body.Outputs...), output.Output)
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	return
+}
+
+// SpendMultisig proposes to spend the multisig output: this wallet receives amount and the other party the rest
+func (t *Wallet) SpendMultisig(commit string, amount uint64) (slateBytes []byte, err error) {
+	multisigOutput, err := t.db.GetOutput(commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetOutput")
+	}
+
+	if !multisigOutput.Multisig || multisigOutput.Status != OutputConfirmed {
+		return nil, errors.Errorf("output %v is not a confirmed multisig output", commit)
+	}
+
+	if amount > multisigOutput.Value {
+		return nil, errors.Errorf("amount %d is more than multisig output value %d", amount, multisigOutput.Value)
+	}
+
+	outputs, blind, err := t.multisigSpendOutputs(multisigOutput, amount)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create multisigSpendOutputs")
+	}
+
+	inputs := []core.Input{{Features: multisigOutput.Features, Commit: multisigOutput.Commit}}
+
+	slateBytes, savedSlate, err := t.newSlate(inputs, outputs, multisigOutput.Value-amount, 0, multisigOutput.Asset, blind[:], 0, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot newSlate")
+	}
+
+	multisigOutput.Status = OutputLocked
+	outputs = append(outputs, multisigOutput)
+
+	for _, o := range outputs {
+		err = t.db.PutOutput(o)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+	}
+
+	err = t.db.PutSenderSlate(savedSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutSenderSlate")
+	}
+
+	return
+}
+
+// CosignMultisig adds this wallet's output receiving its part of the value and its partial signature
+// to the slate spending the multisig output
+func (t *Wallet) CosignMultisig(inSlateBytes []byte) (outSlateBytes []byte, err error) {
+	slate, _, err := parseSlate(inSlateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parseSlate")
+	}
+
+	if len(slate.Transaction.Body.Inputs) != 1 || len(slate.ParticipantData) != 1 {
+		return nil, errors.New("expected a slate spending a multisig output proposed by the other party")
+	}
+
+	multisigOutput, err := t.db.GetOutput(slate.Transaction.Body.Inputs[0].Commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetOutput")
+	}
+
+	if !multisigOutput.Multisig || multisigOutput.Status != OutputConfirmed {
+		return nil, errors.Errorf("input %v is not a confirmed multisig output", multisigOutput.Commit)
+	}
+
+	amount := uint64(slate.Amount)
+	if amount > multisigOutput.Value || slate.Asset != multisigOutput.Asset {
+		return nil, errors.Errorf("cannot receive %d %v from multisig output of %d %v", amount, slate.Asset, multisigOutput.Value, multisigOutput.Asset)
+	}
+
+	outputs, blind, err := t.multisigSpendOutputs(multisigOutput, amount)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create multisigSpendOutputs")
+	}
+
+	nonce, err := t.nonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get nonce")
+	}
+
+	publicBlind, err := t.pubKeyFromSecretKey(blind[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publicBlind")
+	}
+
+	publicNonce, err := t.pubKeyFromSecretKey(nonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publicNonce")
+	}
+
+	for _, o := range outputs {
+		slate.Transaction.Body.Outputs = append(slate.Transaction.Body.Outputs, o.Output)
+	}
+
+	slate.ParticipantData = append(slate.ParticipantData, libwallet.ParticipantData{
+		ID:                1,
+		PublicBlindExcess: publicBlind.Hex(t.context),
+		PublicNonce:       publicNonce.Hex(t.context),
+	})
+
+	err = t.addPartialSignature(slate, 1, blind[:], nonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot addPartialSignature")
+	}
+
+	outSlateBytes, err = json.Marshal(slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate to json")
+	}
+
+	multisigOutput.Status = OutputLocked
+	outputs = append(outputs, multisigOutput)
+
+	for _, o := range outputs {
+		err = t.db.PutOutput(o)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+	}
+
+	// signed already, the secrets are not kept
+	err = t.db.PutReceiverSlate(&SavedSlate{
+		Slate:   *slate,
+		Account: t.account.Number,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutReceiverSlate")
+	}
+
+	tx := Transaction{
+		Transaction: ledger.Transaction{
+			Transaction: slate.Transaction,
+			ID:          slate.ID,
+		},
+		Account: t.account.Number,
+		Status:  TransactionUnconfirmed,
+	}
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	return
+}
+
+// FinalizeMultisig is called by the party that started the slate. When funding, it completes the joint bulletproof
+// and adds the multisig output to the transaction, then it signs and creates the transaction
+func (t *Wallet) FinalizeMultisig(slateBytes []byte) (txBytes []byte, err error) {
+	slate, _, err := parseSlate(slateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parseSlate")
+	}
+
+	id, _ := slate.ID.MarshalText()
+
+	senderSlate, err := t.db.GetSenderSlate(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetSenderSlate")
+	}
+
+	var multisigOutput *Output
+
+	if senderSlate.Multisig != nil {
+		multisigOutput, err = t.completeMultisig(slate, senderSlate)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot completeMultisig")
+		}
+		slate.Transaction.Body.Outputs = append(slate.Transaction.Body.Outputs, multisigOutput.Output)
+	}
+
+	txBytes, tx, err := t.finalizeMultiparty(slate, senderSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot finalizeMultiparty")
+	}
+
+	tx.setInitiated(senderSlate)
+
+	if multisigOutput != nil {
+		err = t.db.PutOutput(*multisigOutput)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+	}
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	err = t.forgetSlateSecrets(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot forgetSlateSecrets")
+	}
+
+	return
+}
+
+// completeMultisig checks the other party's share of the multisig output, adds funder's tau x and creates the bulletproof
+func (t *Wallet) completeMultisig(slate *Slate, senderSlate *SavedSlate) (output *Output, err error) {
+	saved := senderSlate.Multisig
+	multisig := slate.Multisig
+
+	if multisig == nil || len(multisig.Shares) != 2 ||
+		multisig.Value != saved.Value || multisig.Asset != saved.Asset || multisig.Nonce != saved.Nonce ||
+		multisig.Shares[0] != saved.Shares[0] {
+		return nil, errors.New("multisig output of the slate has changed since funded")
+	}
+
+	// commitment must differ from the funder's one by the other party's public blind share: C - (R1*G + v*H) = R2*G
+	commitment, err := secp256k1.CommitmentFromString(multisig.Commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode multisig commitment")
+	}
+
+	funderCommitment, err := secp256k1.CommitmentFromString(saved.Commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode funder commitment")
+	}
+
+	shareCommitment, err := secp256k1.CommitSum(t.context, []*secp256k1.Commitment{commitment}, []*secp256k1.Commitment{funderCommitment})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot CommitSum")
+	}
+
+	sharePublicBlind, err := secp256k1.CommitmentToPublicKey(t.context, shareCommitment)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot CommitmentToPublicKey")
+	}
+
+	publicBlind := t.context.PublicKeyFromHex(multisig.Shares[1].PublicBlind)
+	if publicBlind == nil || !bytes.Equal(sharePublicBlind.Bytes(t.context), publicBlind.Bytes(t.context)) {
+		return nil, errors.New("multisig commitment does not match public blind share of the other party")
+	}
+
+	blindShare, err := t.outputSecret(senderSlate.Account, senderSlate.MultisigIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get secret for multisig share with key index %d", senderSlate.MultisigIndex)
+	}
+
+	tauX, err := t.multisigTauX(multisig, blindShare[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot calculate multisigTauX")
+	}
+	multisig.Shares[0].TauX = hex.EncodeToString(tauX[:])
+
+	proof, err := t.multisigProof(multisig, blindShare[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create multisigProof")
+	}
+
+	output = &Output{
+		Output: core.Output{
+			Features: core.PlainOutput,
+			Commit:   multisig.Commit,
+			Proof:    hex.EncodeToString(proof),
+		},
+		Account:     senderSlate.Account,
+		Index:       senderSlate.MultisigIndex,
+		Value:       uint64(multisig.Value),
+		Asset:       multisig.Asset,
+		Status:      OutputUnconfirmed,
+		Multisig:    true,
+		AccountPath: true,
+	}
+
+	return
+}
+
+// multisigSpendOutputs creates an output receiving amount, if any, and returns blind excess of this party
+// spending its share of the multisig output
+func (t *Wallet) multisigSpendOutputs(multisigOutput Output, amount uint64) (outputs []Output, blindExcess [32]byte, err error) {
+	blindShare, err := t.outputKey(multisigOutput)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot get secret for multisig share with key index %d", multisigOutput.Index)
+		return
+	}
+
+	var outputBlinds [][]byte
+
+	if amount > 0 {
+		output, blind, e := t.newOutput(amount, core.PlainOutput, multisigOutput.Asset, OutputUnconfirmed)
+		if e != nil {
+			err = errors.Wrap(e, "cannot create output")
+			return
+		}
+		outputBlinds = append(outputBlinds, blind)
+		outputs = append(outputs, *output)
+	}
+
+	blindExcess, err = secp256k1.BlindSum(t.context, outputBlinds, [][]byte{blindShare[:]})
+	if err != nil {
+		err = errors.Wrap(err, "cannot create blinding excess sum")
+		return
+	}
+
+	return
+}
+
+// multisigShare publishes participant's blind share and T1, T2 points of its part of the joint bulletproof
+func (t *Wallet) multisigShare(blindShare []byte, proofNonce []byte) (share MultisigShare, err error) {
+	publicBlind, err := t.pubKeyFromSecretKey(blindShare)
+	if err != nil {
+		err = errors.Wrap(err, "cannot create publicBlind")
+		return
+	}
+
+	tau1, tau2 := multisigTaus(blindShare, proofNonce)
+
+	tOne, err := t.pubKeyFromSecretKey(tau1[:])
+	if err != nil {
+		err = errors.Wrap(err, "cannot create T1")
+		return
+	}
+
+	tTwo, err := t.pubKeyFromSecretKey(tau2[:])
+	if err != nil {
+		err = errors.Wrap(err, "cannot create T2")
+		return
+	}
+
+	share = MultisigShare{
+		PublicBlind: publicBlind.Hex(t.context),
+		TOne:        tOne.Hex(t.context),
+		TTwo:        tTwo.Hex(t.context),
+	}
+
+	return
+}
+
+// multisigTaus derives secret tau1 and tau2 of participant's part of the joint bulletproof from its blind share
+func multisigTaus(blindShare []byte, proofNonce []byte) (tau1 [32]byte, tau2 [32]byte) {
+	tau1 = blake2b.Sum256(append(append([]byte{1}, blindShare...), proofNonce...))
+	tau2 = blake2b.Sum256(append(append([]byte{2}, blindShare...), proofNonce...))
+	return
+}
+
+// multisigTauX calculates participant's part of tau x of the joint bulletproof: tau1*x + tau2*x^2 + z^2*R
+func (t *Wallet) multisigTauX(multisig *Multisig, blindShare []byte) (tauX [32]byte, err error) {
+	x, z, err := t.multisigChallenges(multisig, blindShare)
+	if err != nil {
+		err = errors.Wrap(err, "cannot get multisigChallenges")
+		return
+	}
+
+	nonce, err := hex.DecodeString(multisig.Nonce)
+	if err != nil {
+		err = errors.Wrap(err, "cannot decode multisig nonce from hex")
+		return
+	}
+
+	tau1, tau2 := multisigTaus(blindShare, nonce)
+
+	sum := new(big.Int).Mul(new(big.Int).SetBytes(tau1[:]), x)
+	sum.Add(sum, new(big.Int).Mul(new(big.Int).SetBytes(tau2[:]), new(big.Int).Mul(x, x)))
+	sum.Add(sum, new(big.Int).Mul(new(big.Int).SetBytes(blindShare), new(big.Int).Mul(z, z)))
+	sum.Mod(sum, curveOrder)
+	sum.FillBytes(tauX[:])
+
+	return
+}
+
+// multisigChallenges recovers challenges x and z of the joint bulletproof. They are hashes of the commitment and
+// A, S, T1, T2 points of the proof, which do not depend on tau x, so they are taken from a proof with a dummy one.
+// The library computes tau x itself in the second round of its multi-party prove, but its Go binding
+// BulletproofRangeproofProveMulti always passes a proof buffer and tau x, so it runs only the final round,
+// and it panics on its nil T1, T2 results. Until the binding exposes the second round the transcript is read here,
+// and multisigProof verifies the joint proof so that a transcript out of step with the library fails loudly.
+func (t *Wallet) multisigChallenges(multisig *Multisig, blindShare []byte) (x *big.Int, z *big.Int, err error) {
+	var dummyTauX [32]byte
+	dummyTauX[31] = 1
+
+	proof, err := t.multisigBulletproof(multisig, blindShare, dummyTauX)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot create multisigBulletproof")
+	}
+
+	commitment, err := secp256k1.CommitmentFromString(multisig.Commit)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot decode multisig commitment")
+	}
+
+	x, z, err = bulletproofChallenges(proof, commitment)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get bulletproofChallenges")
+	}
+
+	return
+}
+
+// multisigProof sums up tau x of both parties, creates the joint bulletproof and verifies it
+func (t *Wallet) multisigProof(multisig *Multisig, blindShare []byte) (proof []byte, err error) {
+	sum := new(big.Int)
+	for i, share := range multisig.Shares {
+		tauX, e := hex.DecodeString(share.TauX)
+		if e != nil || len(tauX) != 32 {
+			return nil, errors.Errorf("cannot decode tau x of share %d", i)
+		}
+		sum.Add(sum, new(big.Int).SetBytes(tauX))
+	}
+	sum.Mod(sum, curveOrder)
+
+	var tauX [32]byte
+	sum.FillBytes(tauX[:])
+
+	proof, err = t.multisigBulletproof(multisig, blindShare, tauX)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create multisigBulletproof")
+	}
+
+	commitment, err := secp256k1.CommitmentFromString(multisig.Commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode multisig commitment")
+	}
+
+	err = secp256k1.BulletproofRangeproofVerifySingle(t.context, nil, nil, proof, commitment, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot verify joint bulletproof")
+	}
+
+	return
+}
+
+// multisigBulletproof runs the last round of the multi-party bulletproof with sums of T1, T2 points of both parties
+// and the given tau x. Blind share is not used by this round but cannot be empty
+func (t *Wallet) multisigBulletproof(multisig *Multisig, blindShare []byte, tauX [32]byte) (proof []byte, err error) {
+	var tOnes, tTwos []*secp256k1.PublicKey
+	for i, share := range multisig.Shares {
+		tOne := t.context.PublicKeyFromHex(share.TOne)
+		tTwo := t.context.PublicKeyFromHex(share.TTwo)
+		if tOne == nil || tTwo == nil {
+			return nil, errors.Errorf("cannot parse T1 or T2 of share %d", i)
+		}
+		tOnes = append(tOnes, tOne)
+		tTwos = append(tTwos, tTwo)
+	}
+
+	sumTOne, err := t.sumPubKeys(tOnes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot sum T1")
+	}
+
+	sumTTwo, err := t.sumPubKeys(tTwos)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot sum T2")
+	}
+
+	commitment, err := secp256k1.CommitmentFromString(multisig.Commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode multisig commitment")
+	}
+
+	nonceBytes, err := hex.DecodeString(multisig.Nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode multisig nonce from hex")
+	}
+
+	var nonce, blind [32]byte
+	copy(nonce[:], nonceBytes)
+	copy(blind[:], blindShare)
+
+	scratch, err := secp256k1.ScratchSpaceCreate(t.context, 1024*4096)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ScratchSpaceCreate")
+	}
+	defer secp256k1.ScratchSpaceDestroy(scratch)
+
+	generators, err := secp256k1.BulletproofGeneratorsCreate(t.context, &secp256k1.GeneratorG, 256)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot BulletproofGeneratorsCreate")
+	}
+	defer secp256k1.BulletproofGeneratorsDestroy(t.context, generators)
+
+	proof, _, _, _, err = secp256k1.BulletproofRangeproofProve(
+		t.context,
+		scratch,
+		generators,
+		tauX,
+		sumTOne,
+		sumTTwo,
+		[]uint64{ledger.CommitValue(uint64(multisig.Value), multisig.Asset)},
+		nil,
+		[][32]byte{blind},
+		[]*secp256k1.Commitment{commitment},
+		&secp256k1.GeneratorH,
+		64,
+		nonce,
+		blind,
+		nil,
+		[20]byte{})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot BulletproofRangeproofProve")
+	}
+
+	return
+}
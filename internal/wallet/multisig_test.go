@@ -0,0 +1,117 @@
+package wallet
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultisig(t *testing.T) {
+	// two wallets with their own keys
+	var wallets []*Wallet
+	for _, suffix := range []string{"_funder", "_joiner"} {
+		dir := testDbDir() + suffix
+
+		err := os.RemoveAll(dir)
+		assert.NoError(t, err)
+
+		w, err := NewWalletWithoutMasterKey(dir)
+		assert.NoError(t, err)
+		defer w.Close()
+
+		_, err = w.InitMasterKey("", "", DefaultMnemonicWords, "")
+		assert.NoError(t, err)
+
+		wallets = append(wallets, w)
+	}
+	a, b := wallets[0], wallets[1]
+
+	_, err := a.Issue(15, "cash")
+	assert.NoError(t, err)
+
+	// a funds a multisig output of 10 cash shared with b
+	slateBytes, err := a.NewMultisig(10, "cash")
+	assert.NoError(t, err)
+	fmt.Println("new  " + string(slateBytes))
+
+	slateBytes, err = b.JoinMultisig(slateBytes)
+	assert.NoError(t, err)
+	fmt.Println("join " + string(slateBytes))
+
+	txBytes, err := a.FinalizeMultisig(slateBytes)
+	assert.NoError(t, err)
+	fmt.Println("tx   " + string(txBytes))
+
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+
+	// 1 input of 15 cash, 2 outputs: change of 5 and the multisig output of 10
+	assert.Equal(t, 1, len(tx.Body.Inputs))
+	assert.Equal(t, 2, len(tx.Body.Outputs))
+
+	for _, w := range wallets {
+		err = w.Confirm([]byte(tx.ID.String()))
+		assert.NoError(t, err)
+	}
+
+	var commit string
+	for _, w := range wallets {
+		outputs, err := w.db.ListOutputs()
+		assert.NoError(t, err)
+		var multisigs []Output
+		for _, o := range outputs {
+			if o.Multisig {
+				multisigs = append(multisigs, o)
+			}
+		}
+		assert.Equal(t, 1, len(multisigs))
+		assert.Equal(t, OutputConfirmed, int(multisigs[0].Status))
+		commit = multisigs[0].Commit
+	}
+
+	// each sees the multisig output as shared, out of its total
+	balances, err := a.Balances()
+	assert.NoError(t, err)
+	assert.Equal(t, []Balance{{Asset: "cash", Spendable: 5, Shared: 10}}, balances)
+	assert.Equal(t, uint64(5), balances[0].Total())
+	balances, err = b.Balances()
+	assert.NoError(t, err)
+	assert.Equal(t, []Balance{{Asset: "cash", Shared: 10}}, balances)
+	assert.Equal(t, uint64(0), balances[0].Total())
+
+	// neither can spend the multisig output alone
+	_, err = b.Send(10, "cash", 0, "", SlateVersion4)
+	assert.Error(t, err)
+
+	// b proposes to take 4 cash and leave 6 to a
+	slateBytes, err = b.SpendMultisig(commit, 4)
+	assert.NoError(t, err)
+	fmt.Println("spend  " + string(slateBytes))
+
+	slateBytes, err = a.CosignMultisig(slateBytes)
+	assert.NoError(t, err)
+	fmt.Println("cosign " + string(slateBytes))
+
+	txBytes, err = b.FinalizeMultisig(slateBytes)
+	assert.NoError(t, err)
+	fmt.Println("tx     " + string(txBytes))
+
+	tx, err = ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(tx.Body.Inputs))
+	assert.Equal(t, commit, tx.Body.Inputs[0].Commit)
+	assert.Equal(t, 2, len(tx.Body.Outputs))
+
+	for _, w := range wallets {
+		err = w.Confirm([]byte(tx.ID.String()))
+		assert.NoError(t, err)
+
+		output, err := w.db.GetOutput(commit)
+		assert.NoError(t, err)
+		assert.Equal(t, OutputSpent, int(output.Status))
+	}
+}
@@ -0,0 +1,115 @@
+package wallet
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FindOutput finds the output by its commit or a prefix of it unique in the wallet, as shown by Info
+func (t *Wallet) FindOutput(commit string) (output Output, err error) {
+	if len(commit) == 0 {
+		err = errors.New("commit is empty")
+		return
+	}
+
+	outputs, err := t.db.ListOutputs()
+	if err != nil {
+		err = errors.Wrap(err, "cannot ListOutputs")
+		return
+	}
+
+	var found []Output
+	for _, o := range outputs {
+		if strings.HasPrefix(o.Commit, commit) {
+			found = append(found, o)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		err = errors.Errorf("cannot find output %v", commit)
+	case 1:
+		output = found[0]
+	default:
+		err = errors.Errorf("%d outputs start with %v, give more of the commit", len(found), commit)
+	}
+
+	return
+}
+
+// FreezeOutput keeps the output from being spent, by coin selection or by choice, until it is unfrozen
+func (t *Wallet) FreezeOutput(commit string) (output Output, err error) {
+	return t.setFrozen(commit, true)
+}
+
+// UnfreezeOutput lets the output be spent again
+func (t *Wallet) UnfreezeOutput(commit string) (output Output, err error) {
+	return t.setFrozen(commit, false)
+}
+
+func (t *Wallet) setFrozen(commit string, frozen bool) (output Output, err error) {
+	output, err = t.FindOutput(commit)
+	if err != nil {
+		err = errors.Wrap(err, "cannot FindOutput")
+		return
+	}
+
+	if output.Status == OutputSpent || output.Status == OutputCanceled {
+		err = errors.Errorf("output %v is %v", output.Commit, output.Status)
+		return
+	}
+
+	output.Frozen = frozen
+
+	err = t.db.PutOutput(output)
+	if err != nil {
+		err = errors.Wrap(err, "cannot PutOutput")
+		return
+	}
+
+	return
+}
+
+// SetInputs makes the next transactions spend exactly the outputs with these commits, or their prefixes,
+// instead of ones picked by coin selection, until the wallet is closed
+func (t *Wallet) SetInputs(commits []string) {
+	t.inputs = commits
+}
+
+// chosenInputs are the outputs set with SetInputs, they must be spendable by this wallet alone and in the asset sent
+func (t *Wallet) chosenInputs(asset string) (outputs []Output, err error) {
+	seen := make(map[string]bool)
+
+	for _, commit := range t.inputs {
+		output, e := t.FindOutput(commit)
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot FindOutput")
+		}
+
+		if seen[output.Commit] {
+			return nil, errors.Errorf("output %v is chosen twice", output.Commit)
+		}
+		seen[output.Commit] = true
+
+		if output.Account != t.account.Number {
+			return nil, errors.Errorf("output %v is not in account %v", output.Commit, t.account.Name)
+		}
+		if output.Asset != asset {
+			return nil, errors.Errorf("output %v is of asset %v, not %v", output.Commit, output.Asset, asset)
+		}
+		if output.Status != OutputConfirmed {
+			return nil, errors.Errorf("output %v is %v", output.Commit, output.Status)
+		}
+		if output.Multisig {
+			return nil, errors.Errorf("output %v is multisig", output.Commit)
+		}
+		if output.Frozen {
+			return nil, errors.Errorf("output %v is frozen", output.Commit)
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	return
+}
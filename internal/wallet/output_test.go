@@ -0,0 +1,78 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoinControl(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	commits := make(map[uint64]string)
+	for _, value := range []uint64{5, 10, 20} {
+		_, err := w.Issue(value, "cash")
+		assert.NoError(t, err)
+	}
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+	for _, output := range outputs {
+		commits[output.Value] = output.Commit
+	}
+
+	saved := func(value uint64) (output Output) {
+		output, err := w.db.GetOutput(commits[value])
+		assert.NoError(t, err)
+		return
+	}
+
+	output, err := w.FreezeOutput(commits[10][:16])
+	assert.NoError(t, err)
+	assert.Equal(t, commits[10], output.Commit)
+	assert.True(t, saved(10).Frozen)
+
+	// frozen output is skipped by coin selection
+	_, err = w.Send(12, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+	assert.Equal(t, OutputStatus(OutputLocked), saved(5).Status)
+	assert.Equal(t, OutputStatus(OutputConfirmed), saved(10).Status)
+	assert.Equal(t, OutputStatus(OutputLocked), saved(20).Status)
+
+	// only the frozen output is flagged in the report
+	report, err := w.Report()
+	assert.NoError(t, err)
+	assert.Len(t, report.Outputs, 4)
+	for _, output := range report.Outputs {
+		assert.Equal(t, output.Commit == commits[10], output.Frozen, output.Commit)
+	}
+
+	// and cannot be chosen
+	w.SetInputs([]string{commits[10]})
+	_, err = w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.Error(t, err)
+
+	_, err = w.UnfreezeOutput(commits[10])
+	assert.NoError(t, err)
+	assert.False(t, saved(10).Frozen)
+
+	// locked output cannot be chosen
+	w.SetInputs([]string{commits[10], commits[20]})
+	_, err = w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.Error(t, err)
+	assert.Equal(t, OutputStatus(OutputConfirmed), saved(10).Status)
+
+	// chosen outputs must cover the amount
+	w.SetInputs([]string{commits[10]})
+	_, err = w.Send(11, "cash", 0, "", SlateVersion4)
+	assert.Error(t, err)
+
+	_, err = w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+	assert.Equal(t, OutputStatus(OutputLocked), saved(10).Status)
+
+	_, err = w.FindOutput("")
+	assert.Error(t, err)
+	_, err = w.FindOutput("ff")
+	assert.Error(t, err)
+}
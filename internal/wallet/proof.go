@@ -0,0 +1,271 @@
+package wallet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Address is the public key of the wallet's address key, hex encoded
+func (t *Wallet) Address() (address string, err error) {
+	secret, err := t.addressSecret()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get addressSecret")
+	}
+
+	publicKey, err := t.pubKeyFromSecretKey(secret[:])
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create address public key")
+	}
+
+	return publicKey.Hex(t.context), nil
+}
+
+// PaymentProof returns json of the payment proof stored with the transaction by the sender
+func (t *Wallet) PaymentProof(transactionID []byte) (proofBytes []byte, err error) {
+	tx, err := t.db.GetTransaction(transactionID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetTransaction")
+	}
+
+	if tx.PaymentProof == nil {
+		return nil, errors.Errorf("transaction %v has no payment proof", string(transactionID))
+	}
+
+	proofBytes, err = json.Marshal(tx.PaymentProof)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal payment proof to json")
+	}
+
+	return
+}
+
+// VerifyPaymentProof checks signatures of the receiver and the sender, it does not check the kernel is in the ledger
+func VerifyPaymentProof(proofBytes []byte) (proof *PaymentProof, err error) {
+	proof = &PaymentProof{}
+
+	err = json.Unmarshal(proofBytes, proof)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal json to PaymentProof")
+	}
+
+	context, err := secp256k1.ContextCreate(secp256k1.ContextBoth)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ContextCreate")
+	}
+	defer secp256k1.ContextDestroy(context)
+
+	excessPublicKey, err := commitmentToPublicKeyHex(context, proof.Excess)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get public key of excess")
+	}
+
+	msg := paymentProofMessage(uint64(proof.Amount), proof.Asset, excessPublicKey, proof.SenderAddress)
+
+	err = verifyAddressSignature(context, proof.ReceiverSignature, proof.ReceiverAddress, msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot verify receiver signature")
+	}
+
+	err = verifyAddressSignature(context, proof.SenderSignature, proof.SenderAddress, msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot verify sender signature")
+	}
+
+	return
+}
+
+// signPaymentProof is called by the receiver to sign for the amount it receives in the response slate
+func (t *Wallet) signPaymentProof(slate *Slate) error {
+	proof := slate.PaymentProof
+
+	address, err := t.Address()
+	if err != nil {
+		return errors.Wrap(err, "cannot get Address")
+	}
+
+	if len(proof.ReceiverAddress) > 0 && proof.ReceiverAddress != address {
+		return errors.Errorf("slate is addressed to %v, not to this wallet %v", proof.ReceiverAddress, address)
+	}
+	proof.ReceiverAddress = address
+
+	excessPublicKey, err := t.slateExcessPublicKey(slate)
+	if err != nil {
+		return errors.Wrap(err, "cannot get slateExcessPublicKey")
+	}
+
+	msg := paymentProofMessage(uint64(slate.Amount), slate.Asset, excessPublicKey, proof.SenderAddress)
+	proof.ReceiverSignature, err = t.signWithAddress(msg)
+	if err != nil {
+		return errors.Wrap(err, "cannot signWithAddress")
+	}
+
+	return nil
+}
+
+// completePaymentProof is called by the sender to verify the receiver's signature in the response slate
+// and to countersign the proof for the transaction being finalized
+func (t *Wallet) completePaymentProof(responseSlate *Slate, senderSlate *SavedSlate, tx *core.Transaction) (proof *PaymentProof, err error) {
+	if responseSlate.PaymentProof == nil || len(responseSlate.PaymentProof.ReceiverSignature) == 0 {
+		return nil, errors.New("response slate is missing receiver's payment proof signature")
+	}
+
+	address, err := t.Address()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get Address")
+	}
+
+	if responseSlate.PaymentProof.SenderAddress != address {
+		return nil, errors.Errorf("payment proof is for sender %v, not for this wallet %v", responseSlate.PaymentProof.SenderAddress, address)
+	}
+
+	expectedReceiverAddress := senderSlate.PaymentProof.ReceiverAddress
+	if len(expectedReceiverAddress) > 0 && responseSlate.PaymentProof.ReceiverAddress != expectedReceiverAddress {
+		return nil, errors.Errorf("payment proof is signed by %v, not by the receiver %v", responseSlate.PaymentProof.ReceiverAddress, expectedReceiverAddress)
+	}
+
+	kernel, err := ledger.FullKernel(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get FullKernel")
+	}
+
+	proof = &PaymentProof{
+		Amount:            senderSlate.Amount,
+		Asset:             senderSlate.Asset,
+		Excess:            kernel.Excess,
+		SenderAddress:     address,
+		ReceiverAddress:   responseSlate.PaymentProof.ReceiverAddress,
+		ReceiverSignature: responseSlate.PaymentProof.ReceiverSignature,
+	}
+
+	excessPublicKey, err := commitmentToPublicKeyHex(t.context, proof.Excess)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get public key of excess")
+	}
+
+	msg := paymentProofMessage(uint64(proof.Amount), proof.Asset, excessPublicKey, proof.SenderAddress)
+
+	err = verifyAddressSignature(t.context, proof.ReceiverSignature, proof.ReceiverAddress, msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot verify receiver signature")
+	}
+
+	proof.SenderSignature, err = t.signWithAddress(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot signWithAddress")
+	}
+
+	return
+}
+
+// slateExcessPublicKey calculates public key of the kernel excess as it will be recorded in the ledger
+// from public blinds of all participants and kernel offset, as compact slates do not carry everyone's inputs and outputs:
+// KE + offset*G = sum(public blinds) + offset*G
+func (t *Wallet) slateExcessPublicKey(slate *Slate) (string, error) {
+	var publicKeys []*secp256k1.PublicKey
+
+	for _, participant := range slate.ParticipantData {
+		publicBlind := t.context.PublicKeyFromHex(participant.PublicBlindExcess)
+		if publicBlind == nil {
+			return "", errors.Errorf("cannot parse public blind excess of participant %d", participant.ID)
+		}
+		publicKeys = append(publicKeys, publicBlind)
+	}
+
+	offsetBytes, err := hex.DecodeString(slate.Transaction.Offset)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot decode kernel offset from hex")
+	}
+
+	publicOffset, err := t.pubKeyFromSecretKey(offsetBytes)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create public kernel offset")
+	}
+	publicKeys = append(publicKeys, publicOffset)
+
+	sum, err := t.sumPubKeys(publicKeys)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot sumPubKeys")
+	}
+
+	return sum.Hex(t.context), nil
+}
+
+func commitmentToPublicKeyHex(context *secp256k1.Context, commit string) (string, error) {
+	commitment, err := secp256k1.CommitmentFromString(commit)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot CommitmentFromString")
+	}
+
+	publicKey, err := secp256k1.CommitmentToPublicKey(context, commitment)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot CommitmentToPublicKey")
+	}
+
+	return publicKey.Hex(context), nil
+}
+func (t *Wallet) signWithAddress(msg [32]byte) (string, error) {
+	secret, err := t.addressSecret()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get addressSecret")
+	}
+
+	sig, _, err := secp256k1.SchnorrsigSign(t.context, msg, secret)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot SchnorrsigSign")
+	}
+
+	sigBytes, err := secp256k1.SchnorrsigSerialize(t.context, sig)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot SchnorrsigSerialize")
+	}
+
+	return hex.EncodeToString(sigBytes), nil
+}
+
+func verifyAddressSignature(context *secp256k1.Context, signature string, address string, msg [32]byte) error {
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "cannot decode signature from hex")
+	}
+
+	sig, err := secp256k1.SchnorrsigParse(context, sigBytes)
+	if err != nil {
+		return errors.Wrap(err, "cannot SchnorrsigParse")
+	}
+
+	publicKey := context.PublicKeyFromHex(address)
+	if publicKey == nil {
+		return errors.Errorf("cannot parse address %v", address)
+	}
+
+	err = secp256k1.SchnorrsigVerify(context, sig, msg[:], publicKey)
+	if err != nil {
+		return errors.Wrap(err, "cannot SchnorrsigVerify")
+	}
+
+	return nil
+}
+
+// msg = hash(amount || asset || public key of excess || sender address)
+func paymentProofMessage(amount uint64, asset string, excessPublicKey string, senderAddress string) [32]byte {
+	amountBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(amountBytes, amount)
+
+	hash, _ := blake2b.New256(nil)
+	hash.Write(amountBytes)
+	hash.Write([]byte(asset))
+	hash.Write([]byte(excessPublicKey))
+	hash.Write([]byte(senderAddress))
+
+	var msg [32]byte
+	copy(msg[:], hash.Sum(nil))
+
+	return msg
+}
@@ -0,0 +1,148 @@
+package wallet
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Report is what the wallet holds in the current account, in a form for scripts to read
+type Report struct {
+	Account      string              `json:"account"`
+	Outputs      []OutputReport      `json:"outputs"`
+	Slates       []SlateReport       `json:"slates"`
+	Transactions []TransactionReport `json:"transactions"`
+}
+
+type OutputReport struct {
+	Commit   string `json:"commit"`
+	Value    uint64 `json:"value"`
+	Asset    string `json:"asset"`
+	Status   string `json:"status"`
+	Features string `json:"features"`
+	// child key index of the output in the account
+	Key      uint32 `json:"key"`
+	Frozen   bool   `json:"frozen,omitempty"`
+	Multisig bool   `json:"multisig,omitempty"`
+}
+
+// SlateReport leaves out secrets of the slate
+type SlateReport struct {
+	ID            string   `json:"id"`
+	Amount        uint64   `json:"amount,omitempty"`
+	Asset         string   `json:"asset,omitempty"`
+	ReceiveAmount uint64   `json:"receive_amount,omitempty"`
+	ReceiveAsset  string   `json:"receive_asset,omitempty"`
+	Inputs        []string `json:"inputs"`
+	Outputs       []string `json:"outputs"`
+	// Expiry is of slates still waiting for the counterparty
+	Expiry *Expiry `json:"expiry,omitempty"`
+}
+
+type TransactionReport struct {
+	ID      string   `json:"id"`
+	Status  string   `json:"status"`
+	Inputs  []string `json:"inputs"`
+	Outputs []string `json:"outputs"`
+}
+
+// Report lists outputs of the current account, the latest key first, its slates and transactions
+func (t *Wallet) Report() (report Report, err error) {
+	report = Report{
+		Account:      t.account.Name,
+		Outputs:      make([]OutputReport, 0),
+		Slates:       make([]SlateReport, 0),
+		Transactions: make([]TransactionReport, 0),
+	}
+
+	outputs, err := t.db.ListOutputs()
+	if err != nil {
+		return report, errors.Wrap(err, "cannot ListOutputs")
+	}
+	for _, output := range outputs {
+		if output.Account != t.account.Number {
+			continue
+		}
+		report.Outputs = append(report.Outputs, OutputReport{
+			Commit:   output.Commit,
+			Value:    output.Value,
+			Asset:    output.Asset,
+			Status:   output.Status.String(),
+			Features: output.Features.String(),
+			Key:      output.Index,
+			Frozen:   output.Frozen,
+			Multisig: output.Multisig,
+		})
+	}
+
+	// sort outputs decreasing by child key index
+	sort.Slice(report.Outputs, func(i, j int) bool {
+		return report.Outputs[i].Key > report.Outputs[j].Key
+	})
+
+	slates, err := t.db.ListSlates()
+	if err != nil {
+		return report, errors.Wrap(err, "cannot ListSlates")
+	}
+	transactions, err := t.db.ListTransactions()
+	if err != nil {
+		return report, errors.Wrap(err, "cannot ListTransactions")
+	}
+	finished := make(map[string]bool)
+	for _, tx := range transactions {
+		finished[tx.ID.String()] = true
+	}
+
+	for _, slate := range slates {
+		if slate.Account != t.account.Number {
+			continue
+		}
+		id, _ := slate.ID.MarshalText()
+
+		slateReport := SlateReport{
+			ID:            string(id),
+			Amount:        uint64(slate.Amount),
+			Asset:         slate.Asset,
+			ReceiveAmount: uint64(slate.ReceiveAmount),
+			ReceiveAsset:  slate.ReceiveAsset,
+			Inputs:        make([]string, 0),
+			Outputs:       make([]string, 0),
+		}
+		for _, input := range slate.Transaction.Body.Inputs {
+			slateReport.Inputs = append(slateReport.Inputs, input.Commit)
+		}
+		for _, output := range slate.Transaction.Body.Outputs {
+			slateReport.Outputs = append(slateReport.Outputs, output.Commit)
+		}
+		// only slates still waiting for the counterparty expire
+		if !finished[string(id)] {
+			slateReport.Expiry = slate.Expiry
+		}
+
+		report.Slates = append(report.Slates, slateReport)
+	}
+
+	for _, tx := range transactions {
+		if tx.Account != t.account.Number {
+			continue
+		}
+		id, _ := tx.ID.MarshalText()
+
+		transactionReport := TransactionReport{
+			ID:      string(id),
+			Status:  tx.Status.String(),
+			Inputs:  make([]string, 0),
+			Outputs: make([]string, 0),
+		}
+		for _, input := range tx.Transaction.Body.Inputs {
+			transactionReport.Inputs = append(transactionReport.Inputs, input.Commit)
+		}
+		for _, output := range tx.Transaction.Body.Outputs {
+			transactionReport.Outputs = append(transactionReport.Outputs, output.Commit)
+		}
+
+		report.Transactions = append(report.Transactions, transactionReport)
+	}
+
+	return
+}
@@ -0,0 +1,54 @@
+package wallet
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	issueBytes, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+	issue := ledger.Issue{}
+	err = json.Unmarshal(issueBytes, &issue)
+	assert.NoError(t, err)
+
+	w.SetFee(1)
+
+	slateBytes, err := w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+	id, err := ParseIDFromSlate(slateBytes)
+	assert.NoError(t, err)
+
+	report, err := w.Report()
+	assert.NoError(t, err)
+	assert.Equal(t, "default", report.Account)
+
+	assert.Equal(t, 2, len(report.Outputs))
+	issued := report.Outputs[len(report.Outputs)-1]
+	assert.Equal(t, issue.Output.Commit, issued.Commit)
+	assert.Equal(t, uint64(10), issued.Value)
+	assert.Equal(t, "Locked", issued.Status)
+	assert.Equal(t, "Coinbase", issued.Features)
+
+	assert.Equal(t, 1, len(report.Slates))
+	assert.Equal(t, string(id), report.Slates[0].ID)
+	assert.Equal(t, uint64(3), report.Slates[0].Amount)
+	assert.Equal(t, []string{issue.Output.Commit}, report.Slates[0].Inputs)
+	assert.NotNil(t, report.Slates[0].Expiry)
+
+	// the issue is in the history
+	assert.Equal(t, 1, len(report.Transactions))
+	assert.Equal(t, "Confirmed", report.Transactions[0].Status)
+
+	// secrets of slates are not reported
+	reportBytes, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(reportBytes), "blind")
+	assert.NotContains(t, string(reportBytes), "nonce")
+}
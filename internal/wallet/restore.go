@@ -0,0 +1,194 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrNotOurs is the cause of the error Rewind returns for an output not made with keys of this wallet
+var ErrNotOurs = errors.New("output is not made with keys of this wallet")
+
+// assetIDSize is how many bytes of the asset hash are embedded in the bulletproof message after the key path
+const assetIDSize = 12
+
+// Restore finds outputs made with keys of this wallet among unspent outputs of the ledger and saves them.
+// Outputs are recognized by rewinding their bulletproofs, see Rewind.
+// Multisig outputs are not restored as their bulletproofs are made with a nonce shared by both parties
+func (t *Wallet) Restore(outputs []core.Output, assets []string) (restored []Output, err error) {
+	// last key index found in each account
+	lastIndexes := map[uint32]uint32{}
+
+	for _, o := range outputs {
+		_, e := t.db.GetOutput(o.Commit)
+		if e == nil {
+			// already in the wallet
+			continue
+		}
+		if errors.Cause(e) != leveldb.ErrNotFound {
+			return nil, errors.Wrap(e, "cannot GetOutput")
+		}
+
+		output, e := t.Rewind(o, assets)
+		if errors.Cause(e) == ErrNotOurs {
+			continue
+		}
+		if e != nil {
+			return nil, errors.Wrapf(e, "cannot Rewind output %v", o.Commit)
+		}
+
+		_, err = t.accountByNumber(output.Account)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get accountByNumber")
+		}
+
+		output.Status = OutputConfirmed
+
+		err = t.db.PutOutput(output)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+		restored = append(restored, output)
+
+		if last, ok := lastIndexes[output.Account]; !ok || output.Index > last {
+			lastIndexes[output.Account] = output.Index
+		}
+	}
+
+	// new keys must not collide with the restored ones
+	for account, index := range lastIndexes {
+		err = t.db.PutIndex(account, index)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutIndex")
+		}
+	}
+
+	return
+}
+
+// Rewind recovers value, asset, account and key index of an output made by this wallet from its bulletproof.
+// The proof is rewound with the nonce derived from the rewind key, its message holds the key path and the asset id,
+// the asset is the one among assets with this id. The output is ours only if the key at the path commits to the value,
+// the cause of the error is ErrNotOurs when it is not. Outputs made before accounts with keys at m / index,
+// and those blinded with the key itself before switch commitments, are recognized too
+func (t *Wallet) Rewind(output core.Output, assets []string) (walletOutput Output, err error) {
+	proof, err := hex.DecodeString(output.Proof)
+	if err != nil {
+		err = errors.Wrap(err, "cannot decode proof from hex")
+		return
+	}
+
+	commitment, err := secp256k1.CommitmentFromString(output.Commit)
+	if err != nil {
+		err = errors.Wrap(err, "cannot decode commitment")
+		return
+	}
+
+	rewindNonce, err := t.rewindNonce(commitment)
+	if err != nil {
+		err = errors.Wrap(err, "cannot get rewindNonce")
+		return
+	}
+
+	commitValue, message, err := rewindBulletproof(proof, commitment, rewindNonce[:])
+	if err != nil {
+		err = errors.Wrap(err, "cannot rewindBulletproof")
+		return
+	}
+
+	account := binary.BigEndian.Uint32(message[:4])
+	index := binary.BigEndian.Uint32(message[4:8])
+
+	var asset string
+	found := false
+	for _, a := range assets {
+		id := assetID(a)
+		if bytes.Equal(message[8:8+assetIDSize], id[:]) {
+			asset = a
+			found = true
+			break
+		}
+	}
+	if !found {
+		err = errors.Wrap(ErrNotOurs, "cannot find asset of output")
+		return
+	}
+
+	// current keys first, legacy ones are of the default account only
+	schemes := []keyScheme{{accountPath: true, switchCommit: true}}
+	if account == 0 {
+		schemes = append(schemes, keyScheme{accountPath: false, switchCommit: true}, keyScheme{})
+	}
+
+	for _, scheme := range schemes {
+		walletOutput = Output{
+			Output:       output,
+			Account:      account,
+			Index:        index,
+			Value:        commitValue / ledger.CommitValue(1, asset),
+			Asset:        asset,
+			SwitchCommit: scheme.switchCommit,
+			AccountPath:  scheme.accountPath,
+		}
+
+		blind, e := t.outputBlind(walletOutput)
+		if e != nil {
+			return Output{}, errors.Wrapf(e, "cannot get outputBlind for account %d key index %d", account, index)
+		}
+
+		ours, e := secp256k1.Commit(t.context, blind[:], commitValue, &secp256k1.GeneratorH, &secp256k1.GeneratorG)
+		if e != nil {
+			return Output{}, errors.Wrap(e, "cannot create commitment to value")
+		}
+
+		if ours.String() == output.Commit {
+			return walletOutput, nil
+		}
+	}
+
+	return Output{}, errors.Wrapf(ErrNotOurs, "output is not committed with account %d key index %d", account, index)
+}
+
+// keyScheme is how the key and the blind of an output were derived
+type keyScheme struct {
+	accountPath  bool
+	switchCommit bool
+}
+
+// rewindNonce is the bulletproof nonce of the output with the commitment, only the wallet with the rewind key knows it
+func (t *Wallet) rewindNonce(commitment *secp256k1.Commitment) (nonce [32]byte, err error) {
+	rewindKey, err := t.secret(rewindKeyIndex)
+	if err != nil {
+		err = errors.Wrap(err, "cannot get rewind secret")
+		return
+	}
+
+	commitBytes := commitment.Bytes()
+	nonce = blake2b.Sum256(append(rewindKey[:], commitBytes[:]...))
+
+	return
+}
+
+// proofMessage is embedded in the bulletproof of an output: 4 bytes of the account and 4 of the key index
+// followed by the asset id
+func proofMessage(account uint32, index uint32, asset string) (message [20]byte) {
+	binary.BigEndian.PutUint32(message[:4], account)
+	binary.BigEndian.PutUint32(message[4:8], index)
+	id := assetID(asset)
+	copy(message[8:], id[:])
+	return
+}
+
+// assetID identifies the asset of an output in its bulletproof message
+func assetID(asset string) (id [assetIDSize]byte) {
+	hash := blake2b.Sum256([]byte(asset))
+	copy(id[:], hash[:assetIDSize])
+	return
+}
@@ -0,0 +1,139 @@
+package wallet
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestore(t *testing.T) {
+	dir := testDbDir() + "_original"
+	err := os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	original, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer original.Close()
+
+	mnemonic, err := original.InitMasterKey("", "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	for _, value := range []uint64{1, 2, 3} {
+		_, err = original.Issue(value, "cash")
+		assert.NoError(t, err)
+	}
+	_, err = original.Issue(5, "apple")
+	assert.NoError(t, err)
+
+	outputs, err := original.db.ListOutputs()
+	assert.NoError(t, err)
+
+	// the ledger lists outputs of other wallets too
+	dir = testDbDir() + "_other"
+	err = os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	other, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer other.Close()
+	_, err = other.InitMasterKey("", "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+	_, err = other.Issue(7, "cash")
+	assert.NoError(t, err)
+	otherOutputs, err := other.db.ListOutputs()
+	assert.NoError(t, err)
+
+	var ledgerOutputs []core.Output
+	for _, o := range append(outputs, otherOutputs...) {
+		ledgerOutputs = append(ledgerOutputs, o.Output)
+	}
+
+	// recreate the key from the mnemonic in an empty wallet
+	dir = testDbDir() + "_restored"
+	err = os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	restored, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	_, err = restored.InitMasterKey(mnemonic, "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	restoredOutputs, err := restored.Restore(ledgerOutputs, []string{"apple", "cash"})
+	assert.NoError(t, err)
+	assert.Equal(t, len(outputs), len(restoredOutputs))
+
+	for _, o := range outputs {
+		r, err := restored.db.GetOutput(o.Commit)
+		assert.NoError(t, err)
+		assert.Equal(t, o.Index, r.Index)
+		assert.Equal(t, o.Value, r.Value)
+		assert.Equal(t, o.Asset, r.Asset)
+		assert.Equal(t, OutputConfirmed, int(r.Status))
+	}
+
+	// restored outputs can be spent and new keys do not collide with them
+	_, err = restored.Send(4, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	// restoring again finds nothing new
+	restoredOutputs, err = restored.Restore(ledgerOutputs, []string{"apple", "cash"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(restoredOutputs))
+
+	// an output that cannot be rewound is an error, not an output of another wallet
+	malformed := otherOutputs[0].Output
+	malformed.Proof = "not hex"
+	_, err = restored.Restore([]core.Output{malformed}, []string{"apple", "cash"})
+	assert.Error(t, err)
+}
+
+func TestRewind(t *testing.T) {
+	dir := testDbDir() + "_rewind"
+	err := os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	w, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer w.Close()
+	_, err = w.InitMasterKey("", "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	_, err = w.Issue(42, "apple")
+	assert.NoError(t, err)
+
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(outputs))
+	output := outputs[0]
+
+	rewound, err := w.Rewind(output.Output, []string{"cash", "apple"})
+	assert.NoError(t, err)
+	assert.Equal(t, output.Value, rewound.Value)
+	assert.Equal(t, "apple", rewound.Asset)
+	assert.Equal(t, output.Account, rewound.Account)
+	assert.Equal(t, output.Index, rewound.Index)
+	assert.True(t, rewound.SwitchCommit)
+
+	// asset must be among the ones given
+	_, err = w.Rewind(output.Output, []string{"cash"})
+	assert.Equal(t, ErrNotOurs, errors.Cause(err))
+
+	// another wallet does not know the rewind nonce
+	dir = testDbDir() + "_rewind_other"
+	err = os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	other, err := NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer other.Close()
+	_, err = other.InitMasterKey("", "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	_, err = other.Rewind(output.Output, []string{"cash", "apple"})
+	assert.Equal(t, ErrNotOurs, errors.Cause(err))
+}
@@ -0,0 +1,324 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// names of coin selection strategies
+const (
+	// SelectionSmallest spends the smallest outputs first, consolidating dust but using more inputs
+	SelectionSmallest = "smallest"
+	// SelectionLargest spends the largest outputs first, using fewer inputs but fragmenting the wallet over time
+	SelectionLargest = "largest"
+	// SelectionExact searches for outputs summing up to the amount and the fee to avoid a change output,
+	// falls back to SelectionSmallest when there is no such match
+	SelectionExact = "exact"
+	// SelectionRandom spends outputs in random order so the choice does not reveal which outputs the wallet holds
+	SelectionRandom = "random"
+)
+
+// DefaultSelection is the strategy of a wallet until another one is set with SetDefaultSelection
+const DefaultSelection = SelectionSmallest
+
+// Selections lists names of all coin selection strategies
+var Selections = []string{SelectionSmallest, SelectionLargest, SelectionExact, SelectionRandom}
+
+// limit of branches explored by SelectionExact before it falls back
+const maxBranchAndBoundTries = 100000
+
+// FeeFunc returns the fee of a transaction spending numInputs, with a change output or without one
+type FeeFunc func(numInputs int, change bool) uint64
+
+// noFee is the fee function of transactions that carry no fee
+func noFee(numInputs int, change bool) uint64 {
+	return 0
+}
+
+// CoinSelection picks which of the spendable outputs become inputs covering the amount and the fee for spending them.
+// What is left over goes into change, unless it is worth less than adding the change output costs, then it goes into the fee.
+type CoinSelection interface {
+	Select(outputs []Output, amount uint64, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error)
+}
+
+func NewCoinSelection(name string) (selection CoinSelection, err error) {
+	switch name {
+	case SelectionSmallest:
+		return smallestFirst{}, nil
+	case SelectionLargest:
+		return largestFirst{}, nil
+	case SelectionExact:
+		return branchAndBound{}, nil
+	case SelectionRandom:
+		return randomOrder{}, nil
+	default:
+		return nil, errors.Errorf("unknown coin selection %v, expected one of %v", name, Selections)
+	}
+}
+
+type smallestFirst struct{}
+
+func (smallestFirst) Select(outputs []Output, amount uint64, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error) {
+	sorted := sortByValue(outputs, false)
+	return accumulate(sorted, amount, fee)
+}
+
+type largestFirst struct{}
+
+func (largestFirst) Select(outputs []Output, amount uint64, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error) {
+	sorted := sortByValue(outputs, true)
+	return accumulate(sorted, amount, fee)
+}
+
+type randomOrder struct{}
+
+func (randomOrder) Select(outputs []Output, amount uint64, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error) {
+	shuffled := append([]Output{}, outputs...)
+
+	// Fisher-Yates shuffle
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j, e := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if e != nil {
+			err = errors.Wrap(e, "cannot get random index")
+			return
+		}
+		shuffled[i], shuffled[j.Int64()] = shuffled[j.Int64()], shuffled[i]
+	}
+
+	return accumulate(shuffled, amount, fee)
+}
+
+type branchAndBound struct{}
+
+// Select explores subsets of outputs largest first, including then excluding each, and stops at the first one
+// within cost of a change output of the amount and the fee. The search is pruned when the sum overshoots,
+// assuming every output is worth more than the fee for spending it, or when the outputs left cannot reach the amount.
+func (branchAndBound) Select(outputs []Output, amount uint64, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error) {
+	sorted := sortByValue(outputs, true)
+
+	var remaining uint64
+	for _, output := range sorted {
+		remaining += output.Value
+	}
+
+	tries := 0
+	selected := make([]Output, 0)
+
+	var search func(i int, sum uint64, remaining uint64) bool
+	search = func(i int, sum uint64, remaining uint64) bool {
+		tries++
+		if tries > maxBranchAndBoundTries {
+			return false
+		}
+
+		n := len(selected)
+		if sum >= amount+fee(n, false) && sum <= amount+fee(n, true) {
+			return true
+		}
+		if sum > amount+fee(n, true) || i == len(sorted) || sum+remaining < amount {
+			return false
+		}
+
+		selected = append(selected, sorted[i])
+		if search(i+1, sum+sorted[i].Value, remaining-sorted[i].Value) {
+			return true
+		}
+		selected = selected[:n]
+
+		return search(i+1, sum, remaining-sorted[i].Value)
+	}
+
+	if !search(0, 0, remaining) {
+		return smallestFirst{}.Select(outputs, amount, fee)
+	}
+
+	var sum uint64
+	for _, input := range selected {
+		sum += input.Value
+	}
+
+	return selected, 0, sum - amount, nil
+}
+
+// sortByValue returns a copy of outputs sorted increasing by value, or decreasing
+func sortByValue(outputs []Output, decreasing bool) (sorted []Output) {
+	sorted = append([]Output{}, outputs...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if decreasing {
+			return sorted[i].Value > sorted[j].Value
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+
+	return
+}
+
+// accumulate takes outputs in their order till they cover the amount and the fee
+func accumulate(outputs []Output, amount uint64, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error) {
+	inputs = make([]Output, 0)
+
+	var sum uint64
+
+	for i := 0; i <= len(outputs); i++ {
+		if i > 0 {
+			sum += outputs[i-1].Value
+			inputs = append(inputs, outputs[i-1])
+		}
+
+		change, feeValue, ok := settle(sum, len(inputs), amount, fee)
+		if ok {
+			return inputs, change, feeValue, nil
+		}
+	}
+
+	return nil, 0, 0, errors.New("sum of sender input values is less than the amount to send and the fee")
+}
+
+// settle splits the sum of inputs over the amount into change and the fee, ok is false when it does not cover them
+func settle(sum uint64, numInputs int, amount uint64, fee FeeFunc) (change uint64, feeValue uint64, ok bool) {
+	if sum < amount+fee(numInputs, false) {
+		return 0, 0, false
+	}
+
+	// leftover not worth a change output goes into the fee
+	if sum <= amount+fee(numInputs, true) {
+		return 0, sum - amount, true
+	}
+
+	return sum - amount - fee(numInputs, true), fee(numInputs, true), true
+}
+
+// allOutputs spends exactly the outputs the user has chosen
+type allOutputs struct{}
+
+func (allOutputs) Select(outputs []Output, amount uint64, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error) {
+	var sum uint64
+	for _, output := range outputs {
+		sum += output.Value
+	}
+
+	change, feeValue, ok := settle(sum, len(outputs), amount, fee)
+	if !ok {
+		return nil, 0, 0, errors.New("sum of chosen input values is less than the amount to send and the fee")
+	}
+
+	return outputs, change, feeValue, nil
+}
+
+// selectInputs picks outputs of the current account to spend with the wallet's coin selection and locks them,
+// as they are now inputs to a new transaction
+func (t *Wallet) selectInputs(amount uint64, asset string, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error) {
+	inputs, change, feeValue, err = t.pickInputs(amount, asset, fee)
+	if err != nil {
+		err = errors.Wrap(err, "cannot pickInputs")
+		return
+	}
+
+	err = t.lockInputs(inputs)
+	if err != nil {
+		err = errors.Wrap(err, "cannot lockInputs")
+		return
+	}
+
+	return
+}
+
+// pickInputs picks outputs of the current account to spend with the wallet's coin selection without locking them
+func (t *Wallet) pickInputs(amount uint64, asset string, fee FeeFunc) (inputs []Output, change uint64, feeValue uint64, err error) {
+	if len(t.inputs) > 0 {
+		outputs, e := t.chosenInputs(asset)
+		if e != nil {
+			err = errors.Wrap(e, "cannot get chosenInputs")
+			return
+		}
+		inputs, change, feeValue, err = allOutputs{}.Select(outputs, amount, fee)
+		if err != nil {
+			err = errors.Wrap(err, "cannot spend chosen inputs")
+			return
+		}
+	} else {
+		outputs, e := t.db.ListSpendable(t.account.Number, asset)
+		if e != nil {
+			err = errors.Wrap(e, "cannot ListSpendable")
+			return
+		}
+
+		selection, e := NewCoinSelection(t.selection)
+		if e != nil {
+			err = errors.Wrap(e, "cannot NewCoinSelection")
+			return
+		}
+
+		inputs, change, feeValue, err = selection.Select(outputs, amount, fee)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot select inputs with %v coin selection", t.selection)
+			return
+		}
+	}
+
+	return
+}
+
+// lockInputs keeps outputs from being picked again while they are inputs of a transaction
+func (t *Wallet) lockInputs(inputs []Output) error {
+	for _, input := range inputs {
+		input.Status = OutputLocked
+		err := t.db.PutOutput(input)
+		if err != nil {
+			return errors.Wrap(err, "cannot lock input")
+		}
+	}
+
+	return nil
+}
+
+// loadSelection makes the coin selection saved for the wallet the one used to pick inputs
+func (t *Wallet) loadSelection() (err error) {
+	name, err := t.db.GetSelection()
+	if errors.Cause(err) == leveldb.ErrNotFound {
+		name = DefaultSelection
+	} else if err != nil {
+		return errors.Wrap(err, "cannot GetSelection")
+	}
+
+	t.selection = name
+
+	return nil
+}
+
+// Selection is the name of the coin selection used to pick inputs
+func (t *Wallet) Selection() string {
+	return t.selection
+}
+
+// SetSelection changes coin selection until the wallet is closed
+func (t *Wallet) SetSelection(name string) error {
+	_, err := NewCoinSelection(name)
+	if err != nil {
+		return errors.Wrap(err, "cannot NewCoinSelection")
+	}
+
+	t.selection = name
+
+	return nil
+}
+
+// SetDefaultSelection changes coin selection and saves it for the wallet
+func (t *Wallet) SetDefaultSelection(name string) error {
+	err := t.SetSelection(name)
+	if err != nil {
+		return errors.Wrap(err, "cannot SetSelection")
+	}
+
+	err = t.db.PutSelection(name)
+	if err != nil {
+		return errors.Wrap(err, "cannot PutSelection")
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testOutputs(values ...uint64) (outputs []Output) {
+	for i, value := range values {
+		outputs = append(outputs, Output{Index: uint32(i), Value: value})
+	}
+	return
+}
+
+func inputValues(inputs []Output) (values []uint64) {
+	for _, input := range inputs {
+		values = append(values, input.Value)
+	}
+	return
+}
+
+// linearFee charges 1 per input and 2 per change output
+func linearFee(numInputs int, change bool) uint64 {
+	fee := uint64(numInputs)
+	if change {
+		fee += 2
+	}
+	return fee
+}
+
+func TestCoinSelection(t *testing.T) {
+	outputs := testOutputs(5, 1, 10, 3, 7)
+
+	inputs, change, fee, err := smallestFirst{}.Select(outputs, 8, noFee)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 3, 5}, inputValues(inputs))
+	assert.Equal(t, uint64(1), change)
+	assert.Equal(t, uint64(0), fee)
+
+	inputs, change, fee, err = largestFirst{}.Select(outputs, 8, noFee)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{10}, inputValues(inputs))
+	assert.Equal(t, uint64(2), change)
+
+	inputs, change, fee, err = branchAndBound{}.Select(outputs, 8, noFee)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{7, 1}, inputValues(inputs))
+	assert.Equal(t, uint64(0), change)
+
+	// no exact match falls back to smallest first
+	inputs, change, fee, err = branchAndBound{}.Select(testOutputs(4, 6), 5, noFee)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{4, 6}, inputValues(inputs))
+	assert.Equal(t, uint64(5), change)
+
+	for i := 0; i < 10; i++ {
+		inputs, change, fee, err = randomOrder{}.Select(outputs, 8, noFee)
+		assert.NoError(t, err)
+		var sum uint64
+		for _, value := range inputValues(inputs) {
+			sum += value
+		}
+		assert.Equal(t, sum, 8+change)
+	}
+
+	for _, name := range Selections {
+		selection, err := NewCoinSelection(name)
+		assert.NoError(t, err)
+
+		_, _, _, err = selection.Select(outputs, 27, noFee)
+		assert.Error(t, err)
+
+		inputs, change, fee, err = selection.Select(outputs, 26, noFee)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, len(inputs))
+		assert.Equal(t, uint64(0), change)
+
+		inputs, _, _, err = selection.Select(outputs, 0, noFee)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(inputs))
+	}
+
+	_, err = NewCoinSelection("unknown")
+	assert.Error(t, err)
+}
+
+func TestCoinSelectionFee(t *testing.T) {
+	outputs := testOutputs(5, 1, 10, 3, 7)
+
+	// 10 covers 8 and the fee of 1 input and a change output of 1 in it would cost 2 more, so it goes to the fee
+	inputs, change, fee, err := largestFirst{}.Select(outputs, 8, linearFee)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{10}, inputValues(inputs))
+	assert.Equal(t, uint64(0), change)
+	assert.Equal(t, uint64(2), fee)
+
+	// 1, 3 and 5 are less than 8 plus the fee for 3 inputs, 7 is added and pays for change
+	inputs, change, fee, err = smallestFirst{}.Select(outputs, 8, linearFee)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 3, 5, 7}, inputValues(inputs))
+	assert.Equal(t, uint64(2), change)
+	assert.Equal(t, uint64(6), fee)
+
+	// 7 and 3 pay 8 and the fee for 2 inputs exactly
+	inputs, change, fee, err = branchAndBound{}.Select(testOutputs(7, 3, 12), 8, linearFee)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{7, 3}, inputValues(inputs))
+	assert.Equal(t, uint64(0), change)
+	assert.Equal(t, uint64(2), fee)
+
+	_, _, _, err = smallestFirst{}.Select(outputs, 22, linearFee)
+	assert.Error(t, err)
+}
+
+func TestSelection(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	assert.Equal(t, DefaultSelection, w.Selection())
+
+	_, err := w.Issue(5, "cash")
+	assert.NoError(t, err)
+	_, err = w.Issue(10, "cash")
+	assert.NoError(t, err)
+
+	err = w.SetDefaultSelection("unknown")
+	assert.Error(t, err)
+
+	err = w.SetDefaultSelection(SelectionLargest)
+	assert.NoError(t, err)
+
+	err = w.loadSelection()
+	assert.NoError(t, err)
+	assert.Equal(t, SelectionLargest, w.Selection())
+
+	_, err = w.Send(4, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+	for _, output := range outputs {
+		if output.Value == 10 {
+			assert.Equal(t, OutputStatus(OutputLocked), output.Status)
+		}
+		if output.Value == 5 {
+			assert.Equal(t, OutputStatus(OutputConfirmed), output.Status)
+		}
+	}
+}
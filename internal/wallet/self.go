@@ -0,0 +1,198 @@
+package wallet
+
+import (
+	"encoding/hex"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/blockcypher/libgrin/libwallet"
+	"github.com/google/uuid"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/pkg/errors"
+)
+
+// Consolidate merges all spendable outputs of the asset in the current account into one, paying the fee from them
+func (t *Wallet) Consolidate(asset string) (txBytes []byte, err error) {
+	outputs, err := t.db.ListSpendable(t.account.Number, asset)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListSpendable")
+	}
+
+	if len(outputs) < 2 {
+		return nil, errors.Errorf("need at least 2 outputs of asset %v to consolidate, have %d", asset, len(outputs))
+	}
+
+	// the merged output is what is left after the fee, as change of a transaction sending nothing
+	inputs, change, fee, err := allOutputs{}.Select(outputs, 0, t.feeFunc(0))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot spend outputs")
+	}
+
+	if change == 0 {
+		return nil, errors.New("outputs are not worth the fee to consolidate them")
+	}
+
+	txBytes, err = t.selfSpend(inputs, []uint64{change}, asset, fee)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot selfSpend")
+	}
+
+	return
+}
+
+// Split spends inputs of the current account to create count outputs sharing the amount equally,
+// to spend them in parallel; what is left of the inputs goes to change
+func (t *Wallet) Split(amount uint64, count int, asset string) (txBytes []byte, err error) {
+	if count < 2 {
+		return nil, errors.Errorf("need to split into at least 2 outputs, got %d", count)
+	}
+
+	if amount == 0 || amount%uint64(count) != 0 {
+		return nil, errors.Errorf("amount %d cannot be split into %d equal outputs", amount, count)
+	}
+
+	inputs, change, fee, err := t.pickInputs(amount, asset, t.feeFunc(count))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot pickInputs")
+	}
+
+	values := make([]uint64, count)
+	for i := range values {
+		values[i] = amount / uint64(count)
+	}
+	if change > 0 {
+		values = append(values, change)
+	}
+
+	txBytes, err = t.selfSpend(inputs, values, asset, fee)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot selfSpend")
+	}
+
+	return
+}
+
+// selfSpend creates a transaction spending own inputs to own outputs of these values, signed by this wallet alone,
+// and saves its outputs and the transaction to confirm when the network validates it. The inputs are locked only once
+// the transaction is built, so they stay spendable if it cannot be
+func (t *Wallet) selfSpend(walletInputs []Output, values []uint64, asset string, fee uint64) (txBytes []byte, err error) {
+	var inputsTotal, outputsTotal uint64
+	var inputs []core.Input
+	var inputBlinds, outputBlinds [][]byte
+
+	for _, input := range walletInputs {
+		inputsTotal += input.Value
+		secret, e := t.outputBlind(input)
+		if e != nil {
+			return nil, errors.Wrapf(e, "cannot get secret for input with key index %d", input.Index)
+		}
+		inputBlinds = append(inputBlinds, secret[:])
+		inputs = append(inputs, core.Input{Features: input.Features, Commit: input.Commit})
+	}
+
+	var outputs []Output
+	var coreOutputs []core.Output
+
+	for _, value := range values {
+		outputsTotal += value
+		output, blind, e := t.newOutput(value, core.PlainOutput, asset, OutputUnconfirmed)
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot create output")
+		}
+		outputBlinds = append(outputBlinds, blind)
+		outputs = append(outputs, *output)
+		coreOutputs = append(coreOutputs, output.Output)
+	}
+
+	if outputsTotal+fee != inputsTotal {
+		return nil, errors.New("amounts don't sum up (outputsTotal + fee != inputsTotal)")
+	}
+
+	blindExcess, err := secp256k1.BlindSum(t.context, outputBlinds, inputBlinds)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create blinding excess sum")
+	}
+
+	kernelOffset, err := t.nonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get nonce for kernelOffset")
+	}
+
+	// subtract kernel offset from blinding excess
+	blind, err := secp256k1.BlindSum(t.context, [][]byte{blindExcess[:]}, [][]byte{kernelOffset[:]})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot BlindSum")
+	}
+
+	nonce, err := t.nonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get nonce")
+	}
+
+	publicBlind, err := t.pubKeyFromSecretKey(blind[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publicBlind")
+	}
+
+	publicNonce, err := t.pubKeyFromSecretKey(nonce[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create publicNonce")
+	}
+
+	kernel := core.TxKernel{
+		Features: core.PlainKernel,
+		Fee:      core.Uint64(kernelFee(fee, asset)),
+	}
+
+	slate := &Slate{
+		Slate: libwallet.Slate{
+			NumParticipants: 1,
+			ID:              uuid.New(),
+			Transaction: core.Transaction{
+				Offset: hex.EncodeToString(kernelOffset[:]),
+				Body: core.TransactionBody{
+					Inputs:  inputs,
+					Outputs: coreOutputs,
+					Kernels: []core.TxKernel{kernel},
+				},
+			},
+			Fee: kernel.Fee,
+		},
+		Asset: asset,
+	}
+
+	msg := ledger.KernelSignatureMessage(kernel)
+
+	// the only participant's partial signature is the whole signature
+	partSig, err := secp256k1.AggsigSignPartial(t.context, blind[:], nonce[:], publicNonce, publicBlind, msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot calculate partial signature")
+	}
+
+	txBytes, tx, err := t.aggregateTransaction(slate, []*secp256k1.AggsigSignaturePartial{&partSig}, publicNonce, publicBlind, msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot aggregateTransaction")
+	}
+
+	tx.Account = t.account.Number
+	tx.setAmounts(0, "", 0, "", fee, asset)
+
+	err = t.lockInputs(walletInputs)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot lockInputs")
+	}
+
+	for _, o := range outputs {
+		err = t.db.PutOutput(o)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutOutput")
+		}
+	}
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	return
+}
@@ -0,0 +1,84 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func spendableValues(t *testing.T, w *Wallet, asset string) (values []uint64) {
+	outputs, err := w.db.ListSpendable(w.account.Number, asset)
+	assert.NoError(t, err)
+	for _, output := range outputs {
+		values = append(values, output.Value)
+	}
+	return
+}
+
+func TestConsolidateSplit(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	_, err := w.Consolidate("cash")
+	assert.Error(t, err)
+
+	for _, value := range []uint64{1, 2, 3, 4} {
+		_, err := w.Issue(value, "cash")
+		assert.NoError(t, err)
+	}
+
+	txBytes, err := w.Consolidate("cash")
+	assert.NoError(t, err)
+
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(tx.Body.Inputs))
+	assert.Equal(t, 1, len(tx.Body.Outputs))
+
+	err = w.Confirm([]byte(tx.ID.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{10}, spendableValues(t, w, "cash"))
+
+	_, err = w.Split(10, 3, "cash")
+	assert.Error(t, err)
+
+	w.SetFee(1)
+
+	txBytes, err = w.Split(6, 3, "cash")
+	assert.NoError(t, err)
+
+	tx, err = ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tx.Body.Inputs))
+	assert.Equal(t, core.Uint64(kernelFee(1, "cash")), tx.Body.Kernels[0].Fee)
+
+	err = w.Confirm([]byte(tx.ID.String()))
+	assert.NoError(t, err)
+
+	// 3 equal outputs and change of what is left after the fee
+	assert.ElementsMatch(t, []uint64{2, 2, 2, 3}, spendableValues(t, w, "cash"))
+}
+
+func TestSelfSpendFails(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	for _, value := range []uint64{1, 2} {
+		_, err := w.Issue(value, "cash")
+		assert.NoError(t, err)
+	}
+
+	outputs, err := w.db.ListSpendable(w.account.Number, "cash")
+	assert.NoError(t, err)
+
+	// a transaction that cannot be built leaves its inputs spendable
+	_, err = w.selfSpend(outputs, []uint64{4}, "cash", 0)
+	assert.Error(t, err)
+	assert.ElementsMatch(t, []uint64{1, 2}, spendableValues(t, w, "cash"))
+
+	_, err = w.Consolidate("cash")
+	assert.NoError(t, err)
+	assert.Empty(t, spendableValues(t, w, "cash"))
+}
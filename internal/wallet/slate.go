@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"time"
+
 	"github.com/blockcypher/libgrin/core"
 	"github.com/blockcypher/libgrin/libwallet"
 	"github.com/google/uuid"
 	"github.com/olegabu/go-mimblewimble/pkg/ledger"
 	"github.com/olegabu/go-secp256k1-zkp"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
 )
 
 func (t *Wallet) NewSlate(
@@ -26,9 +29,15 @@ func (t *Wallet) NewSlate(
 	savedSlate *SavedSlate,
 	err error,
 ) {
+	// the sender pays the fee, the payer of an invoice pays it
+	paidFee := fee
+	if amount == 0 {
+		paidFee = 0
+	}
+
 	inputs, outputs, blindExcess, err := t.inputsAndOutputs(
 		amount,
-		fee,
+		paidFee,
 		asset,
 		change,
 		walletInputs,
@@ -39,13 +48,6 @@ func (t *Wallet) NewSlate(
 		return
 	}
 
-	// generate secret nonce
-	nonce, err := t.nonce()
-	if err != nil {
-		err = errors.Wrap(err, "cannot get nonce")
-		return
-	}
-
 	// generate random kernel offset
 	kernelOffset, err := t.nonce()
 	if err != nil {
@@ -60,7 +62,52 @@ func (t *Wallet) NewSlate(
 		return
 	}
 
-	publicBlindExcess, err := t.pubKeyFromSecretKey(sumBlinds[:])
+	var coreOutputs []core.Output
+	for _, o := range outputs {
+		coreOutputs = append(coreOutputs, o.Output)
+	}
+
+	slateBytes, savedSlate, err = t.initiatorSlate(amount, fee, asset, receiveAmount, receiveAsset,
+		inputs, coreOutputs, sumBlinds, hex.EncodeToString(kernelOffset[:]))
+	if err != nil {
+		err = errors.Wrap(err, "cannot create initiatorSlate")
+		return
+	}
+
+	return
+}
+
+// initiatorSlate creates the slate with initiator's inputs, outputs, kernel offset and participant data
+// of its blind excess less the offset and a new nonce
+func (t *Wallet) initiatorSlate(
+	amount uint64,
+	fee uint64,
+	asset string,
+	receiveAmount uint64,
+	receiveAsset string,
+	inputs []core.Input,
+	outputs []core.Output,
+	blind [32]byte,
+	offset string,
+) (
+	slateBytes []byte,
+	savedSlate *SavedSlate,
+	err error,
+) {
+	// the fee of an invoice is paid in the asset invoiced
+	feeAsset := asset
+	if amount == 0 {
+		feeAsset = receiveAsset
+	}
+
+	// generate secret nonce
+	nonce, err := t.nonce()
+	if err != nil {
+		err = errors.Wrap(err, "cannot get nonce")
+		return
+	}
+
+	publicBlindExcess, err := t.pubKeyFromSecretKey(blind[:])
 	if err != nil {
 		err = errors.Wrap(err, "cannot create publicBlindExcess")
 		return
@@ -72,11 +119,6 @@ func (t *Wallet) NewSlate(
 		return
 	}
 
-	var coreOutputs []core.Output
-	for _, o := range outputs {
-		coreOutputs = append(coreOutputs, o.Output)
-	}
-
 	coreSlate := &libwallet.Slate{
 		VersionInfo: libwallet.VersionCompatInfo{
 			Version:            3,
@@ -86,13 +128,13 @@ func (t *Wallet) NewSlate(
 		NumParticipants: 2,
 		ID:              uuid.New(),
 		Transaction: core.Transaction{
-			Offset: hex.EncodeToString(kernelOffset[:]),
+			Offset: offset,
 			Body: core.TransactionBody{
 				Inputs:  inputs,
-				Outputs: coreOutputs,
+				Outputs: outputs,
 				Kernels: []core.TxKernel{{
 					Features:   core.PlainKernel,
-					Fee:        core.Uint64(fee),
+					Fee:        core.Uint64(kernelFee(fee, feeAsset)),
 					LockHeight: 0,
 					Excess:     "000000000000000000000000000000000000000000000000000000000000000000",
 					ExcessSig:  "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
@@ -100,7 +142,7 @@ func (t *Wallet) NewSlate(
 			},
 		},
 		Amount:     core.Uint64(amount),
-		Fee:        core.Uint64(fee),
+		Fee:        core.Uint64(kernelFee(fee, feeAsset)),
 		Height:     0,
 		LockHeight: 0,
 		ParticipantData: []libwallet.ParticipantData{{
@@ -118,12 +160,25 @@ func (t *Wallet) NewSlate(
 		Asset:         asset,
 		ReceiveAmount: core.Uint64(receiveAmount),
 		ReceiveAsset:  receiveAsset,
+		Expiry:        t.expiry(),
+	}
+
+	// ask the receiver to sign a payment proof for the amount sent
+	if amount > 0 {
+		address, e := t.Address()
+		if e != nil {
+			err = errors.Wrap(e, "cannot get Address")
+			return
+		}
+		slate.PaymentProof = &PaymentProof{SenderAddress: address}
 	}
 
 	savedSlate = &SavedSlate{
-		Slate: *slate,
-		Nonce: nonce,
-		Blind: sumBlinds,
+		Slate:   *slate,
+		Account: t.account.Number,
+		Nonce:   nonce,
+		Blind:   blind,
+		Created: time.Now().Unix(),
 	}
 
 	slateBytes, err = json.Marshal(slate)
@@ -155,8 +210,8 @@ func (t *Wallet) inputsAndOutputs(
 	var inputBlinds [][]byte
 	for _, input := range walletInputs {
 		inputsTotal += input.Value
-		// re-create child secret key from its saved index and use it as this input's blind
-		secret, e := t.secret(input.Index)
+		// re-create this input's blind from the child secret key at its saved index and its value
+		secret, e := t.outputBlind(input)
 		if e != nil {
 			err = errors.Wrapf(e, "cannot get secret for input with key index %d", input.Index)
 			return
@@ -308,6 +363,14 @@ func (t *Wallet) NewResponse(
 		MessageSig:        nil,
 	})
 
+	if inSlate.PaymentProof != nil {
+		err = t.signPaymentProof(inSlate)
+		if err != nil {
+			err = errors.Wrap(err, "cannot signPaymentProof")
+			return
+		}
+	}
+
 	outSlate := inSlate
 
 	outSlateBytes, err = json.Marshal(outSlate)
@@ -317,8 +380,9 @@ func (t *Wallet) NewResponse(
 	}
 
 	savedSlate = &SavedSlate{
-		Slate: *outSlate,
-		Nonce: receiverNonce,
+		Slate:   *outSlate,
+		Account: t.account.Number,
+		Nonce:   receiverNonce,
 	}
 
 	return
@@ -429,16 +493,53 @@ func (t *Wallet) NewTransaction(responseSlate *Slate, senderSlate *SavedSlate) (
 		return
 	}
 
-	// add sender and receiver partial signatures
-	finalSig, err := secp256k1.AggsigAddSignaturesSingle(
-		t.context,
+	ledgerTxBytes, walletTx, err = t.aggregateTransaction(
+		responseSlate,
 		[]*secp256k1.AggsigSignaturePartial{
 			&senderPartSig,
 			&receiverPartSig,
 		},
+		sumPublicNonces,
+		sumPublicBlinds,
+		msg)
+	if err != nil {
+		err = errors.Wrap(err, "cannot aggregateTransaction")
+		return
+	}
+
+	walletTx.Account = senderSlate.Account
+
+	if senderSlate.PaymentProof != nil {
+		walletTx.PaymentProof, err = t.completePaymentProof(responseSlate, senderSlate, &walletTx.Transaction.Transaction)
+		if err != nil {
+			err = errors.Wrap(err, "cannot completePaymentProof")
+			return
+		}
+	}
+
+	return
+}
+
+// aggregateTransaction adds up partial signatures of all participants into the kernel signature,
+// verifies it against the kernel excess and creates the transaction
+func (t *Wallet) aggregateTransaction(
+	slate *Slate,
+	partSigs []*secp256k1.AggsigSignaturePartial,
+	sumPublicNonces *secp256k1.PublicKey,
+	sumPublicBlinds *secp256k1.PublicKey,
+	msg []byte,
+) (
+	ledgerTxBytes []byte,
+	walletTx Transaction,
+	err error,
+) {
+	// add partial signatures
+	finalSig, err := secp256k1.AggsigAddSignaturesSingle(
+		t.context,
+		partSigs,
 		sumPublicNonces)
 	if err != nil {
-		err = errors.Wrap(err, "cannot add sender and receiver partial signatures")
+		err = errors.Wrap(err, "cannot add partial signatures")
 		return
 	}
 
@@ -458,11 +559,12 @@ func (t *Wallet) NewTransaction(responseSlate *Slate, senderSlate *SavedSlate) (
 		return
 	}
 
-	tx := responseSlate.Transaction
+	tx := slate.Transaction
+	tx.Body.Kernels = append([]core.TxKernel{}, slate.Transaction.Body.Kernels...)
 
 	// calculate kernel excess as a sum of commitments of inputs, outputs and kernel offset,
 	// that would produce a *Commitment type result
-	kernelExcess, err := ledger.CalculateExcess(t.context, &tx, uint64(responseSlate.Fee))
+	kernelExcess, err := ledger.CalculateExcess(t.context, &tx, uint64(slate.Fee))
 	if err != nil {
 		err = errors.Wrap(err, "cannot calculate final kernel excess")
 		return
@@ -496,7 +598,7 @@ func (t *Wallet) NewTransaction(responseSlate *Slate, senderSlate *SavedSlate) (
 
 	ledgerTx := ledger.Transaction{
 		Transaction: tx,
-		ID:          responseSlate.ID,
+		ID:          slate.ID,
 	}
 
 	ledgerTxBytes, err = json.Marshal(ledgerTx)
@@ -529,11 +631,17 @@ func (t *Wallet) newOutput(
 		return
 	}
 
-	blind = secret[:]
-
 	// //TODO or use GenerateBlinded() ?
 	commitValue := ledger.CommitValue(value, asset)
 
+	switchBlind, err := t.switchBlind(secret, commitValue)
+	if err != nil {
+		err = errors.Wrap(err, "cannot get switchBlind")
+		return
+	}
+
+	blind = switchBlind[:]
+
 	// create commitment to value and blinding factor
 	commitment, err := secp256k1.Commit(
 		t.context,
@@ -546,6 +654,16 @@ func (t *Wallet) newOutput(
 		return
 	}
 
+	// the wallet can rewind the proof with the nonce to recover value and message, but not the blind
+	rewindNonce, err := t.rewindNonce(commitment)
+	if err != nil {
+		err = errors.Wrap(err, "cannot get rewindNonce")
+		return
+	}
+
+	privateNonce := blake2b.Sum256(blind)
+	message := proofMessage(t.account.Number, index, asset)
+
 	// create bullet proof to value
 	proof, err := secp256k1.BulletproofRangeproofProveSingle(
 		t.context,
@@ -553,11 +671,10 @@ func (t *Wallet) newOutput(
 		nil,
 		commitValue,
 		blind[:],
-		//TODO reuse blind as nonce?
-		blind[:],
-		nil,
+		rewindNonce[:],
+		privateNonce[:],
 		nil,
-		nil)
+		message[:])
 	if err != nil {
 		err = errors.Wrap(err, "cannot create bullet proof")
 		return
@@ -569,10 +686,14 @@ func (t *Wallet) newOutput(
 			Commit:   commitment.String(),
 			Proof:    hex.EncodeToString(proof),
 		},
-		Value:  value,
-		Asset:  asset,
-		Index:  index,
-		Status: status,
+		Account: t.account.Number,
+		Value:   value,
+		Asset:   asset,
+		Index:   index,
+		Status:  status,
+		// the blind is a switch commitment blind of the key at the account path
+		SwitchCommit: true,
+		AccountPath:  true,
 	}
 
 	return
@@ -675,9 +796,10 @@ func (t *Wallet) newSlate(
 	}
 
 	savedSlate = &SavedSlate{
-		Slate: *slate,
-		Nonce: nonce,
-		Blind: sumBlinds,
+		Slate:   *slate,
+		Account: t.account.Number,
+		Nonce:   nonce,
+		Blind:   sumBlinds,
 	}
 
 	slateBytes, err = json.Marshal(slate)
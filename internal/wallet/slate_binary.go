@@ -0,0 +1,303 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/pkg/errors"
+)
+
+// slateBinaryMarker starts a compact slate in binary form, a slate in json starts with '{'
+const slateBinaryMarker = 4
+
+// fields of the binary slate that are present
+const (
+	binaryOffset = 1 << iota
+	binaryNumParticipants
+	binaryAmount
+	binaryFee
+	binaryAsset
+	binaryReceiveAmount
+	binaryReceiveAsset
+	binaryPaymentProof
+	binaryExpiry
+)
+
+// marshalSlateBinary encodes compact slate in binary form to carry in slatepacks:
+// marker | block header version | id | state | fields present | fields | sigs | coms,
+// numbers and lengths are unsigned varints, hex strings of keys, commitments and proofs are encoded as bytes.
+// Slates of other versions stay json.
+func marshalSlateBinary(slateBytes []byte) (binaryBytes []byte, err error) {
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(slateBytes, &fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal slate")
+	}
+	if _, ok := fields["ver"]; !ok {
+		return slateBytes, nil
+	}
+
+	slate := SlateV4{}
+	err = json.Unmarshal(slateBytes, &slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal compact slate")
+	}
+
+	versions := strings.Split(slate.Version, ":")
+	blockHeaderVersion := uint64(2)
+	if len(versions) > 1 {
+		blockHeaderVersion, err = strconv.ParseUint(versions[1], 10, 16)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse block header version from %v", slate.Version)
+		}
+	}
+
+	var present uint64
+	for flag, ok := range map[uint64]bool{
+		binaryOffset:          len(slate.Offset) > 0,
+		binaryNumParticipants: slate.NumParticipants > 0,
+		binaryAmount:          slate.Amount > 0,
+		binaryFee:             slate.Fee > 0,
+		binaryAsset:           len(slate.Asset) > 0,
+		binaryReceiveAmount:   slate.ReceiveAmount > 0,
+		binaryReceiveAsset:    len(slate.ReceiveAsset) > 0,
+		binaryPaymentProof:    slate.PaymentProof != nil,
+		binaryExpiry:          slate.Expiry != nil,
+	} {
+		if ok {
+			present |= flag
+		}
+	}
+
+	w := &binaryWriter{}
+	w.buf.WriteByte(slateBinaryMarker)
+	w.uint(blockHeaderVersion)
+	w.buf.Write(slate.ID[:])
+	w.string(slate.State)
+	w.uint(present)
+
+	if present&binaryOffset != 0 {
+		w.hex(slate.Offset)
+	}
+	if present&binaryNumParticipants != 0 {
+		w.uint(uint64(slate.NumParticipants))
+	}
+	if present&binaryAmount != 0 {
+		w.uint(uint64(slate.Amount))
+	}
+	if present&binaryFee != 0 {
+		w.uint(uint64(slate.Fee))
+	}
+	if present&binaryAsset != 0 {
+		w.string(slate.Asset)
+	}
+	if present&binaryReceiveAmount != 0 {
+		w.uint(uint64(slate.ReceiveAmount))
+	}
+	if present&binaryReceiveAsset != 0 {
+		w.string(slate.ReceiveAsset)
+	}
+	if present&binaryPaymentProof != 0 {
+		proof := slate.PaymentProof
+		w.uint(uint64(proof.Amount))
+		w.string(proof.Asset)
+		w.hex(proof.Excess)
+		w.string(proof.SenderAddress)
+		w.string(proof.ReceiverAddress)
+		w.string(proof.ReceiverSignature)
+		w.string(proof.SenderSignature)
+	}
+	if present&binaryExpiry != 0 {
+		w.uint(uint64(slate.Expiry.Time))
+		w.uint(slate.Expiry.Height)
+	}
+
+	w.uint(uint64(len(slate.Sigs)))
+	for _, sig := range slate.Sigs {
+		w.hex(sig.PublicBlindExcess)
+		w.hex(sig.PublicNonce)
+		if sig.PartSig == nil {
+			w.buf.WriteByte(0)
+		} else {
+			w.buf.WriteByte(1)
+			w.hex(*sig.PartSig)
+		}
+	}
+
+	w.uint(uint64(len(slate.Coms)))
+	for _, com := range slate.Coms {
+		w.uint(uint64(com.Features))
+		w.hex(com.Commit)
+		w.hex(com.Proof)
+	}
+
+	if w.err != nil {
+		return nil, errors.Wrap(w.err, "cannot encode compact slate")
+	}
+
+	return w.buf.Bytes(), nil
+}
+
+// unmarshalSlateBinary decodes compact slate from binary form back into json, slates in json are returned as is
+func unmarshalSlateBinary(binaryBytes []byte) (slateBytes []byte, err error) {
+	if len(binaryBytes) == 0 || binaryBytes[0] != slateBinaryMarker {
+		return binaryBytes, nil
+	}
+
+	r := &binaryReader{data: binaryBytes[1:]}
+	slate := SlateV4{}
+
+	slate.Version = strconv.Itoa(int(SlateVersion4)) + ":" + strconv.FormatUint(r.uint(), 10)
+	copy(slate.ID[:], r.bytes(len(slate.ID)))
+	slate.State = r.string()
+	present := r.uint()
+
+	if present&binaryOffset != 0 {
+		slate.Offset = r.hex()
+	}
+	if present&binaryNumParticipants != 0 {
+		slate.NumParticipants = uint(r.uint())
+	}
+	if present&binaryAmount != 0 {
+		slate.Amount = core.Uint64(r.uint())
+	}
+	if present&binaryFee != 0 {
+		slate.Fee = core.Uint64(r.uint())
+	}
+	if present&binaryAsset != 0 {
+		slate.Asset = r.string()
+	}
+	if present&binaryReceiveAmount != 0 {
+		slate.ReceiveAmount = core.Uint64(r.uint())
+	}
+	if present&binaryReceiveAsset != 0 {
+		slate.ReceiveAsset = r.string()
+	}
+	if present&binaryPaymentProof != 0 {
+		slate.PaymentProof = &PaymentProof{
+			Amount:            core.Uint64(r.uint()),
+			Asset:             r.string(),
+			Excess:            r.hex(),
+			SenderAddress:     r.string(),
+			ReceiverAddress:   r.string(),
+			ReceiverSignature: r.string(),
+			SenderSignature:   r.string(),
+		}
+	}
+	if present&binaryExpiry != 0 {
+		slate.Expiry = &Expiry{Time: int64(r.uint()), Height: r.uint()}
+	}
+
+	numSigs := r.uint()
+	for i := uint64(0); i < numSigs && r.err == nil; i++ {
+		sig := ParticipantV4{PublicBlindExcess: r.hex(), PublicNonce: r.hex()}
+		if r.bytes(1)[0] == 1 {
+			partSig := r.hex()
+			sig.PartSig = &partSig
+		}
+		slate.Sigs = append(slate.Sigs, sig)
+	}
+
+	numComs := r.uint()
+	for i := uint64(0); i < numComs && r.err == nil; i++ {
+		slate.Coms = append(slate.Coms, CommitV4{
+			Features: core.OutputFeatures(r.uint()),
+			Commit:   r.hex(),
+			Proof:    r.hex(),
+		})
+	}
+
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "cannot decode compact slate")
+	}
+	if len(r.data) > 0 {
+		return nil, errors.Errorf("%d bytes left after compact slate", len(r.data))
+	}
+
+	slateBytes, err = json.Marshal(slate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal compact slate")
+	}
+
+	return
+}
+
+type binaryWriter struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (t *binaryWriter) uint(value uint64) {
+	varint := make([]byte, binary.MaxVarintLen64)
+	t.buf.Write(varint[:binary.PutUvarint(varint, value)])
+}
+
+func (t *binaryWriter) string(value string) {
+	t.uint(uint64(len(value)))
+	t.buf.WriteString(value)
+}
+
+func (t *binaryWriter) hex(value string) {
+	valueBytes, err := hex.DecodeString(value)
+	if err != nil && t.err == nil {
+		t.err = errors.Wrapf(err, "cannot decode hex %v", value)
+	}
+	t.uint(uint64(len(valueBytes)))
+	t.buf.Write(valueBytes)
+}
+
+// binaryReader returns zero values once data is short, with the error kept to check at the end
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (t *binaryReader) uint() uint64 {
+	value, n := binary.Uvarint(t.data)
+	if n <= 0 {
+		t.fail()
+		return 0
+	}
+	t.data = t.data[n:]
+	return value
+}
+
+func (t *binaryReader) bytes(n int) []byte {
+	if n > len(t.data) {
+		t.fail()
+		return make([]byte, n)
+	}
+	b := t.data[:n]
+	t.data = t.data[n:]
+	return b
+}
+
+func (t *binaryReader) string() string {
+	n := t.uint()
+	if n > uint64(len(t.data)) {
+		t.fail()
+		return ""
+	}
+	return string(t.bytes(int(n)))
+}
+
+func (t *binaryReader) hex() string {
+	n := t.uint()
+	if n > uint64(len(t.data)) {
+		t.fail()
+		return ""
+	}
+	return hex.EncodeToString(t.bytes(int(n)))
+}
+
+func (t *binaryReader) fail() {
+	if t.err == nil {
+		t.err = errors.New("unexpected end of data")
+	}
+	t.data = nil
+}
@@ -0,0 +1,89 @@
+package wallet
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/google/uuid"
+	"github.com/olegabu/go-mimblewimble/pkg/slatepack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlateBinary(t *testing.T) {
+	partSig := "0102"
+	slate := SlateV4{
+		Version:         "4:2",
+		ID:              uuid.New(),
+		State:           stateSend2,
+		Offset:          "00ff",
+		NumParticipants: 2,
+		Amount:          300,
+		Fee:             1,
+		Asset:           "cash",
+		ReceiveAmount:   5,
+		ReceiveAsset:    "apple",
+		Sigs: []ParticipantV4{
+			{PublicBlindExcess: "02aa", PublicNonce: "03bb"},
+			{PublicBlindExcess: "02cc", PublicNonce: "03dd", PartSig: &partSig},
+		},
+		Coms: []CommitV4{
+			{Commit: "0801"},
+			{Features: core.CoinbaseOutput, Commit: "0902", Proof: "abcdef"},
+		},
+		PaymentProof: &PaymentProof{Amount: 300, Asset: "cash", Excess: "0903", SenderAddress: "sender", ReceiverSignature: "signature"},
+		Expiry:       &Expiry{Time: 1600000000, Height: 10},
+	}
+	slateBytes, err := json.Marshal(slate)
+	assert.NoError(t, err)
+
+	binaryBytes, err := marshalSlateBinary(slateBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(slateBinaryMarker), binaryBytes[0])
+	assert.Less(t, len(binaryBytes), len(slateBytes)/2)
+
+	decodedBytes, err := unmarshalSlateBinary(binaryBytes)
+	assert.NoError(t, err)
+	decoded := SlateV4{}
+	err = json.Unmarshal(decodedBytes, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, slate, decoded)
+
+	// truncated and padded data is refused
+	_, err = unmarshalSlateBinary(binaryBytes[:len(binaryBytes)-1])
+	assert.Error(t, err)
+	_, err = unmarshalSlateBinary(append(binaryBytes, 0))
+	assert.Error(t, err)
+
+	// slates of other versions stay json
+	v3Bytes := []byte(`{"version_info":{"version":3}}`)
+	binaryBytes, err = marshalSlateBinary(v3Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, v3Bytes, binaryBytes)
+	decodedBytes, err = unmarshalSlateBinary(binaryBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, v3Bytes, decodedBytes)
+}
+
+func TestSlatepackBinary(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	_, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+
+	slateBytes, err := w.Send(3, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	armor, err := w.NewSlatepack(slateBytes, "")
+	assert.NoError(t, err)
+
+	// the slatepack carries the binary slate
+	pack, err := slatepack.Unpack(armor, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(slateBinaryMarker), pack.Payload[0])
+
+	pack, err = w.ReadSlatepack(armor)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(slateBytes), string(pack.Payload))
+}
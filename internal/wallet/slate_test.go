@@ -115,7 +115,23 @@ func newTestWallet(t *testing.T) (w *Wallet) {
 	w, err = NewWalletWithoutMasterKey(dir)
 	assert.NoError(t, err)
 
-	_, err = w.InitMasterKey("digital fatigue essay pretty number firm calm skirt exhibit seat able phrase")
+	_, err = w.InitMasterKey("digital fatigue essay pretty number firm calm skirt exhibit seat able phrase", "", DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	return
+}
+
+// newTestReceiver opens a wallet with a new random mnemonic to be the counterparty of newTestWallet
+func newTestReceiver(t *testing.T) (w *Wallet) {
+	dir := testDbDir() + "_receiver"
+
+	err := os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	w, err = NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+
+	_, err = w.InitMasterKey("", "", DefaultMnemonicWords, "")
 	assert.NoError(t, err)
 
 	return
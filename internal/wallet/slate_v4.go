@@ -0,0 +1,260 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/blockcypher/libgrin/libwallet"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const zeroExcess = "000000000000000000000000000000000000000000000000000000000000000000"
+const zeroExcessSig = "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+
+// SlateV4 is a compact slate that carries only what the counterparty needs at each step:
+// the initiator sends its public blind and nonce, the responder returns only its signature, inputs and outputs
+type SlateV4 struct {
+	Version         string          `json:"ver"`
+	ID              uuid.UUID       `json:"id"`
+	State           string          `json:"sta"`
+	Offset          string          `json:"off,omitempty"`
+	NumParticipants uint            `json:"num_parts,omitempty"`
+	Amount          core.Uint64     `json:"amt,omitempty"`
+	Fee             core.Uint64     `json:"fee,omitempty"`
+	Asset           string          `json:"asset,omitempty"`
+	ReceiveAmount   core.Uint64     `json:"ramt,omitempty"`
+	ReceiveAsset    string          `json:"rasset,omitempty"`
+	Sigs            []ParticipantV4 `json:"sigs"`
+	Coms            []CommitV4      `json:"coms,omitempty"`
+	PaymentProof    *PaymentProof   `json:"proof,omitempty"`
+	Expiry          *Expiry         `json:"exp,omitempty"`
+}
+
+type ParticipantV4 struct {
+	PublicBlindExcess string  `json:"xs"`
+	PublicNonce       string  `json:"nonce"`
+	PartSig           *string `json:"part,omitempty"`
+}
+
+// CommitV4 is an input when it has no proof, and an output otherwise
+type CommitV4 struct {
+	Features core.OutputFeatures `json:"f,omitempty"`
+	Commit   string              `json:"c"`
+	Proof    string              `json:"p,omitempty"`
+}
+
+// slate states: S for send, I for invoice; 1 is sent by initiator, 2 is the response
+const (
+	stateSend1    = "S1"
+	stateSend2    = "S2"
+	stateInvoice1 = "I1"
+	stateInvoice2 = "I2"
+)
+
+// parseSlate reads slate of either version into full slate, compact slate leaves out fields not sent at its step
+func parseSlate(slateBytes []byte) (slate *Slate, version uint16, err error) {
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(slateBytes, &fields)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot unmarshal slate")
+	}
+
+	if _, ok := fields["ver"]; !ok {
+		slate = &Slate{}
+		err = json.Unmarshal(slateBytes, slate)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "cannot unmarshal json to slate")
+		}
+		return slate, slate.VersionInfo.Version, nil
+	}
+
+	slateV4 := &SlateV4{}
+	err = json.Unmarshal(slateBytes, slateV4)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot unmarshal json to SlateV4")
+	}
+
+	slate, err = slateFromV4(slateV4)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot convert slateFromV4")
+	}
+
+	return slate, SlateVersion4, nil
+}
+
+// marshalSlate writes slate in the given version, compact slate takes only given participants, inputs and outputs
+func marshalSlate(
+	slate *Slate,
+	version uint16,
+	state string,
+	participants []libwallet.ParticipantData,
+	inputs []core.Input,
+	outputs []core.Output,
+) (
+	slateBytes []byte,
+	err error,
+) {
+	switch version {
+	case SlateVersion3:
+		slateBytes, err = json.Marshal(slate)
+	case SlateVersion4:
+		slateBytes, err = json.Marshal(slateToV4(slate, state, participants, inputs, outputs))
+	default:
+		err = errors.Errorf("unsupported slate version %d", version)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal slate")
+	}
+
+	return
+}
+
+func slateToV4(
+	slate *Slate,
+	state string,
+	participants []libwallet.ParticipantData,
+	inputs []core.Input,
+	outputs []core.Output,
+) *SlateV4 {
+	slateV4 := &SlateV4{
+		Version:      fmt.Sprintf("%d:%d", SlateVersion4, slate.VersionInfo.BlockHeaderVersion),
+		ID:           slate.ID,
+		State:        state,
+		PaymentProof: slate.PaymentProof,
+	}
+
+	// the initiator sets the terms, the responder does not repeat them
+	if state == stateSend1 || state == stateInvoice1 {
+		slateV4.Offset = slate.Transaction.Offset
+		slateV4.Amount = slate.Amount
+		slateV4.Fee = slate.Fee
+		slateV4.Asset = slate.Asset
+		slateV4.ReceiveAmount = slate.ReceiveAmount
+		slateV4.ReceiveAsset = slate.ReceiveAsset
+		slateV4.Expiry = slate.Expiry
+		if slate.NumParticipants != 2 {
+			slateV4.NumParticipants = slate.NumParticipants
+		}
+	}
+
+	for _, p := range participants {
+		slateV4.Sigs = append(slateV4.Sigs, ParticipantV4{
+			PublicBlindExcess: p.PublicBlindExcess,
+			PublicNonce:       p.PublicNonce,
+			PartSig:           p.PartSig,
+		})
+	}
+
+	for _, input := range inputs {
+		slateV4.Coms = append(slateV4.Coms, CommitV4{Features: input.Features, Commit: input.Commit})
+	}
+
+	for _, output := range outputs {
+		slateV4.Coms = append(slateV4.Coms, CommitV4{Features: output.Features, Commit: output.Commit, Proof: output.Proof})
+	}
+
+	return slateV4
+}
+
+func slateFromV4(slateV4 *SlateV4) (slate *Slate, err error) {
+	versions := strings.Split(slateV4.Version, ":")
+	blockHeaderVersion := uint64(2)
+	if len(versions) > 1 {
+		blockHeaderVersion, err = strconv.ParseUint(versions[1], 10, 16)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse block header version from %v", slateV4.Version)
+		}
+	}
+
+	// responder's participant data follows the initiator's
+	var firstID uint64
+	switch slateV4.State {
+	case stateSend1, stateInvoice1:
+		firstID = 0
+	case stateSend2, stateInvoice2:
+		firstID = 1
+	default:
+		return nil, errors.Errorf("unsupported slate state %v", slateV4.State)
+	}
+
+	numParticipants := slateV4.NumParticipants
+	if numParticipants == 0 {
+		numParticipants = 2
+	}
+
+	var participants []libwallet.ParticipantData
+	for i, sig := range slateV4.Sigs {
+		participants = append(participants, libwallet.ParticipantData{
+			ID:                core.Uint64(firstID + uint64(i)),
+			PublicBlindExcess: sig.PublicBlindExcess,
+			PublicNonce:       sig.PublicNonce,
+			PartSig:           sig.PartSig,
+		})
+	}
+
+	var inputs []core.Input
+	var outputs []core.Output
+	for _, com := range slateV4.Coms {
+		if len(com.Proof) == 0 {
+			inputs = append(inputs, core.Input{Features: com.Features, Commit: com.Commit})
+		} else {
+			outputs = append(outputs, core.Output{Features: com.Features, Commit: com.Commit, Proof: com.Proof})
+		}
+	}
+
+	slate = &Slate{
+		Slate: libwallet.Slate{
+			VersionInfo: libwallet.VersionCompatInfo{
+				Version:            SlateVersion4,
+				OrigVersion:        SlateVersion4,
+				BlockHeaderVersion: uint16(blockHeaderVersion),
+			},
+			NumParticipants: numParticipants,
+			ID:              slateV4.ID,
+			Transaction: core.Transaction{
+				Offset: slateV4.Offset,
+				Body: core.TransactionBody{
+					Inputs:  inputs,
+					Outputs: outputs,
+					Kernels: []core.TxKernel{{
+						Features:  core.PlainKernel,
+						Fee:       slateV4.Fee,
+						Excess:    zeroExcess,
+						ExcessSig: zeroExcessSig,
+					}},
+				},
+			},
+			Amount:          slateV4.Amount,
+			Fee:             slateV4.Fee,
+			ParticipantData: participants,
+		},
+		Asset:         slateV4.Asset,
+		ReceiveAmount: slateV4.ReceiveAmount,
+		ReceiveAsset:  slateV4.ReceiveAsset,
+		PaymentProof:  slateV4.PaymentProof,
+		Expiry:        slateV4.Expiry,
+	}
+
+	return
+}
+
+// mergeResponse completes compact response with what the initiator kept to itself:
+// its terms, participant data, inputs and outputs
+func mergeResponse(responseSlate *Slate, senderSlate *SavedSlate) *Slate {
+	merged := senderSlate.Slate
+
+	merged.ParticipantData = append(append([]libwallet.ParticipantData{}, senderSlate.ParticipantData...), responseSlate.ParticipantData...)
+
+	body := &merged.Transaction.Body
+	body.Inputs = append(append([]core.Input{}, senderSlate.Transaction.Body.Inputs...), responseSlate.Transaction.Body.Inputs...)
+	body.Outputs = append(append([]core.Output{}, senderSlate.Transaction.Body.Outputs...), responseSlate.Transaction.Body.Outputs...)
+	body.Kernels = append([]core.TxKernel{}, senderSlate.Transaction.Body.Kernels...)
+
+	merged.PaymentProof = responseSlate.PaymentProof
+
+	return &merged
+}
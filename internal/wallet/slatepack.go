@@ -0,0 +1,71 @@
+package wallet
+
+import (
+	"github.com/olegabu/go-mimblewimble/pkg/slatepack"
+	"github.com/pkg/errors"
+)
+
+// SlatepackAddress is the address other wallets encrypt slatepacks to
+func (t *Wallet) SlatepackAddress() (address string, err error) {
+	publicKey, err := t.slatepackPublicKey()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get slatepackPublicKey")
+	}
+
+	return slatepack.Address(publicKey), nil
+}
+
+// NewSlatepack armors slate with this wallet's address to respond to, encrypts it if recipient address is given.
+// Compact slates are packed in binary form, others in json
+func (t *Wallet) NewSlatepack(slateBytes []byte, recipientAddress string) (armor []byte, err error) {
+	publicKey, err := t.slatepackPublicKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get slatepackPublicKey")
+	}
+
+	payload, err := marshalSlateBinary(slateBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshalSlateBinary")
+	}
+
+	armor, err = slatepack.Pack(payload, publicKey, recipientAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot Pack slatepack")
+	}
+
+	return
+}
+
+// ReadSlatepack dearmors slatepack and decrypts it if it is addressed to this wallet, its payload is slate in json
+func (t *Wallet) ReadSlatepack(armor []byte) (pack *slatepack.Slatepack, err error) {
+	secret, err := t.secret(slatepackKeyIndex)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get slatepack secret")
+	}
+
+	pack, err = slatepack.Unpack(armor, secret[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot Unpack slatepack")
+	}
+
+	pack.Payload, err = unmarshalSlateBinary(pack.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshalSlateBinary")
+	}
+
+	return
+}
+
+func (t *Wallet) slatepackPublicKey() (publicKey []byte, err error) {
+	secret, err := t.secret(slatepackKeyIndex)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get slatepack secret")
+	}
+
+	publicKey, err = slatepack.PublicKey(secret[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get slatepack PublicKey")
+	}
+
+	return
+}
@@ -13,24 +13,52 @@ type Database interface {
 	PutTransaction(tx Transaction) error
 	PutOutput(output Output) error
 	GetSenderSlate(id []byte) (slate *SavedSlate, err error)
+	GetReceiverSlate(id []byte) (slate *SavedSlate, err error)
 	GetTransaction(id []byte) (transaction Transaction, err error)
 	GetOutput(commit string) (output Output, err error)
 	ListSlates() (slates []SavedSlate, err error)
 	ListTransactions() (transactions []Transaction, err error)
 	ListOutputs() (outputs []Output, err error)
-	GetInputs(amount uint64, asset string) (inputs []Output, change uint64, err error)
+	ListSpendable(account uint32, asset string) (outputs []Output, err error)
 	Confirm(transactionID []byte) error
 	Cancel(transactionID []byte) error
-	NextIndex() (uint32, error)
+	NextIndex(account uint32) (uint32, error)
+	PutIndex(account uint32, index uint32) error
+	PutAccount(account Account) error
+	GetAccount(name string) (account Account, err error)
+	ListAccounts() (accounts []Account, err error)
+	PutCurrentAccount(name string) error
+	GetCurrentAccount() (name string, err error)
+	PutSelection(name string) error
+	GetSelection() (name string, err error)
+	Unlock(key []byte) error
+	Migrate() error
 	Close()
 }
 
+// Account is a named set of outputs whose keys are derived under its own hardened path, see outputSecret
+type Account struct {
+	Name   string `json:"name"`
+	Number uint32 `json:"number"`
+}
+
 type Output struct {
 	core.Output
-	Index  uint32       `json:"index"`
-	Value  uint64       `json:"value"`
-	Status OutputStatus `json:"status,omitempty"`
-	Asset  string       `json:"asset,omitempty"`
+	// key of the output is at Index of the Account
+	Account uint32       `json:"account,omitempty"`
+	Index   uint32       `json:"index"`
+	Value   uint64       `json:"value"`
+	Status  OutputStatus `json:"status,omitempty"`
+	Asset   string       `json:"asset,omitempty"`
+	// Multisig output is owned together with another wallet, Index is the key of this wallet's blind share
+	Multisig bool `json:"multisig,omitempty"`
+	// Frozen output is not spent until it is unfrozen
+	Frozen bool `json:"frozen,omitempty"`
+	// SwitchCommit output is blinded with the switch commitment blind derived from its key and value,
+	// outputs made before switch commitments and multisig blind shares are the key itself
+	SwitchCommit bool `json:"switch_commit,omitempty"`
+	// AccountPath output key is at m / 3' / Account' / 0 / Index, outputs made before accounts are at m / Index
+	AccountPath bool `json:"account_path,omitempty"`
 }
 
 type OutputStatus int
@@ -60,22 +88,91 @@ func (t OutputStatus) String() string {
 	}
 }
 
+// slate versions: full V3 slate and compact V4 slate
+const (
+	SlateVersion3 = 3
+	SlateVersion4 = 4
+)
+
 type Slate struct {
 	libwallet.Slate
-	Asset         string      `json:"asset,omitempty"`
-	ReceiveAmount core.Uint64 `json:"receive_amount,omitempty"`
-	ReceiveAsset  string      `json:"receive_asset,omitempty"`
+	Asset         string        `json:"asset,omitempty"`
+	ReceiveAmount core.Uint64   `json:"receive_amount,omitempty"`
+	ReceiveAsset  string        `json:"receive_asset,omitempty"`
+	PaymentProof  *PaymentProof `json:"payment_proof,omitempty"`
+	Multisig      *Multisig     `json:"multisig,omitempty"`
+	Expiry        *Expiry       `json:"expiry,omitempty"`
+}
+
+// PaymentProof is the receiver's signature of amount, asset, kernel excess and sender address.
+// Slates carry only addresses and receiver signature, the sender fills in the rest when finalizing
+type PaymentProof struct {
+	Amount            core.Uint64 `json:"amount,omitempty"`
+	Asset             string      `json:"asset,omitempty"`
+	Excess            string      `json:"excess,omitempty"`
+	SenderAddress     string      `json:"sender_address"`
+	ReceiverAddress   string      `json:"receiver_address,omitempty"`
+	ReceiverSignature string      `json:"receiver_signature,omitempty"`
+	SenderSignature   string      `json:"sender_signature,omitempty"`
+}
+
+// Multisig is a 2-of-2 output the slate funds. Its commitment is made with the sum of blind shares of both
+// participants, and its bulletproof is computed jointly from their T1, T2 points and tau x scalars
+type Multisig struct {
+	Value  core.Uint64     `json:"value"`
+	Asset  string          `json:"asset"`
+	Commit string          `json:"commit"`
+	Nonce  string          `json:"nonce"`
+	Shares []MultisigShare `json:"shares"`
+}
+
+type MultisigShare struct {
+	PublicBlind string `json:"public_blind"`
+	TOne        string `json:"t_one"`
+	TTwo        string `json:"t_two"`
+	TauX        string `json:"tau_x,omitempty"`
 }
 
 type SavedSlate struct {
 	Slate
-	Blind [32]byte `json:"blind,omitempty"`
-	Nonce [32]byte `json:"nonce,omitempty"`
+	Account uint32   `json:"account,omitempty"`
+	Blind   [32]byte `json:"blind,omitempty"`
+	Nonce   [32]byte `json:"nonce,omitempty"`
+	// key index of the blind share of the multisig output the slate funds
+	MultisigIndex uint32 `json:"multisig_index,omitempty"`
+	// inputs of the slate are picked when it is finalized
+	LateLock bool `json:"late_lock,omitempty"`
+	// time the slate was started in seconds since Unix epoch
+	Created int64 `json:"created,omitempty"`
+	// Signed is set once the participant of a multiparty slate added its partial signature
+	Signed bool `json:"signed,omitempty"`
+}
+
+// forgetSecrets wipes blind and nonce once the partial signature made with them is no longer needed,
+// together with the signature they reveal the keys of the slate's inputs and outputs
+func (t *SavedSlate) forgetSecrets() {
+	t.Blind = [32]byte{}
+	t.Nonce = [32]byte{}
 }
 
 type Transaction struct {
 	ledger.Transaction
-	Status TransactionStatus `json:"status,omitempty"`
+	Account      uint32            `json:"account,omitempty"`
+	Status       TransactionStatus `json:"status,omitempty"`
+	PaymentProof *PaymentProof     `json:"payment_proof,omitempty"`
+	// history of the transaction: what the wallet sent and received and the fee in units of their assets,
+	// times in seconds since Unix epoch
+	Direction     TransactionDirection `json:"direction,omitempty"`
+	Amount        uint64               `json:"amount,omitempty"`
+	Asset         string               `json:"asset,omitempty"`
+	ReceiveAmount uint64               `json:"receive_amount,omitempty"`
+	ReceiveAsset  string               `json:"receive_asset,omitempty"`
+	Fee           uint64               `json:"fee,omitempty"`
+	FeeAsset      string               `json:"fee_asset,omitempty"`
+	Counterparty  string               `json:"counterparty,omitempty"`
+	Created       int64                `json:"created,omitempty"`
+	Confirmed     int64                `json:"confirmed,omitempty"`
+	Note          string               `json:"note,omitempty"`
 }
 
 type TransactionStatus int
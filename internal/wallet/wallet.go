@@ -4,13 +4,15 @@ import (
 	"encoding/json"
 	"github.com/olegabu/go-mimblewimble/pkg/ledger"
 	"github.com/tyler-smith/go-bip32"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/blockcypher/libgrin/core"
+	"github.com/google/uuid"
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
 
 	"github.com/olegabu/go-secp256k1-zkp"
 )
@@ -20,24 +22,37 @@ type Wallet struct {
 	db         Database
 	masterKey  *bip32.Key
 	context    *secp256k1.Context
+	account    Account
+	selection  string
+	feeRate    uint64
+	fee        uint64
+	fixedFee   bool
+	feePolicy  FeePolicy
+	inputs     []string
+	// slates the wallet initiates expire after ttl or at expiryHeight, height is the last one of the chain it knows
+	ttl          time.Duration
+	expiryHeight uint64
+	height       uint64
+	lateLock     bool
 }
 
-func NewWallet(persistDir string) (w *Wallet, err error) {
+// NewWallet opens the wallet with its master key decrypted with the password
+func NewWallet(persistDir string, password string) (w *Wallet, err error) {
 	w, err = NewWalletWithoutMasterKey(persistDir)
 	if err != nil {
 		err = errors.Wrap(err, "cannot create NewWalletWithoutMasterKey")
 		return
 	}
 
-	if !w.masterKeyExists() {
-		err = errors.Errorf("cannot find master key in %v, run init first", persistDir)
-		return
+	if !w.MasterKeyExists() {
+		w.Close()
+		return nil, errors.Errorf("cannot find master key in %v, run init first", persistDir)
 	}
 
-	_, err = w.InitMasterKey("")
+	_, err = w.InitMasterKey("", "", DefaultMnemonicWords, password)
 	if err != nil {
-		err = errors.Wrap(err, "cannot InitMasterKey")
-		return
+		w.Close()
+		return nil, errors.Wrap(err, "cannot InitMasterKey")
 	}
 
 	return
@@ -56,7 +71,7 @@ func NewWalletWithoutMasterKey(persistDir string) (w *Wallet, err error) {
 		return
 	}
 
-	w = &Wallet{persistDir: persistDir, db: db, context: context}
+	w = &Wallet{persistDir: persistDir, db: db, context: context, feeRate: DefaultFeeRate, ttl: DefaultSlateTTL}
 
 	return
 }
@@ -66,17 +81,48 @@ func (t *Wallet) Close() {
 	secp256k1.ContextDestroy(t.context)
 }
 
-func (t *Wallet) Send(amount uint64, asset string, receiveAmount uint64, receiveAsset string) (slateBytes []byte, err error) {
-	inputs, change, err := t.db.GetInputs(amount, asset)
+func (t *Wallet) Send(amount uint64, asset string, receiveAmount uint64, receiveAsset string, slateVersion uint16) (slateBytes []byte, err error) {
+	if t.lateLock {
+		return t.sendLate(amount, asset, receiveAmount, slateVersion)
+	}
+
+	// the receiver adds its output, in an exchange its change too and this wallet its receive output
+	otherOutputs := 1
+	if receiveAmount > 0 {
+		otherOutputs += 2
+	}
+
+	feeFunc := t.feeFunc(otherOutputs)
+	// the payer of an invoice pays its fee
+	if amount == 0 {
+		feeFunc = noFee
+	}
+
+	inputs, change, fee, err := t.selectInputs(amount, asset, feeFunc)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot GetInputs")
+		return nil, errors.Wrap(err, "cannot selectInputs")
 	}
 
-	slateBytes, outputs, savedSlate, err := t.NewSlate(amount, 0, asset, change, inputs, receiveAmount, receiveAsset)
+	if amount == 0 {
+		fee = t.invoiceFee()
+	}
+
+	_, outputs, savedSlate, err := t.NewSlate(amount, fee, asset, change, inputs, receiveAmount, receiveAsset)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot NewSlate")
 	}
 
+	state := stateSend1
+	if amount == 0 {
+		state = stateInvoice1
+	}
+
+	// compact slate keeps initiator's inputs and outputs in the wallet till finalize
+	slateBytes, err = marshalSlate(&savedSlate.Slate, slateVersion, state, savedSlate.ParticipantData, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshalSlate")
+	}
+
 	for _, o := range outputs {
 		err = t.db.PutOutput(o)
 		if err != nil {
@@ -92,15 +138,22 @@ func (t *Wallet) Send(amount uint64, asset string, receiveAmount uint64, receive
 	return
 }
 
+// Respond answers in the version of the slate it received
 func (t *Wallet) Respond(inSlateBytes []byte) (outSlateBytes []byte, err error) {
-	var inSlate = &Slate{}
-	err = json.Unmarshal(inSlateBytes, inSlate)
+	inSlate, slateVersion, err := parseSlate(inSlateBytes)
 	if err != nil {
-		err = errors.Wrap(err, "cannot unmarshal json to inSlate")
+		err = errors.Wrap(err, "cannot parseSlate to inSlate")
 		return
 	}
 
-	fee := uint64(inSlate.Fee)
+	err = t.checkExpiry(inSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot checkExpiry")
+	}
+
+	numInputs := len(inSlate.Transaction.Body.Inputs)
+	numOutputs := len(inSlate.Transaction.Body.Outputs)
+	numParticipants := len(inSlate.ParticipantData)
 
 	// my counterparty who sent the inSlate wishes to receive this amount, this is the amount I will send
 	amount := uint64(inSlate.ReceiveAmount)
@@ -110,16 +163,51 @@ func (t *Wallet) Respond(inSlateBytes []byte) (outSlateBytes []byte, err error)
 	receiveAmount := uint64(inSlate.Amount)
 	receiveAsset := inSlate.Asset
 
-	inputs, change, err := t.db.GetInputs(amount, asset)
+	// I pay the fee of an invoice, the sender pays it otherwise
+	pay := receiveAmount == 0
+	feeAsset := receiveAsset
+	if pay {
+		feeAsset = asset
+	}
+
+	fee, err := assetFee(uint64(inSlate.Fee), feeAsset)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot GetInputs")
+		return nil, errors.Wrap(err, "cannot get assetFee")
 	}
 
-	outSlateBytes, outputs, savedSlate, err := t.NewResponse(amount, fee, asset, change, inputs, receiveAmount, receiveAsset, inSlate)
+	err = t.checkFeePolicy(fee, pay)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot accept fee")
+	}
+
+	slateFee := fee
+	if !pay {
+		fee = 0
+	}
+
+	inputs, change, _, err := t.selectInputs(amount, asset, func(numInputs int, change bool) uint64 { return fee })
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot selectInputs")
+	}
+
+	_, outputs, savedSlate, err := t.NewResponse(amount, fee, asset, change, inputs, receiveAmount, receiveAsset, inSlate)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot NewReceive")
 	}
 
+	state := stateSend2
+	if amount > 0 && receiveAmount == 0 {
+		state = stateInvoice2
+	}
+
+	// compact slate returns only responder's participant data, inputs and outputs
+	body := savedSlate.Transaction.Body
+	outSlateBytes, err = marshalSlate(&savedSlate.Slate, slateVersion, state,
+		savedSlate.ParticipantData[numParticipants:], body.Inputs[numInputs:], body.Outputs[numOutputs:])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshalSlate")
+	}
+
 	for _, o := range outputs {
 		err = t.db.PutOutput(o)
 		if err != nil {
@@ -127,6 +215,9 @@ func (t *Wallet) Respond(inSlateBytes []byte) (outSlateBytes []byte, err error)
 		}
 	}
 
+	// the receiver has signed and will not need its secrets
+	savedSlate.forgetSecrets()
+
 	err = t.db.PutReceiverSlate(savedSlate)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot PutReceiverSlate")
@@ -137,23 +228,26 @@ func (t *Wallet) Respond(inSlateBytes []byte) (outSlateBytes []byte, err error)
 			Transaction: savedSlate.Transaction,
 			ID:          savedSlate.ID,
 		},
-		Status: TransactionUnconfirmed,
+		Account: t.account.Number,
+		Status:  TransactionUnconfirmed,
+	}
+	tx.setAmounts(amount, asset, receiveAmount, receiveAsset, slateFee, feeAsset)
+	if inSlate.PaymentProof != nil {
+		tx.Counterparty = inSlate.PaymentProof.SenderAddress
 	}
 
-	err = t.db.PutTransaction(tx)
+	err = t.putTransaction(tx)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot PutTransaction")
+		return nil, errors.Wrap(err, "cannot putTransaction")
 	}
 
 	return
 }
 
 func (t *Wallet) Finalize(responseSlateBytes []byte) (txBytes []byte, err error) {
-	responseSlate := &Slate{}
-
-	err = json.Unmarshal(responseSlateBytes, responseSlate)
+	responseSlate, slateVersion, err := parseSlate(responseSlateBytes)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot unmarshal responseSlateBytes")
+		return nil, errors.Wrap(err, "cannot parseSlate from responseSlateBytes")
 	}
 
 	id, _ := responseSlate.ID.MarshalText()
@@ -163,14 +257,65 @@ func (t *Wallet) Finalize(responseSlateBytes []byte) (txBytes []byte, err error)
 		return nil, errors.Wrap(err, "cannot GetSlate")
 	}
 
+	err = t.checkOpen(senderSlate)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot checkOpen")
+	}
+
+	var lateInputs, lateOutputs []Output
+	if senderSlate.LateLock {
+		lateInputs, lateOutputs, err = t.lockLate(senderSlate)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot lockLate")
+		}
+
+		// full response carries the slate as it was sent, without inputs and change
+		if slateVersion != SlateVersion4 {
+			body := &responseSlate.Transaction.Body
+			body.Inputs = append(append([]core.Input{}, senderSlate.Transaction.Body.Inputs...), body.Inputs...)
+			body.Outputs = append(append([]core.Output{}, senderSlate.Transaction.Body.Outputs...), body.Outputs...)
+			responseSlate.Transaction.Offset = senderSlate.Transaction.Offset
+		}
+	}
+
+	if slateVersion == SlateVersion4 {
+		responseSlate = mergeResponse(responseSlate, senderSlate)
+	}
+
 	txBytes, tx, err := t.NewTransaction(responseSlate, senderSlate)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot NewTransaction")
 	}
 
-	err = t.db.PutTransaction(tx)
+	if senderSlate.LateLock {
+		err = t.lockInputs(lateInputs)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot lockInputs")
+		}
+
+		for _, o := range lateOutputs {
+			err = t.db.PutOutput(o)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot PutOutput")
+			}
+		}
+
+		err = t.db.PutSenderSlate(senderSlate)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot PutSenderSlate")
+		}
+	}
+
+	tx.setInitiated(senderSlate)
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot putTransaction")
+	}
+
+	err = t.forgetSlateSecrets(id)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot PutTransaction")
+		return nil, errors.Wrap(err, "cannot forgetSlateSecrets")
 	}
 
 	return txBytes, nil
@@ -208,90 +353,78 @@ func (t *Wallet) Issue(value uint64, asset string) (issueBytes []byte, err error
 		return nil, errors.Wrap(err, "cannot marshal ledgerIssue to json")
 	}
 
+	// the issue is not a transaction to the ledger, the wallet keeps it in the history as one
+	now := time.Now().Unix()
+	tx := Transaction{
+		Transaction: ledger.Transaction{
+			Transaction: core.Transaction{
+				Body: core.TransactionBody{
+					Outputs: []core.Output{walletOutput.Output},
+					Kernels: []core.TxKernel{ledgerIssue.Kernel},
+				},
+			},
+			ID: uuid.New(),
+		},
+		Account:   t.account.Number,
+		Status:    TransactionConfirmed,
+		Created:   now,
+		Confirmed: now,
+	}
+	tx.setAmounts(0, "", value, asset, 0, "")
+	tx.Direction = DirectionIssued
+
+	err = t.putTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot putTransaction")
+	}
+
 	return
 }
 
+// Info lists outputs, slates and transactions of the current account
 func (t *Wallet) Info() (string, error) {
 	tableString := &strings.Builder{}
 
-	outputs, err := t.db.ListOutputs()
+	report, err := t.Report()
 	if err != nil {
-		return tableString.String(), errors.Wrap(err, "cannot ListOutputs")
+		return tableString.String(), errors.Wrap(err, "cannot get Report")
 	}
 
-	// sort outputs decreasing by child key index
-	sort.Slice(outputs, func(i, j int) bool {
-		return outputs[i].Index > outputs[j].Index
-	})
+	tableString.WriteString("Account " + report.Account + "\n\n")
 
 	outputTable := tablewriter.NewWriter(tableString)
-	outputTable.SetHeader([]string{"value", "asset", "status", "features", "commit", "key"})
+	outputTable.SetHeader([]string{"value", "asset", "status", "features", "commit", "key", "frozen"})
 	outputTable.SetCaption(true, "Outputs")
 	outputTable.SetAlignment(tablewriter.ALIGN_CENTER)
-	for _, output := range outputs {
-		outputTable.Append([]string{strconv.Itoa(int(output.Value)), output.Asset, output.Status.String(), output.Features.String(), output.Commit[0:4], strconv.Itoa(int(output.Index))})
+	for _, output := range report.Outputs {
+		frozen := ""
+		if output.Frozen {
+			frozen = "*"
+		}
+		outputTable.Append([]string{strconv.Itoa(int(output.Value)), output.Asset, output.Status, output.Features, output.Commit[0:4], strconv.Itoa(int(output.Key)), frozen})
 	}
 	outputTable.Render()
 	tableString.WriteByte('\n')
 
-	slates, err := t.db.ListSlates()
-	if err != nil {
-		return tableString.String(), errors.Wrap(err, "cannot ListSlates")
-	}
+	now := time.Now()
+
 	slateTable := tablewriter.NewWriter(tableString)
-	slateTable.SetHeader([]string{"id", "send", "receive", "inputs", "outputs"})
+	slateTable.SetHeader([]string{"id", "send", "receive", "inputs", "outputs", "expires in"})
 	slateTable.SetCaption(true, "Slates")
 	slateTable.SetAlignment(tablewriter.ALIGN_CENTER)
-	for _, slate := range slates {
-		id, _ := slate.ID.MarshalText()
-
-		var inputs = ""
-		for _, input := range slate.Transaction.Body.Inputs {
-			inputs += input.Commit[0:4] + " "
-		}
-		var outputs = ""
-		for _, output := range slate.Transaction.Body.Outputs {
-			outputs += output.Commit[0:4] + " "
-		}
-
-		send := ""
-		s := int(slate.Amount)
-		if s != 0 {
-			send = strconv.Itoa(s) + " " + slate.Asset
-		}
-
-		receive := ""
-		r := int(slate.ReceiveAmount)
-		if r != 0 {
-			receive = strconv.Itoa(r) + " " + slate.ReceiveAsset
-		}
-
-		slateTable.Append([]string{string(id), send, receive, inputs, outputs})
+	for _, slate := range report.Slates {
+		slateTable.Append([]string{slate.ID, formatAmount(slate.Amount, slate.Asset), formatAmount(slate.ReceiveAmount, slate.ReceiveAsset),
+			shortCommits(slate.Inputs), shortCommits(slate.Outputs), slate.Expiry.Remaining(now)})
 	}
 	slateTable.Render()
 	tableString.WriteByte('\n')
 
-	transactions, err := t.db.ListTransactions()
-	if err != nil {
-		return tableString.String(), errors.Wrap(err, "cannot ListTransactions")
-	}
 	transactionTable := tablewriter.NewWriter(tableString)
 	transactionTable.SetHeader([]string{"id", "status", "inputs", "outputs"})
 	transactionTable.SetCaption(true, "Transactions")
 	transactionTable.SetAlignment(tablewriter.ALIGN_CENTER)
-	for _, tx := range transactions {
-		id, _ := tx.ID.MarshalText()
-
-		var inputs = ""
-		for _, input := range tx.Transaction.Body.Inputs {
-			inputs += input.Commit[0:4] + " "
-		}
-		var outputs = ""
-		for _, output := range tx.Transaction.Body.Outputs {
-			outputs += output.Commit[0:4] + " "
-		}
-
-		transactionTable.Append([]string{string(id), tx.Status.String(), inputs, outputs})
+	for _, tx := range report.Transactions {
+		transactionTable.Append([]string{tx.ID, tx.Status, shortCommits(tx.Inputs), shortCommits(tx.Outputs)})
 	}
 	transactionTable.Render()
 	tableString.WriteByte('\n')
@@ -299,6 +432,14 @@ func (t *Wallet) Info() (string, error) {
 	return tableString.String(), nil
 }
 
+// shortCommits lists first characters of the commits, enough to tell them apart in a table
+func shortCommits(commits []string) (s string) {
+	for _, commit := range commits {
+		s += commit[0:4] + " "
+	}
+	return
+}
+
 func (t *Wallet) Print() error {
 	s, err := t.Info()
 	if err != nil {
@@ -309,18 +450,76 @@ func (t *Wallet) Print() error {
 }
 
 func (t *Wallet) Confirm(transactionID []byte) error {
-	return t.db.Confirm(transactionID)
+	err := t.db.Confirm(transactionID)
+	if err != nil {
+		return errors.Wrap(err, "cannot Confirm")
+	}
+
+	tx, err := t.db.GetTransaction(transactionID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetTransaction")
+	}
+
+	tx.Confirmed = time.Now().Unix()
+
+	err = t.db.PutTransaction(tx)
+	if err != nil {
+		return errors.Wrap(err, "cannot PutTransaction")
+	}
+
+	return nil
 }
 
+// Cancel cancels the transaction, or the slate the wallet initiated when it has not been finalized yet
 func (t *Wallet) Cancel(transactionID []byte) error {
-	return t.db.Cancel(transactionID)
+	canceled, err := t.cancelSlate(transactionID)
+	if err != nil {
+		return errors.Wrap(err, "cannot cancelSlate")
+	}
+	if canceled {
+		return nil
+	}
+
+	err = t.db.Cancel(transactionID)
+	if err != nil {
+		return errors.Wrap(err, "cannot Cancel")
+	}
+
+	return t.forgetSlateSecrets(transactionID)
+}
+
+// forgetSlateSecrets wipes secrets of the slates of a finalized or canceled transaction
+func (t *Wallet) forgetSlateSecrets(id []byte) error {
+	for _, slateType := range []struct {
+		get func(id []byte) (*SavedSlate, error)
+		put func(slate *SavedSlate) error
+	}{
+		{t.db.GetSenderSlate, t.db.PutSenderSlate},
+		{t.db.GetReceiverSlate, t.db.PutReceiverSlate},
+	} {
+		slate, err := slateType.get(id)
+		if errors.Cause(err) == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot get slate")
+		}
+
+		slate.forgetSecrets()
+
+		err = slateType.put(slate)
+		if err != nil {
+			return errors.Wrap(err, "cannot put slate")
+		}
+	}
+
+	return nil
 }
 
 func ParseIDFromSlate(slateBytes []byte) (ID []byte, err error) {
-	slate := Slate{}
-	err = json.Unmarshal(slateBytes, &slate)
+	slate, _, err := parseSlate(slateBytes)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot unmarshal slate from json")
+		return nil, errors.Wrap(err, "cannot parseSlate")
 	}
 	id, err := slate.ID.MarshalText()
 	if err != nil {
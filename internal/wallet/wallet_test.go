@@ -6,6 +6,7 @@ import (
 	"fmt"
 	ledger2 "github.com/olegabu/go-mimblewimble/pkg/ledger"
 	"github.com/olegabu/go-secp256k1-zkp"
+	"github.com/syndtr/goleveldb/leveldb"
 	"os/user"
 	"path/filepath"
 	"testing"
@@ -30,13 +31,13 @@ func TestWalletSendReceive(t *testing.T) {
 	err := w.Print()
 	assert.NoError(t, err)
 
-	tx := testSendReceive(t, w, 4, "cash")
+	tx := testSendReceive(t, w, 4, "cash", SlateVersion4)
 
 	// take 3 inputs 1+2+3 for 2 outputs: receiver 4 and change 2
 	assert.Equal(t, 3, len(tx.Body.Inputs))
 	assert.Equal(t, 2, len(tx.Body.Outputs))
 
-	tx = testSendReceive(t, w, 6, "cash")
+	tx = testSendReceive(t, w, 6, "cash", SlateVersion4)
 
 	// take 2 inputs 2+4 for 1 output: receiver 6
 	assert.Equal(t, 2, len(tx.Body.Inputs))
@@ -55,19 +56,80 @@ func TestWalletInvoicePay(t *testing.T) {
 	err := w.Print()
 	assert.NoError(t, err)
 
-	tx := testInvoicePay(t, w, 4, "cash")
+	tx := testInvoicePay(t, w, 4, "cash", SlateVersion4)
 
 	// take 3 inputs 1+2+3 for 2 outputs: receiver 4 and change 2
 	assert.Equal(t, 3, len(tx.Body.Inputs))
 	assert.Equal(t, 2, len(tx.Body.Outputs))
 
-	tx = testInvoicePay(t, w, 6, "cash")
+	tx = testInvoicePay(t, w, 6, "cash", SlateVersion4)
 
 	// take 2 inputs 2+4 for 1 output: receiver 6
 	assert.Equal(t, 2, len(tx.Body.Inputs))
 	assert.Equal(t, 1, len(tx.Body.Outputs))
 }
 
+func TestWalletSlateVersions(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	for _, value := range []uint64{1, 2, 3} {
+		_, err := w.Issue(value, "cash")
+		assert.NoError(t, err)
+	}
+
+	for _, slateVersion := range []uint16{SlateVersion3, SlateVersion4} {
+		tx := testSendReceive(t, w, 4, "cash", slateVersion)
+		assert.Equal(t, 2, len(tx.Body.Outputs))
+
+		tx = testInvoicePay(t, w, 2, "cash", slateVersion)
+		assert.Equal(t, 1, len(tx.Body.Inputs))
+	}
+}
+
+func TestSlateV4IsCompact(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	for _, value := range []uint64{1, 2, 3} {
+		_, err := w.Issue(value, "cash")
+		assert.NoError(t, err)
+	}
+
+	slateBytes, err := w.Send(4, "cash", 0, "", SlateVersion4)
+	assert.NoError(t, err)
+
+	// sender keeps its inputs and change to itself
+	slateV4 := SlateV4{}
+	err = json.Unmarshal(slateBytes, &slateV4)
+	assert.NoError(t, err)
+	assert.Equal(t, stateSend1, slateV4.State)
+	assert.Equal(t, 1, len(slateV4.Sigs))
+	assert.Equal(t, 0, len(slateV4.Coms))
+
+	responseSlateBytes, err := w.Respond(slateBytes)
+	assert.NoError(t, err)
+
+	// receiver returns only its signature and output
+	responseV4 := SlateV4{}
+	err = json.Unmarshal(responseSlateBytes, &responseV4)
+	assert.NoError(t, err)
+	assert.Equal(t, stateSend2, responseV4.State)
+	assert.Equal(t, 1, len(responseV4.Sigs))
+	assert.Equal(t, 1, len(responseV4.Coms))
+	assert.Empty(t, responseV4.Offset)
+
+	txBytes, err := w.Finalize(responseSlateBytes)
+	assert.NoError(t, err)
+
+	tx, err := ledger2.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+
+	// 3 inputs 1+2+3, 2 outputs: receiver 4 and change 2
+	assert.Equal(t, 3, len(tx.Body.Inputs))
+	assert.Equal(t, 2, len(tx.Body.Outputs))
+}
+
 func TestWalletInvoicePaySingle(t *testing.T) {
 	w := newTestWallet(t)
 	defer w.Close()
@@ -80,7 +142,7 @@ func TestWalletInvoicePaySingle(t *testing.T) {
 	err := w.Print()
 	assert.NoError(t, err)
 
-	tx := testInvoicePay(t, w, 1, "cash")
+	tx := testInvoicePay(t, w, 1, "cash", SlateVersion4)
 
 	assert.Equal(t, 1, len(tx.Body.Inputs))
 	assert.Equal(t, 1, len(tx.Body.Outputs))
@@ -109,7 +171,7 @@ func TestWalletExchange(t *testing.T) {
 	receiveAmount := uint64(3)
 	receiveAsset := "apple"
 
-	slateBytes, err := w.Send(sendAmount, sendAsset, receiveAmount, receiveAsset)
+	slateBytes, err := w.Send(sendAmount, sendAsset, receiveAmount, receiveAsset, SlateVersion4)
 	assert.NoError(t, err)
 	fmt.Println("send " + string(slateBytes))
 
@@ -144,6 +206,39 @@ func TestWalletExchange(t *testing.T) {
 	assert.Equal(t, 2, len(tx.Body.Outputs))
 }
 
+func TestPaymentProof(t *testing.T) {
+	w := newTestWallet(t)
+	defer w.Close()
+
+	for _, value := range []uint64{1, 2, 3} {
+		_, err := w.Issue(value, "cash")
+		assert.NoError(t, err)
+	}
+
+	tx := testSendReceive(t, w, 4, "cash", SlateVersion4)
+
+	proofBytes, err := w.PaymentProof([]byte(tx.ID.String()))
+	assert.NoError(t, err)
+	fmt.Println("proof " + string(proofBytes))
+
+	proof, err := VerifyPaymentProof(proofBytes)
+	assert.NoError(t, err)
+
+	// proof is for the kernel as it is stored in the ledger, with kernel offset added to its excess
+	kernel, err := ledger2.FullKernel(&tx.Transaction)
+	assert.NoError(t, err)
+	assert.Equal(t, kernel.Excess, proof.Excess)
+	assert.Equal(t, uint64(4), uint64(proof.Amount))
+	assert.Equal(t, "cash", proof.Asset)
+
+	// tampering with the amount invalidates the proof
+	proof.Amount = 40
+	tamperedBytes, err := json.Marshal(proof)
+	assert.NoError(t, err)
+	_, err = VerifyPaymentProof(tamperedBytes)
+	assert.Error(t, err)
+}
+
 func TestTotalIssues(t *testing.T) {
 	w := newTestWallet(t)
 	defer w.Close()
@@ -205,7 +300,7 @@ func TestTotalIssues(t *testing.T) {
 	totalAppleIssuesCommitment, err := secp256k1.Commit(w.context, zero, totalAppleIssuesValue, &secp256k1.GeneratorH, &secp256k1.GeneratorG)
 	assert.NoError(t, err)
 
-	tx := testSendReceive(t, w, 5, "cash")
+	tx := testSendReceive(t, w, 5, "cash", SlateVersion4)
 
 	// collect outputs into outputCommitments
 	for _, output := range tx.Body.Outputs {
@@ -240,8 +335,8 @@ func TestTotalIssues(t *testing.T) {
 	assert.Equal(t, sumCommitment.String(), totalIssuesCommitment.String())
 }
 
-func testSendReceive(t *testing.T, w *Wallet, amount uint64, asset string) (tx *ledger2.Transaction) {
-	slateBytes, err := w.Send(amount, asset, 0, "")
+func testSendReceive(t *testing.T, w *Wallet, amount uint64, asset string, slateVersion uint16) (tx *ledger2.Transaction) {
+	slateBytes, err := w.Send(amount, asset, 0, "", slateVersion)
 	assert.NoError(t, err)
 	fmt.Println("send " + string(slateBytes))
 
@@ -252,6 +347,11 @@ func testSendReceive(t *testing.T, w *Wallet, amount uint64, asset string) (tx *
 	assert.NoError(t, err)
 	fmt.Println("resp " + string(responseSlateBytes))
 
+	// response is in the version of the slate sent
+	_, responseVersion, err := parseSlate(responseSlateBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, slateVersion, responseVersion)
+
 	err = w.Print()
 	assert.NoError(t, err)
 
@@ -274,8 +374,8 @@ func testSendReceive(t *testing.T, w *Wallet, amount uint64, asset string) (tx *
 	return
 }
 
-func testInvoicePay(t *testing.T, w *Wallet, amount uint64, asset string) (tx *ledger2.Transaction) {
-	slateBytes, err := w.Send(0, "", amount, asset)
+func testInvoicePay(t *testing.T, w *Wallet, amount uint64, asset string, slateVersion uint16) (tx *ledger2.Transaction) {
+	slateBytes, err := w.Send(0, "", amount, asset, slateVersion)
 	//slateBytes, err := w.Invoice(amount, asset)
 	assert.NoError(t, err)
 	fmt.Println("invoice " + string(slateBytes))
@@ -287,6 +387,10 @@ func testInvoicePay(t *testing.T, w *Wallet, amount uint64, asset string) (tx *l
 	assert.NoError(t, err)
 	fmt.Println("pay " + string(responseSlateBytes))
 
+	_, responseVersion, err := parseSlate(responseSlateBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, slateVersion, responseVersion)
+
 	err = w.Print()
 	assert.NoError(t, err)
 
@@ -311,9 +415,119 @@ func testInvoicePay(t *testing.T, w *Wallet, amount uint64, asset string) (tx *l
 
 func TestInfo(t *testing.T) {
 	dir := testDbDir()
-	w, err := NewWallet(dir)
+	w, err := NewWallet(dir, "")
 	assert.NoError(t, err)
 	defer w.Close()
 	err = w.Print()
 	assert.NoError(t, err)
 }
+
+func TestDatabaseEncrypted(t *testing.T) {
+	w := newTestWallet(t)
+
+	_, err := w.Issue(7, "cash")
+	assert.NoError(t, err)
+
+	slateBytes, err := w.Send(7, "cash", 0, "", SlateVersion3)
+	assert.NoError(t, err)
+	responseBytes, err := w.Respond(slateBytes)
+	assert.NoError(t, err)
+	_, err = w.Finalize(responseBytes)
+	assert.NoError(t, err)
+
+	// secrets of the finalized slates are gone
+	id, err := ParseIDFromSlate(slateBytes)
+	assert.NoError(t, err)
+	senderSlate, err := w.db.GetSenderSlate(id)
+	assert.NoError(t, err)
+	assert.Equal(t, [32]byte{}, senderSlate.Blind)
+	assert.Equal(t, [32]byte{}, senderSlate.Nonce)
+	receiverSlate, err := w.db.GetReceiverSlate(id)
+	assert.NoError(t, err)
+	assert.Equal(t, [32]byte{}, receiverSlate.Nonce)
+
+	w.Close()
+
+	// values read without the key reveal nothing
+	ldb, err := leveldb.OpenFile(filepath.Join(testDbDir(), "wallet"), nil)
+	assert.NoError(t, err)
+	iter := ldb.NewIterator(nil, nil)
+	for iter.Next() {
+		assert.NotContains(t, string(iter.Value()), "cash")
+		assert.NotContains(t, string(iter.Value()), "index")
+	}
+	iter.Release()
+	ldb.Close()
+
+	// and are read back with the key
+	w, err = NewWallet(testDbDir(), "")
+	assert.NoError(t, err)
+	defer w.Close()
+
+	outputs, err := w.db.ListOutputs()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(outputs))
+}
+
+func TestDatabaseMigration(t *testing.T) {
+	w := newTestWallet(t)
+
+	_, err := w.Issue(10, "cash")
+	assert.NoError(t, err)
+
+	databaseKey, err := w.secret(databaseKeyIndex)
+	assert.NoError(t, err)
+	w.Close()
+
+	// rewrite values in plaintext the way they were written before they were encrypted
+	ldb, err := leveldb.OpenFile(filepath.Join(testDbDir(), "wallet"), nil)
+	assert.NoError(t, err)
+	sealed := &leveldbDatabase{db: ldb}
+	err = sealed.Unlock(databaseKey[:])
+	assert.NoError(t, err)
+
+	batch := new(leveldb.Batch)
+	iter := ldb.NewIterator(nil, nil)
+	for iter.Next() {
+		if string(iter.Key()) == string(schemaKey()) {
+			batch.Delete(schemaKey())
+			continue
+		}
+		value, err := sealed.open(iter.Key(), iter.Value())
+		assert.NoError(t, err)
+		batch.Put(append([]byte{}, iter.Key()...), value)
+	}
+	iter.Release()
+	err = ldb.Write(batch, nil)
+	assert.NoError(t, err)
+	ldb.Close()
+
+	// values are encrypted when the wallet is opened
+	w, err = NewWallet(testDbDir(), "")
+	assert.NoError(t, err)
+
+	balances, err := w.Balances()
+	assert.NoError(t, err)
+	assert.Equal(t, []Balance{{Asset: "cash", Spendable: 10}}, balances)
+	_, err = w.Info()
+	assert.NoError(t, err)
+	w.Close()
+
+	ldb, err = leveldb.OpenFile(filepath.Join(testDbDir(), "wallet"), nil)
+	assert.NoError(t, err)
+	iter = ldb.NewIterator(nil, nil)
+	for iter.Next() {
+		assert.NotContains(t, string(iter.Value()), "cash")
+	}
+	iter.Release()
+	ldb.Close()
+
+	// and only once
+	w, err = NewWallet(testDbDir(), "")
+	assert.NoError(t, err)
+	defer w.Close()
+
+	balances, err = w.Balances()
+	assert.NoError(t, err)
+	assert.Equal(t, []Balance{{Asset: "cash", Spendable: 10}}, balances)
+}
@@ -0,0 +1,246 @@
+package ledger
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+// StateDigest is a running hash of outputs, kernels and asset totals of the ledger. It is a multiset hash (MuHash):
+// every element is hashed to a number modulo a 3072-bit prime and the numbers are multiplied together, so elements
+// are added and removed as blocks are committed without rehashing the whole ledger, and their order does not matter.
+type StateDigest struct {
+	// the digest is numerator/denominator, removed elements multiply the denominator to invert it only once per root
+	numerator   *big.Int
+	denominator *big.Int
+	assets      map[string]uint64
+	NumOutputs  int
+	NumKernels  int
+}
+
+// digestPrime is the largest 3072-bit prime 2^3072 - 1103717
+var digestPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072), big.NewInt(1103717))
+
+const digestSize = 3072 / 8
+
+// kinds of elements hashed into the digest
+const (
+	digestOutput = 'o'
+	digestKernel = 'k'
+	digestAsset  = 'a'
+)
+
+// NewStateDigest hashes the whole ledger state, to start the running digest from
+func NewStateDigest(outputs []core.Output, kernels []core.TxKernel, assets map[string]uint64) *StateDigest {
+	t := &StateDigest{
+		numerator:   big.NewInt(1),
+		denominator: big.NewInt(1),
+		assets:      make(map[string]uint64),
+	}
+
+	for _, output := range outputs {
+		t.AddOutput(output.Commit)
+	}
+	for _, kernel := range kernels {
+		t.AddKernel(kernel.Excess)
+	}
+	for asset, total := range assets {
+		t.AddAsset(asset, total)
+	}
+
+	return t
+}
+
+// LoadStateDigest reads the digest saved with the last block, or hashes the ledger state when there is none yet
+// as the state was imported or committed before digests were saved
+func LoadStateDigest(db Database) (t *StateDigest, err error) {
+	digestBytes, err := db.GetStateDigest()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetStateDigest")
+	}
+
+	if digestBytes != nil {
+		t = &StateDigest{}
+		err = json.Unmarshal(digestBytes, t)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot unmarshal state digest")
+		}
+		return
+	}
+
+	outputs, err := db.ListOutputs()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListOutputs")
+	}
+	kernels, err := db.ListKernels()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListKernels")
+	}
+	assets, err := db.ListAssets()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListAssets")
+	}
+
+	return NewStateDigest(outputs, kernels, assets), nil
+}
+
+// Copy is to update the digest with a block that may not be committed
+func (t *StateDigest) Copy() *StateDigest {
+	c := &StateDigest{
+		numerator:   new(big.Int).Set(t.numerator),
+		denominator: new(big.Int).Set(t.denominator),
+		assets:      make(map[string]uint64, len(t.assets)),
+		NumOutputs:  t.NumOutputs,
+		NumKernels:  t.NumKernels,
+	}
+	for asset, total := range t.assets {
+		c.assets[asset] = total
+	}
+	return c
+}
+
+func (t *StateDigest) AddOutput(commit string) {
+	t.add(digestElement(digestOutput, []byte(commit)))
+	t.NumOutputs++
+}
+
+func (t *StateDigest) RemoveOutput(commit string) {
+	t.remove(digestElement(digestOutput, []byte(commit)))
+	t.NumOutputs--
+}
+
+func (t *StateDigest) AddKernel(excess string) {
+	t.add(digestElement(digestKernel, []byte(excess)))
+	t.NumKernels++
+}
+
+// AddAsset adds the value issued to the total of the asset
+func (t *StateDigest) AddAsset(asset string, value uint64) {
+	total, ok := t.assets[asset]
+	if ok {
+		t.remove(assetElement(asset, total))
+	}
+	total += value
+	t.assets[asset] = total
+	t.add(assetElement(asset, total))
+}
+
+// AddTransaction removes outputs the transaction spends unless the ledger lets them be spent again,
+// adds its outputs and its full kernel
+func (t *StateDigest) AddTransaction(tx *Transaction, kernel core.TxKernel, doublespend bool) {
+	if !doublespend {
+		for _, input := range tx.Body.Inputs {
+			t.RemoveOutput(input.Commit)
+		}
+	}
+	for _, output := range tx.Body.Outputs {
+		t.AddOutput(output.Commit)
+	}
+	t.AddKernel(kernel.Excess)
+}
+
+func (t *StateDigest) AddIssue(issue *Issue) {
+	t.AddOutput(issue.Output.Commit)
+	t.AddKernel(issue.Kernel.Excess)
+	t.AddAsset(issue.Asset, issue.Value)
+}
+
+// Root is a short hash of the digest to put into block headers and snapshots
+func (t *StateDigest) Root() []byte {
+	hash := blake2b.Sum256(t.value())
+	return hash[:]
+}
+
+func (t *StateDigest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(stateDigestJSON{
+		Value:      hex.EncodeToString(t.value()),
+		Assets:     t.assets,
+		NumOutputs: t.NumOutputs,
+		NumKernels: t.NumKernels,
+	})
+}
+
+func (t *StateDigest) UnmarshalJSON(data []byte) error {
+	d := stateDigestJSON{}
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return err
+	}
+
+	valueBytes, err := hex.DecodeString(d.Value)
+	if err != nil {
+		return errors.Wrap(err, "cannot decode digest value")
+	}
+
+	t.numerator = new(big.Int).SetBytes(valueBytes)
+	t.denominator = big.NewInt(1)
+	t.assets = d.Assets
+	if t.assets == nil {
+		t.assets = make(map[string]uint64)
+	}
+	t.NumOutputs = d.NumOutputs
+	t.NumKernels = d.NumKernels
+
+	return nil
+}
+
+type stateDigestJSON struct {
+	Value      string            `json:"value"`
+	Assets     map[string]uint64 `json:"assets"`
+	NumOutputs int               `json:"num_outputs"`
+	NumKernels int               `json:"num_kernels"`
+}
+
+func (t *StateDigest) add(element *big.Int) {
+	t.numerator.Mul(t.numerator, element).Mod(t.numerator, digestPrime)
+}
+
+func (t *StateDigest) remove(element *big.Int) {
+	t.denominator.Mul(t.denominator, element).Mod(t.denominator, digestPrime)
+}
+
+// value reduces the digest to a single number and returns its fixed size big endian bytes
+func (t *StateDigest) value() []byte {
+	if t.denominator.Cmp(big.NewInt(1)) != 0 {
+		inverse := new(big.Int).ModInverse(t.denominator, digestPrime)
+		t.numerator.Mul(t.numerator, inverse).Mod(t.numerator, digestPrime)
+		t.denominator.SetInt64(1)
+	}
+
+	valueBytes := make([]byte, digestSize)
+	numeratorBytes := t.numerator.Bytes()
+	copy(valueBytes[digestSize-len(numeratorBytes):], numeratorBytes)
+
+	return valueBytes
+}
+
+func digestElement(kind byte, data ...[]byte) *big.Int {
+	xof, _ := blake2b.NewXOF(digestSize, nil)
+	xof.Write([]byte{kind})
+	for _, d := range data {
+		xof.Write(d)
+	}
+
+	elementBytes := make([]byte, digestSize)
+	xof.Read(elementBytes)
+
+	element := new(big.Int).SetBytes(elementBytes)
+	element.Mod(element, digestPrime)
+	// zero has no inverse, the chance to hash to it is negligible
+	if element.Sign() == 0 {
+		element.SetInt64(1)
+	}
+
+	return element
+}
+
+func assetElement(asset string, total uint64) *big.Int {
+	totalBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(totalBytes, total)
+	return digestElement(digestAsset, []byte(asset), totalBytes)
+}
@@ -2,20 +2,25 @@ package ledger
 
 import (
 	"encoding/hex"
+	"encoding/json"
+
+	"github.com/blockcypher/libgrin/core"
 	"github.com/olegabu/go-secp256k1-zkp"
 	"github.com/pkg/errors"
 )
 
 func PersistTransaction(tx *Transaction, db Database, doublespend bool) error {
-	// check if inputs exist and mark them spent
+	// check all inputs exist before marking any spent, not to leave a failed transaction half written in the batch
 	for i, input := range tx.Body.Inputs {
 		err := db.InputExists(input)
 		if err != nil {
 			return errors.Wrapf(err, "input does not exist: %v at position %v", input.Commit, i)
 		}
+	}
 
-		if !doublespend {
-			err = db.SpendInput(input)
+	if !doublespend {
+		for i, input := range tx.Body.Inputs {
+			err := db.SpendInput(input)
 			if err != nil {
 				return errors.Wrapf(err, "cannot mark input as spent: %v at position %v", input.Commit, i)
 			}
@@ -34,41 +39,60 @@ func PersistTransaction(tx *Transaction, db Database, doublespend bool) error {
 		return errors.New("expected one kernel in transaction")
 	}
 
-	// reconstitute full kernel from tx kernel and offset and save it
-	kernel := tx.Body.Kernels[0]
+	kernel, err := FullKernel(&tx.Transaction)
+	if err != nil {
+		return errors.Wrap(err, "cannot get FullKernel")
+	}
+
+	err = db.PutKernel(kernel)
+	if err != nil {
+		return errors.Wrapf(err, "cannot save kernel: %v", kernel)
+	}
+
+	return nil
+}
+
+// FullKernel reconstitutes full kernel from tx kernel and offset: excess of the full kernel is KE + offset*G
+func FullKernel(tx *core.Transaction) (kernel core.TxKernel, err error) {
+	if len(tx.Body.Kernels) != 1 {
+		err = errors.New("expected one kernel in transaction")
+		return
+	}
+
+	kernel = tx.Body.Kernels[0]
 
 	context, err := secp256k1.ContextCreate(secp256k1.ContextBoth)
 	if err != nil {
-		return errors.Wrap(err, "cannot ContextCreate")
+		err = errors.Wrap(err, "cannot ContextCreate")
+		return
 	}
 
 	defer secp256k1.ContextDestroy(context)
 
 	excess, err := secp256k1.CommitmentFromString(kernel.Excess)
 	if err != nil {
-		return errors.Wrap(err, "cannot CommitmentFromString")
+		err = errors.Wrap(err, "cannot CommitmentFromString")
+		return
 	}
 
 	offsetBytes, _ := hex.DecodeString(tx.Offset)
 	kernelOffset, err := secp256k1.Commit(context, offsetBytes, 0, &secp256k1.GeneratorH, &secp256k1.GeneratorG)
 	if err != nil {
-		return errors.Wrap(err, "cannot Commit")
+		err = errors.Wrap(err, "cannot Commit")
+		return
 	}
 
 	fullExcess, err := secp256k1.CommitSum(context, []*secp256k1.Commitment{excess, kernelOffset}, []*secp256k1.Commitment{})
 	if err != nil {
-		return errors.Wrap(err, "cannot CommitSum")
+		err = errors.Wrap(err, "cannot CommitSum")
+		return
 	}
 
 	kernel.Excess = fullExcess.String()
 
-	err = db.PutKernel(kernel)
-	if err != nil {
-		return errors.Wrapf(err, "cannot save kernel: %v", kernel)
-	}
-
-	return nil
+	return
 }
+
 func PersistIssue(issue *Issue, db Database) error {
 	// save new output
 	err := db.PutOutput(issue.Output)
@@ -87,3 +111,156 @@ func PersistIssue(issue *Issue, db Database) error {
 
 	return nil
 }
+
+// PersistBlock completes block header with the sum of kernel offsets of its transactions
+// and a summary of the ledger state after the block from its running digest, then saves both
+// in the batch of the block, to be committed together with the state
+func PersistBlock(block *Block, offsets []string, state *StateDigest, db Database) error {
+	totalOffset, err := SumOffsets(offsets)
+	if err != nil {
+		return errors.Wrap(err, "cannot SumOffsets")
+	}
+	block.TotalOffset = totalOffset
+
+	block.NumOutputs = state.NumOutputs
+	block.NumKernels = state.NumKernels
+	block.StateRoot = hex.EncodeToString(state.Root())
+
+	err = db.PutBlock(*block)
+	if err != nil {
+		return errors.Wrapf(err, "cannot save block %v", block.Height)
+	}
+
+	digestBytes, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal state digest")
+	}
+	err = db.PutStateDigest(digestBytes)
+	if err != nil {
+		return errors.Wrap(err, "cannot PutStateDigest")
+	}
+
+	return nil
+}
+
+// SumOffsets adds up hex encoded kernel offsets, returns zero offset for an empty list
+func SumOffsets(offsets []string) (sum string, err error) {
+	var sumBytes [32]byte
+
+	if len(offsets) > 0 {
+		context, e := secp256k1.ContextCreate(secp256k1.ContextBoth)
+		if e != nil {
+			err = errors.Wrap(e, "cannot ContextCreate")
+			return
+		}
+		defer secp256k1.ContextDestroy(context)
+
+		var blinds [][]byte
+		for i, offset := range offsets {
+			offsetBytes, e := hex.DecodeString(offset)
+			if e != nil {
+				err = errors.Wrapf(e, "cannot decode offset #%d", i)
+				return
+			}
+			blinds = append(blinds, offsetBytes)
+		}
+
+		sumBytes, err = secp256k1.BlindSum(context, blinds, nil)
+		if err != nil {
+			err = errors.Wrap(err, "cannot BlindSum")
+			return
+		}
+	}
+
+	return hex.EncodeToString(sumBytes[:]), nil
+}
+
+// StateRoot hashes output commitments, kernel excesses and asset totals into the root of their digest,
+// which does not depend on the order the database lists them in
+func StateRoot(outputs []core.Output, kernels []core.TxKernel, assets map[string]uint64) []byte {
+	return NewStateDigest(outputs, kernels, assets).Root()
+}
+
+// ExportState takes a snapshot of everything the ledger holds
+func ExportState(db Database) (state *State, err error) {
+	state = &State{}
+
+	state.Outputs, err = db.ListOutputs()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListOutputs")
+	}
+	state.Kernels, err = db.ListKernels()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListKernels")
+	}
+	state.Assets, err = db.ListAssets()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ListAssets")
+	}
+
+	state.Height, err = db.GetHeight()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetHeight")
+	}
+	if state.Height > 0 {
+		block, err := db.GetBlock(state.Height)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot GetBlock %v", state.Height)
+		}
+		state.StateRoot = block.StateRoot
+	} else {
+		// a ledger without blocks yet has only what was imported into it
+		state.StateRoot = hex.EncodeToString(StateRoot(state.Outputs, state.Kernels, state.Assets))
+	}
+
+	return
+}
+
+// ImportState saves outputs, kernels and assets of the snapshot into the ledger
+func ImportState(state *State, db Database) error {
+	err := checkStateRoot(state)
+	if err != nil {
+		return errors.Wrap(err, "cannot checkStateRoot")
+	}
+
+	db.Begin()
+
+	for i, output := range state.Outputs {
+		err := db.PutOutput(output)
+		if err != nil {
+			return errors.Wrapf(err, "cannot save output: %v at position %v", output.Commit, i)
+		}
+	}
+
+	for i, kernel := range state.Kernels {
+		err := db.PutKernel(kernel)
+		if err != nil {
+			return errors.Wrapf(err, "cannot save kernel: %v at position %v", kernel.Excess, i)
+		}
+	}
+
+	for asset, value := range state.Assets {
+		db.AddAsset(asset, value)
+	}
+
+	err = db.Commit()
+	if err != nil {
+		return errors.Wrap(err, "cannot Commit")
+	}
+
+	return nil
+}
+
+// checkStateRoot checks the snapshot has not been changed since it was exported, snapshots without a state root are refused
+func checkStateRoot(state *State) error {
+	if len(state.StateRoot) == 0 {
+		return errors.New("snapshot has no state root")
+	}
+
+	stateRoot := hex.EncodeToString(StateRoot(state.Outputs, state.Kernels, state.Assets))
+	if stateRoot != state.StateRoot {
+		return errors.Errorf("state root %v of the snapshot does not match its contents %v", state.StateRoot, stateRoot)
+	}
+
+	return nil
+}
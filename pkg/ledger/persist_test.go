@@ -0,0 +1,303 @@
+package ledger_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blockcypher/libgrin/core"
+	"github.com/olegabu/go-mimblewimble/internal/abci"
+	"github.com/olegabu/go-mimblewimble/internal/wallet"
+	"github.com/olegabu/go-mimblewimble/pkg/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testExcess = "08764a0c0d67bc674b958d756642aa5ba2b2371d4eae6bea22debe9a2ea62844e6"
+	testOffset = "0000000000000000000000000000000000000000000000000000000000000001"
+)
+
+func newTestLedger(t *testing.T) (db ledger.Database, close func()) {
+	dir, err := ioutil.TempDir("", "mw_ledger_test")
+	assert.NoError(t, err)
+
+	db, err = abci.NewLeveldbDatabase(dir)
+	assert.NoError(t, err)
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// commitBlock persists the block the way the node does and returns its header
+func commitBlock(t *testing.T, db ledger.Database, state *ledger.StateDigest, height int64, offsets []string) ledger.Block {
+	block := &ledger.Block{Height: height, Time: time.Now()}
+
+	err := ledger.PersistBlock(block, offsets, state, db)
+	assert.NoError(t, err)
+	err = db.Commit()
+	assert.NoError(t, err)
+
+	saved, err := db.GetBlock(height)
+	assert.NoError(t, err)
+	return saved
+}
+
+func scanStateRoot(t *testing.T, db ledger.Database) string {
+	outputs, err := db.ListOutputs()
+	assert.NoError(t, err)
+	kernels, err := db.ListKernels()
+	assert.NoError(t, err)
+	assets, err := db.ListAssets()
+	assert.NoError(t, err)
+	return hex.EncodeToString(ledger.StateRoot(outputs, kernels, assets))
+}
+
+func TestPersistBlock(t *testing.T) {
+	db, close := newTestLedger(t)
+	defer close()
+
+	state, err := ledger.LoadStateDigest(db)
+	assert.NoError(t, err)
+
+	// two issues of the same asset in one block
+	db.Begin()
+	pending := state.Copy()
+	for _, issue := range []*ledger.Issue{
+		{Output: core.Output{Commit: "0801"}, Value: 3, Asset: "cash", Kernel: core.TxKernel{Excess: "0901"}},
+		{Output: core.Output{Commit: "0802"}, Value: 4, Asset: "cash", Kernel: core.TxKernel{Excess: "0902"}},
+	} {
+		err = ledger.PersistIssue(issue, db)
+		assert.NoError(t, err)
+		pending.AddIssue(issue)
+	}
+	block := commitBlock(t, db, pending, 1, nil)
+	state = pending
+
+	assets, err := db.ListAssets()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), assets["cash"])
+
+	assert.Equal(t, 2, block.NumOutputs)
+	assert.Equal(t, 2, block.NumKernels)
+	assert.Equal(t, scanStateRoot(t, db), block.StateRoot)
+	assert.Equal(t, hex.EncodeToString(make([]byte, 32)), block.TotalOffset)
+
+	// a transfer spends an issued output
+	tx := &ledger.Transaction{Transaction: core.Transaction{
+		Offset: testOffset,
+		Body: core.TransactionBody{
+			Inputs:  []core.Input{{Commit: "0801"}},
+			Outputs: []core.Output{{Commit: "0803"}, {Commit: "0804"}},
+			Kernels: []core.TxKernel{{Excess: testExcess}},
+		},
+	}}
+
+	db.Begin()
+	pending = state.Copy()
+	err = ledger.PersistTransaction(tx, db, false)
+	assert.NoError(t, err)
+	kernel, err := ledger.FullKernel(&tx.Transaction)
+	assert.NoError(t, err)
+	pending.AddTransaction(tx, kernel, false)
+	block = commitBlock(t, db, pending, 2, []string{tx.Offset})
+
+	assert.Equal(t, 3, block.NumOutputs)
+	assert.Equal(t, 3, block.NumKernels)
+	assert.Equal(t, scanStateRoot(t, db), block.StateRoot)
+	assert.Equal(t, testOffset, block.TotalOffset)
+
+	height, err := db.GetHeight()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), height)
+
+	// the digest saved with the block picks up where it left off
+	loaded, err := ledger.LoadStateDigest(db)
+	assert.NoError(t, err)
+	assert.Equal(t, block.StateRoot, hex.EncodeToString(loaded.Root()))
+	assert.Equal(t, 3, loaded.NumOutputs)
+
+	// a transaction spending a missing output leaves nothing in the batch
+	db.Begin()
+	err = ledger.PersistTransaction(&ledger.Transaction{Transaction: core.Transaction{
+		Offset: testOffset,
+		Body: core.TransactionBody{
+			Inputs:  []core.Input{{Commit: "0802"}, {Commit: "0801"}},
+			Kernels: []core.TxKernel{{Excess: testExcess}},
+		},
+	}}, db, false)
+	assert.Error(t, err)
+	err = db.Commit()
+	assert.NoError(t, err)
+	_, err = db.GetOutput([]byte("0802"))
+	assert.NoError(t, err)
+}
+
+func TestSumOffsets(t *testing.T) {
+	sum, err := ledger.SumOffsets(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(make([]byte, 32)), sum)
+
+	sum, err = ledger.SumOffsets([]string{testOffset})
+	assert.NoError(t, err)
+	assert.Equal(t, testOffset, sum)
+
+	two := "0000000000000000000000000000000000000000000000000000000000000002"
+	sum, err = ledger.SumOffsets([]string{testOffset, two})
+	assert.NoError(t, err)
+	assert.Equal(t, "0000000000000000000000000000000000000000000000000000000000000003", sum)
+
+	_, err = ledger.SumOffsets([]string{"not hex"})
+	assert.Error(t, err)
+}
+
+func TestStateRoot(t *testing.T) {
+	outputs := []core.Output{{Commit: "0801"}, {Commit: "0802"}}
+	kernels := []core.TxKernel{{Excess: "0901"}}
+	assets := map[string]uint64{"cash": 3, "apple": 1}
+
+	root := ledger.StateRoot(outputs, kernels, assets)
+	assert.Equal(t, 32, len(root))
+
+	// the order does not matter
+	reversed := []core.Output{outputs[1], outputs[0]}
+	assert.Equal(t, root, ledger.StateRoot(reversed, kernels, assets))
+
+	// every part of the state does
+	assert.NotEqual(t, root, ledger.StateRoot(outputs[:1], kernels, assets))
+	assert.NotEqual(t, root, ledger.StateRoot(outputs, nil, assets))
+	assert.NotEqual(t, root, ledger.StateRoot(outputs, kernels, map[string]uint64{"cash": 4, "apple": 1}))
+	// an output is not taken for a kernel with the same string
+	assert.NotEqual(t, ledger.StateRoot(outputs, nil, nil), ledger.StateRoot(nil, []core.TxKernel{{Excess: "0801"}, {Excess: "0802"}}, nil))
+
+	// adding and removing elements of the running digest gets to the same root
+	digest := ledger.NewStateDigest(outputs[:1], nil, map[string]uint64{"cash": 1})
+	digest.AddOutput("0809")
+	digest.AddOutput("0802")
+	digest.RemoveOutput("0809")
+	digest.AddKernel("0901")
+	digest.AddAsset("cash", 2)
+	digest.AddAsset("apple", 1)
+	assert.Equal(t, root, digest.Root())
+	assert.Equal(t, 2, digest.NumOutputs)
+}
+
+// newTestState fills the ledger with issues and a transfer made by a wallet, and returns its export
+func newTestState(t *testing.T, db ledger.Database) *ledger.State {
+	dir, err := ioutil.TempDir("", "mw_ledger_test_wallet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := wallet.NewWalletWithoutMasterKey(dir)
+	assert.NoError(t, err)
+	defer w.Close()
+	_, err = w.InitMasterKey("", "", wallet.DefaultMnemonicWords, "")
+	assert.NoError(t, err)
+
+	state, err := ledger.LoadStateDigest(db)
+	assert.NoError(t, err)
+	db.Begin()
+
+	for _, asset := range []string{"cash", "apple"} {
+		issueBytes, err := w.Issue(10, asset)
+		assert.NoError(t, err)
+		issue, err := ledger.ValidateIssueBytes(issueBytes)
+		assert.NoError(t, err)
+		err = ledger.PersistIssue(issue, db)
+		assert.NoError(t, err)
+		state.AddIssue(issue)
+	}
+	commitBlock(t, db, state, 1, nil)
+
+	// a transfer paying a fee spends an issued output in the next block
+	db.Begin()
+	w.SetFee(1)
+	txBytes, err := w.Split(4, 2, "cash")
+	assert.NoError(t, err)
+	tx, err := ledger.ValidateTransactionBytes(txBytes)
+	assert.NoError(t, err)
+	assert.NotZero(t, tx.Body.Kernels[0].Fee)
+	err = ledger.PersistTransaction(tx, db, false)
+	assert.NoError(t, err)
+	kernel, err := ledger.FullKernel(&tx.Transaction)
+	assert.NoError(t, err)
+	state.AddTransaction(tx, kernel, false)
+
+	commitBlock(t, db, state, 2, []string{tx.Offset})
+
+	exported, err := ledger.ExportState(db)
+	assert.NoError(t, err)
+
+	return exported
+}
+
+func TestExportImportState(t *testing.T) {
+	db, close := newTestLedger(t)
+	defer close()
+
+	state := newTestState(t, db)
+	assert.Equal(t, int64(2), state.Height)
+	assert.Equal(t, 4, len(state.Outputs))
+	assert.Equal(t, 3, len(state.Kernels))
+	assert.Equal(t, scanStateRoot(t, db), state.StateRoot)
+
+	stateBytes, err := json.Marshal(state)
+	assert.NoError(t, err)
+
+	// audit
+	_, msg, err := ledger.ValidateStateBytes(stateBytes)
+	assert.NoError(t, err)
+	assert.Contains(t, msg, "4 outputs, 3 kernels")
+
+	// import into a fresh ledger
+	imported, closeImported := newTestLedger(t)
+	defer closeImported()
+
+	err = ledger.ImportState(state, imported)
+	assert.NoError(t, err)
+	assert.Equal(t, state.StateRoot, scanStateRoot(t, imported))
+
+	assets, err := imported.ListAssets()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Assets, assets)
+}
+
+func TestImportTamperedState(t *testing.T) {
+	db, close := newTestLedger(t)
+	defer close()
+
+	state := newTestState(t, db)
+
+	// an output swapped for another breaks the state root
+	tampered := *state
+	tampered.Outputs = append([]core.Output{}, state.Outputs...)
+	tampered.Outputs[0] = state.Outputs[1]
+
+	tamperedBytes, err := json.Marshal(tampered)
+	assert.NoError(t, err)
+	_, _, err = ledger.ValidateStateBytes(tamperedBytes)
+	assert.Error(t, err)
+
+	imported, closeImported := newTestLedger(t)
+	defer closeImported()
+	err = ledger.ImportState(&tampered, imported)
+	assert.Error(t, err)
+	outputs, err := imported.ListOutputs()
+	assert.NoError(t, err)
+	assert.Empty(t, outputs)
+
+	// a snapshot with the state root stripped is refused
+	tampered = *state
+	tampered.StateRoot = ""
+
+	tamperedBytes, err = json.Marshal(tampered)
+	assert.NoError(t, err)
+	_, _, err = ledger.ValidateStateBytes(tamperedBytes)
+	assert.Error(t, err)
+	err = ledger.ImportState(&tampered, imported)
+	assert.Error(t, err)
+}
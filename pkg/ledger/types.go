@@ -1,6 +1,8 @@
 package ledger
 
 import (
+	"time"
+
 	"github.com/blockcypher/libgrin/core"
 	"github.com/google/uuid"
 )
@@ -14,11 +16,20 @@ type Database interface {
 	Close()
 	GetOutput(id []byte) (output core.Output, err error)
 	ListOutputs() (list []core.Output, err error)
+	ListOutputsAfter(commit []byte, limit int) (list []core.Output, err error)
 	PutKernel(kernel core.TxKernel) error
+	GetKernel(id []byte) (kernel core.TxKernel, err error)
 	ListKernels() (list []core.TxKernel, err error)
 	AddAsset(asset string, value uint64)
 	ListAssets() (list map[string]uint64, err error)
 	ResetAssets() error
+	// PutBlock and PutStateDigest write into the batch started with Begin
+	PutBlock(block Block) error
+	GetBlock(height int64) (block Block, err error)
+	GetHeight() (height int64, err error)
+	PutStateDigest(digest []byte) error
+	// GetStateDigest returns nil if no digest has been saved yet
+	GetStateDigest() (digest []byte, err error)
 }
 
 type Transaction struct {
@@ -34,3 +45,23 @@ type Issue struct {
 	IssuerCert []byte        `json:"issue_cert,omitempty"`
 	Kernel     core.TxKernel `json:"kernel,omitempty"`
 }
+
+// Block is a header of a committed block: kernels it added to the ledger and a summary of the state after it
+type Block struct {
+	Height      int64     `json:"height"`
+	Time        time.Time `json:"time"`
+	Kernels     []string  `json:"kernels"`
+	TotalOffset string    `json:"total_offset"`
+	NumOutputs  int       `json:"num_outputs"`
+	NumKernels  int       `json:"num_kernels"`
+	StateRoot   string    `json:"state_root"`
+}
+
+// State is a portable snapshot of the ledger, state root is of the last block if the ledger has any
+type State struct {
+	Height    int64             `json:"height"`
+	StateRoot string            `json:"state_root,omitempty"`
+	Outputs   []core.Output     `json:"outputs"`
+	Kernels   []core.TxKernel   `json:"kernels"`
+	Assets    map[string]uint64 `json:"assets"`
+}
@@ -31,9 +31,6 @@ func Parse(bytes []byte) (tx *Transaction, issue *Issue, err error) {
 
 func CommitValue(value uint64, asset string) uint64 {
 	//TODO this is a temp fix. Need to blind the value generator H as secp256k1.Commit takes uint64 for value not big int we get from multiplying asset hash and value
-
-	fmt.Printf("value %v\n", value)
-
 	if len(asset) == 0 {
 		return value
 	}
@@ -55,10 +52,8 @@ func CommitValue(value uint64, asset string) uint64 {
 	assetHash, _ := blake2b.New(4, nil)
 	assetHash.Write([]byte(asset))
 	assetHashBytes := assetHash.Sum(nil)
-	fmt.Printf("assetHashBytes %v\n", assetHashBytes)
 
 	assetHashInt := uint64(binary.BigEndian.Uint32(assetHashBytes))
-	fmt.Printf("assetHashInt %v\n", assetHashInt)
 
 	res := value * assetHashInt
 
@@ -73,9 +68,6 @@ func CommitValue(value uint64, asset string) uint64 {
 	//fmt.Printf("resBig %v\n", resBig)
 	//
 	//res := resBig.Uint64()
-
-	fmt.Printf("res %v\n", res)
-
 	return res
 }
 
@@ -176,6 +168,24 @@ func ValidateIssueBytes(issueBytes []byte) (ledgerIssue *Issue, err error) {
 	return
 }
 
+func ValidateStateBytes(stateBytes []byte) (state *State, msg string, err error) {
+	state = &State{}
+
+	err = json.Unmarshal(stateBytes, state)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot unmarshal json to State")
+	}
+
+	err = checkStateRoot(state)
+	if err != nil {
+		return state, "", errors.Wrap(err, "cannot checkStateRoot")
+	}
+
+	msg, err = ValidateState(state.Outputs, state.Kernels, state.Assets)
+
+	return
+}
+
 func ValidateState(outputs []core.Output, kernels []core.TxKernel, assets map[string]uint64) (msg string, err error) {
 	var totalIssues uint64
 	for _, t := range assets {
@@ -222,6 +232,9 @@ func ValidateState(outputs []core.Output, kernels []core.TxKernel, assets map[st
 		outputCommitments = append(outputCommitments, com)
 	}
 
+	zero32 := [32]byte{}
+	zero := zero32[:]
+
 	for i, kernel := range kernels {
 		com, e := secp256k1.CommitmentFromString(kernel.Excess)
 		if e != nil {
@@ -229,10 +242,21 @@ func ValidateState(outputs []core.Output, kernels []core.TxKernel, assets map[st
 			return
 		}
 		excessCommitments = append(excessCommitments, com)
+
+		// fees paid by transfers left the outputs, add them back with a zero blind F = 0*G + fee*H,
+		// one commitment per kernel as the sum of fees may not fit uint64
+		if kernel.Fee > 0 {
+			feeCommitment, e := secp256k1.Commit(context, zero, uint64(kernel.Fee), &secp256k1.GeneratorH, &secp256k1.GeneratorG)
+			if e != nil {
+				err = errors.Wrapf(e, "cannot Commit fee of kernel #%d", i)
+				return
+			}
+			outputCommitments = append(outputCommitments, feeCommitment)
+		}
 	}
 
 	// subtract all kernel excesses (from issues and transfers) from all remaining outputs
-	// sum(O) - (sum(KE) + sum(offset)*G + sum(KEI))
+	// sum(O) + F - (sum(KE) + sum(offset)*G + sum(KEI))
 	sumCommitment, err := secp256k1.CommitSum(context, outputCommitments, excessCommitments)
 	if err != nil {
 		err = errors.Wrap(err, "cannot CommitSum outputCommitments, excessCommitments")
@@ -240,8 +264,6 @@ func ValidateState(outputs []core.Output, kernels []core.TxKernel, assets map[st
 	}
 
 	// commitment to total tokens issued is with a zero blind TI = 0*G + totalIssues*H
-	zero32 := [32]byte{}
-	zero := zero32[:]
 
 	for asset, total := range assets {
 		issueValue := CommitValue(total, asset)
@@ -318,9 +340,11 @@ func validateSignature(context *secp256k1.Context, tx *core.Transaction) error {
 	return nil
 }
 
-// msg = hash(features)                       for coinbase kernels
-//       hash(features || fee)                for plain kernels
-//       hash(features || fee || lock_height) for height locked kernels
+// KernelSignatureMessage is the message kernel excess signs:
+//
+//	hash(features)                       for coinbase kernels
+//	hash(features || fee)                for plain kernels
+//	hash(features || fee || lock_height) for height locked kernels
 func KernelSignatureMessage(kernel core.TxKernel) []byte {
 
 	featuresBytes := []byte{byte(kernel.Features)}
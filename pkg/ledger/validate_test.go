@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/blockcypher/libgrin/libwallet"
+	"github.com/olegabu/go-secp256k1-zkp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -286,6 +287,34 @@ func TestValidateState(t *testing.T) {
 	fmt.Println(msg)
 }
 
+func TestValidateStateFees(t *testing.T) {
+	context, err := secp256k1.ContextCreate(secp256k1.ContextBoth)
+	assert.NoError(t, err)
+	defer secp256k1.ContextDestroy(context)
+
+	zero := make([]byte, 32)
+	commit := func(value uint64) string {
+		com, err := secp256k1.Commit(context, zero, value, &secp256k1.GeneratorH, &secp256k1.GeneratorG)
+		assert.NoError(t, err)
+		return com.String()
+	}
+
+	// all issued value went to fees of two kernels whose sum overflows uint64
+	assets := map[string]uint64{"cash": 1}
+	fee := uint64(1) << 63
+	kernels := []core.TxKernel{
+		{Features: core.PlainKernel, Fee: core.Uint64(fee), Excess: commit(fee - CommitValue(1, "cash"))},
+		{Features: core.PlainKernel, Fee: core.Uint64(fee), Excess: commit(fee)},
+	}
+
+	_, err = ValidateState(nil, kernels, assets)
+	assert.NoError(t, err)
+
+	kernels[1].Fee--
+	_, err = ValidateState(nil, kernels, assets)
+	assert.Error(t, err)
+}
+
 var testData []string = []string{
 	/* 1g_rep.json */
 	`{
@@ -0,0 +1,93 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	checksumSize = 4
+	bitsPerWord  = 11
+	headerSize   = 4
+)
+
+// Mnemonic encodes the share as words of the BIP39 word list, 11 bits each: id, threshold, index and value
+// of the share followed by 4 bytes of their SHA-256, the last word padded with zero bits.
+// This is not the SLIP-39 encoding
+func (t Share) Mnemonic() string {
+	data := make([]byte, headerSize, headerSize+len(t.Value)+checksumSize)
+	binary.BigEndian.PutUint16(data[0:2], t.ID)
+	data[2] = t.Threshold
+	data[3] = t.Index
+	data = append(data, t.Value...)
+	data = append(data, checksum(data)...)
+
+	wordList := bip39.GetWordList()
+	var words []string
+
+	var acc, accBits uint
+	for _, b := range data {
+		acc = acc<<8 | uint(b)
+		accBits += 8
+		for accBits >= bitsPerWord {
+			accBits -= bitsPerWord
+			words = append(words, wordList[acc>>accBits&(1<<bitsPerWord-1)])
+		}
+	}
+	if accBits > 0 {
+		words = append(words, wordList[acc<<(bitsPerWord-accBits)&(1<<bitsPerWord-1)])
+	}
+
+	return strings.Join(words, " ")
+}
+
+// ShareFromMnemonic decodes a share and verifies its checksum
+func ShareFromMnemonic(mnemonic string) (share Share, err error) {
+	words := strings.Fields(mnemonic)
+
+	var data []byte
+	var acc, accBits uint
+	for _, word := range words {
+		index, ok := bip39.GetWordIndex(word)
+		if !ok {
+			return Share{}, errors.Errorf("unknown word %v", word)
+		}
+		acc = acc<<bitsPerWord | uint(index)
+		accBits += bitsPerWord
+		for accBits >= 8 {
+			accBits -= 8
+			data = append(data, byte(acc>>accBits))
+		}
+	}
+
+	// padding of the last word may have made a byte of zero bits, checksum tells if it is one
+	for size := len(data); size > headerSize+checksumSize && size*8 > (len(words)-1)*bitsPerWord; size-- {
+		payload := data[:size-checksumSize]
+		if !bytes.Equal(checksum(payload), data[size-checksumSize:size]) {
+			continue
+		}
+
+		share = Share{
+			ID:        binary.BigEndian.Uint16(payload[0:2]),
+			Threshold: payload[2],
+			Index:     payload[3],
+			Value:     append([]byte{}, payload[headerSize:]...),
+		}
+		if share.Threshold == 0 || share.Index == 0 {
+			return Share{}, errors.Errorf("share threshold %d or index %d is invalid", share.Threshold, share.Index)
+		}
+		return share, nil
+	}
+
+	return Share{}, errors.New("invalid share checksum")
+}
+
+func checksum(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	return hash[:checksumSize]
+}
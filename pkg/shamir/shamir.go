@@ -0,0 +1,147 @@
+// Package shamir splits a secret into shares any threshold of which recover it, with Shamir's secret sharing
+// over GF(256), and encodes shares as mnemonics of the BIP39 word list with a 4 byte SHA-256 checksum.
+// Shares and their mnemonics are not interoperable with SLIP-39: other wallets cannot read or combine them
+package shamir
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// Share is a point on polynomials of degree threshold-1, one per byte of the secret, at x = Index.
+// Shares of the same split have the same random ID
+type Share struct {
+	ID        uint16
+	Threshold byte
+	Index     byte
+	Value     []byte
+}
+
+// exp and log tables of GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1 and generator 3
+var (
+	expTable [255]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+
+		// multiply by 3: x*2 reduced by the polynomial, plus x
+		double := x << 1
+		if x&0x80 != 0 {
+			double ^= 0x1b
+		}
+		x ^= double
+	}
+}
+
+func mul(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a byte, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// Split makes count shares of the secret any threshold of which recover it
+func Split(secret []byte, threshold int, count int) (shares []Share, err error) {
+	if threshold < 1 || threshold > count || count > 255 {
+		return nil, errors.Errorf("cannot split into %d shares with threshold %d", count, threshold)
+	}
+
+	if len(secret) == 0 {
+		return nil, errors.New("cannot split empty secret")
+	}
+
+	idBytes := make([]byte, 2)
+	_, err = rand.Read(idBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read random id")
+	}
+	id := binary.BigEndian.Uint16(idBytes)
+
+	for i := 1; i <= count; i++ {
+		shares = append(shares, Share{ID: id, Threshold: byte(threshold), Index: byte(i), Value: make([]byte, len(secret))})
+	}
+
+	// random coefficients of a polynomial whose value at 0 is the byte of the secret
+	coefficients := make([]byte, threshold)
+
+	for b, s := range secret {
+		coefficients[0] = s
+		_, err = rand.Read(coefficients[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read random coefficients")
+		}
+
+		for i := range shares {
+			// Horner's scheme from the highest coefficient
+			var y byte
+			for c := threshold - 1; c >= 0; c-- {
+				y = mul(y, shares[i].Index) ^ coefficients[c]
+			}
+			shares[i].Value[b] = y
+		}
+	}
+
+	return
+}
+
+// Combine recovers the secret from threshold shares of the same split by Lagrange interpolation at x = 0
+func Combine(shares []Share) (secret []byte, err error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares to combine")
+	}
+
+	first := shares[0]
+	threshold := int(first.Threshold)
+
+	// zero shares would combine into a secret of zeros
+	if threshold == 0 {
+		return nil, errors.New("share threshold is 0")
+	}
+	if len(shares) < threshold {
+		return nil, errors.Errorf("need %d shares, got %d", threshold, len(shares))
+	}
+	shares = shares[:threshold]
+
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if share.ID != first.ID || share.Threshold != first.Threshold || len(share.Value) != len(first.Value) {
+			return nil, errors.New("shares are not of the same split")
+		}
+		if share.Index == 0 || seen[share.Index] {
+			return nil, errors.Errorf("share index %d is invalid or repeated", share.Index)
+		}
+		seen[share.Index] = true
+	}
+
+	secret = make([]byte, len(first.Value))
+
+	for i, share := range shares {
+		// basis polynomial of the share at 0 is the product of x_j / (x_j - x_i), subtraction is xor
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = mul(basis, div(other.Index, other.Index^share.Index))
+			}
+		}
+
+		for b, y := range share.Value {
+			secret[b] ^= mul(y, basis)
+		}
+	}
+
+	return
+}
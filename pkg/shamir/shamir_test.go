@@ -0,0 +1,91 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := make([]byte, 64)
+	_, err := rand.Read(secret)
+	assert.NoError(t, err)
+
+	shares, err := Split(secret, 3, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(shares))
+
+	// any 3 of 5 recover the secret
+	for _, indexes := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var subset []Share
+		for _, i := range indexes {
+			subset = append(subset, shares[i])
+		}
+		combined, err := Combine(subset)
+		assert.NoError(t, err)
+		assert.Equal(t, secret, combined)
+	}
+
+	// 2 are not enough
+	_, err = Combine(shares[:2])
+	assert.Error(t, err)
+
+	// the same share twice is not two shares
+	_, err = Combine([]Share{shares[0], shares[0], shares[1]})
+	assert.Error(t, err)
+
+	// shares of another split do not mix
+	other, err := Split(secret, 3, 5)
+	assert.NoError(t, err)
+	other[0].ID = shares[0].ID + 1
+	_, err = Combine([]Share{other[0], shares[1], shares[2]})
+	assert.Error(t, err)
+
+	_, err = Split(secret, 4, 3)
+	assert.Error(t, err)
+
+	// a share of threshold 0 does not combine into a secret of zeros
+	zero := shares[0]
+	zero.Threshold = 0
+	_, err = Combine([]Share{zero})
+	assert.Error(t, err)
+	_, err = ShareFromMnemonic(zero.Mnemonic())
+	assert.Error(t, err)
+}
+
+func TestMnemonic(t *testing.T) {
+	for size := 1; size <= 66; size++ {
+		secret := make([]byte, size)
+		_, err := rand.Read(secret)
+		assert.NoError(t, err)
+
+		shares, err := Split(secret, 2, 3)
+		assert.NoError(t, err)
+
+		for _, share := range shares {
+			mnemonic := share.Mnemonic()
+
+			decoded, err := ShareFromMnemonic(mnemonic)
+			assert.NoError(t, err)
+			assert.Equal(t, share, decoded)
+		}
+	}
+
+	shares, err := Split([]byte("secret"), 2, 3)
+	assert.NoError(t, err)
+	words := strings.Fields(shares[0].Mnemonic())
+
+	// a wrong word fails the checksum
+	if words[3] == "abandon" {
+		words[3] = "ability"
+	} else {
+		words[3] = "abandon"
+	}
+	_, err = ShareFromMnemonic(strings.Join(words, " "))
+	assert.Error(t, err)
+
+	_, err = ShareFromMnemonic("not a share")
+	assert.Error(t, err)
+}
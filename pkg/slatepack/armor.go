@@ -0,0 +1,141 @@
+package slatepack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	armorHeader   = "BEGINSLATEPACK."
+	armorFooter   = ". ENDSLATEPACK."
+	armorWordSize = 15
+	checksumSize  = 4
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// IsArmored tells armored slatepack from a json slate
+func IsArmored(data []byte) bool {
+	return bytes.Contains(data, []byte(armorHeader))
+}
+
+// Armor encodes binary slatepack with its checksum in base58 split into words between header and footer
+func Armor(data []byte) []byte {
+	encoded := base58CheckEncode(data)
+
+	var words []string
+	for len(encoded) > armorWordSize {
+		words = append(words, encoded[:armorWordSize])
+		encoded = encoded[armorWordSize:]
+	}
+	words = append(words, encoded)
+
+	return []byte(armorHeader + " " + strings.Join(words, " ") + armorFooter)
+}
+
+// Dearmor decodes binary slatepack from armored text, whitespace and text around the armor is ignored
+func Dearmor(armor []byte) (data []byte, err error) {
+	text := string(armor)
+
+	start := strings.Index(text, armorHeader)
+	if start < 0 {
+		return nil, errors.New("cannot find slatepack header")
+	}
+	text = text[start+len(armorHeader):]
+
+	end := strings.Index(text, armorFooter)
+	if end < 0 {
+		return nil, errors.New("cannot find slatepack footer")
+	}
+	text = strings.Join(strings.Fields(text[:end]), "")
+
+	data, err = base58CheckDecode(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot base58CheckDecode")
+	}
+
+	return
+}
+
+// checksum is the first 4 bytes of double sha256 and is prepended to data before encoding
+func checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:checksumSize]
+}
+
+func base58CheckEncode(data []byte) string {
+	return base58Encode(append(checksum(data), data...))
+}
+
+func base58CheckDecode(text string) (data []byte, err error) {
+	decoded, err := base58Decode(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot base58Decode")
+	}
+
+	if len(decoded) < checksumSize {
+		return nil, errors.New("data is shorter than checksum")
+	}
+
+	data = decoded[checksumSize:]
+	if !bytes.Equal(decoded[:checksumSize], checksum(data)) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	return
+}
+
+func base58Encode(data []byte) string {
+	x := new(big.Int).SetBytes(data)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	mod := new(big.Int)
+
+	var encoded []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+
+	// leading zero bytes are encoded as the first character of the alphabet
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	// reverse to big endian
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+
+	return string(encoded)
+}
+
+func base58Decode(text string) (data []byte, err error) {
+	x := new(big.Int)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+
+	for _, c := range []byte(text) {
+		i := strings.IndexByte(base58Alphabet, c)
+		if i < 0 {
+			return nil, errors.Errorf("invalid base58 character %q", c)
+		}
+		x.Mul(x, radix)
+		x.Add(x, big.NewInt(int64(i)))
+	}
+
+	var zeros int
+	for zeros < len(text) && text[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	data = append(make([]byte, zeros), x.Bytes()...)
+
+	return
+}
@@ -0,0 +1,196 @@
+package slatepack
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	version       = 1
+	modePlain     = 0
+	modeEncrypted = 1
+	keySize       = 32
+)
+
+// Slatepack is a slate with the address of its sender to respond to
+type Slatepack struct {
+	Sender    string
+	Encrypted bool
+	Payload   []byte
+}
+
+// Address encodes x25519 public key in base58 with a checksum
+func Address(publicKey []byte) string {
+	return base58CheckEncode(publicKey)
+}
+
+// ParseAddress decodes x25519 public key from address
+func ParseAddress(address string) (publicKey []byte, err error) {
+	publicKey, err = base58CheckDecode(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot decode address %v", address)
+	}
+
+	if len(publicKey) != keySize {
+		return nil, errors.Errorf("address %v is not a %d byte public key", address, keySize)
+	}
+
+	return
+}
+
+// PublicKey calculates x25519 public key from secret key
+func PublicKey(secretKey []byte) (publicKey []byte, err error) {
+	publicKey, err = curve25519.X25519(secretKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot X25519")
+	}
+	return
+}
+
+// Pack compresses slate payload, which is a slate the wallet encoded in binary, and the sender's address, encrypts them to recipient's address unless it is empty,
+// and armors the result.
+// Binary slatepack is: version | mode | [ephemeral public key | nonce] | body,
+// where body is sender's public key | deflated payload, encrypted in mode 1
+func Pack(payload []byte, senderPublicKey []byte, recipientAddress string) (armor []byte, err error) {
+	var compressed bytes.Buffer
+	writer, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	_, err = writer.Write(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot compress payload")
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot compress payload")
+	}
+
+	body := append(append([]byte{}, senderPublicKey...), compressed.Bytes()...)
+
+	if len(recipientAddress) == 0 {
+		return Armor(append([]byte{version, modePlain}, body...)), nil
+	}
+
+	recipientPublicKey, err := ParseAddress(recipientAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ParseAddress of recipient")
+	}
+
+	// encrypt with a key shared between a one time ephemeral key and recipient's key
+	ephemeralSecretKey := make([]byte, keySize)
+	_, err = rand.Read(ephemeralSecretKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot generate ephemeral key")
+	}
+
+	ephemeralPublicKey, err := PublicKey(ephemeralSecretKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get ephemeral PublicKey")
+	}
+
+	aead, err := newCipher(ephemeralSecretKey, recipientPublicKey, ephemeralPublicKey, recipientPublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create cipher")
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot generate nonce")
+	}
+
+	header := append(append([]byte{version, modeEncrypted}, ephemeralPublicKey...), nonce...)
+
+	return Armor(aead.Seal(header, nonce, body, header)), nil
+}
+
+// Unpack dearmors, decrypts with recipient's secret key if encrypted, and decompresses slate payload
+func Unpack(armor []byte, recipientSecretKey []byte) (pack *Slatepack, err error) {
+	data, err := Dearmor(armor)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot Dearmor")
+	}
+
+	if len(data) < 2 {
+		return nil, errors.New("slatepack is too short")
+	}
+
+	if data[0] != version {
+		return nil, errors.Errorf("unsupported slatepack version %d", data[0])
+	}
+
+	pack = &Slatepack{}
+
+	var body []byte
+
+	switch data[1] {
+	case modePlain:
+		body = data[2:]
+	case modeEncrypted:
+		pack.Encrypted = true
+
+		if len(data) < 2+keySize+chacha20poly1305.NonceSize {
+			return nil, errors.New("encrypted slatepack is too short")
+		}
+
+		header := data[:2+keySize+chacha20poly1305.NonceSize]
+		ephemeralPublicKey := header[2 : 2+keySize]
+		nonce := header[2+keySize:]
+
+		recipientPublicKey, e := PublicKey(recipientSecretKey)
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot get recipient PublicKey")
+		}
+
+		aead, e := newCipher(recipientSecretKey, ephemeralPublicKey, ephemeralPublicKey, recipientPublicKey)
+		if e != nil {
+			return nil, errors.Wrap(e, "cannot create cipher")
+		}
+
+		body, err = aead.Open(nil, nonce, data[len(header):], header)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decrypt slatepack, is it addressed to this wallet?")
+		}
+	default:
+		return nil, errors.Errorf("unsupported slatepack mode %d", data[1])
+	}
+
+	if len(body) < keySize {
+		return nil, errors.New("slatepack body is too short")
+	}
+
+	pack.Sender = Address(body[:keySize])
+
+	pack.Payload, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(body[keySize:])))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decompress payload")
+	}
+
+	return
+}
+
+// newCipher derives symmetric key from x25519 shared secret and both public keys
+func newCipher(secretKey []byte, publicKey []byte, ephemeralPublicKey []byte, recipientPublicKey []byte) (aead cipher.AEAD, err error) {
+	shared, err := curve25519.X25519(secretKey, publicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot X25519")
+	}
+
+	hash, _ := blake2b.New256(nil)
+	hash.Write(shared)
+	hash.Write(ephemeralPublicKey)
+	hash.Write(recipientPublicKey)
+
+	aead, err = chacha20poly1305.New(hash.Sum(nil))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create chacha20poly1305")
+	}
+
+	return
+}
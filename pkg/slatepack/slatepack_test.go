@@ -0,0 +1,67 @@
+package slatepack
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKey(t *testing.T) (secretKey []byte, publicKey []byte) {
+	secretKey = make([]byte, keySize)
+	_, err := rand.Read(secretKey)
+	assert.NoError(t, err)
+	publicKey, err = PublicKey(secretKey)
+	assert.NoError(t, err)
+	return
+}
+
+func TestArmor(t *testing.T) {
+	for _, data := range [][]byte{{}, {0, 0, 1}, []byte("slate")} {
+		armor := Armor(data)
+		assert.True(t, IsArmored(armor))
+
+		// surrounding text and line breaks are ignored
+		dearmored, err := Dearmor(append([]byte("please pay\n"), armor...))
+		assert.NoError(t, err)
+		assert.Equal(t, data, append([]byte{}, dearmored...))
+	}
+
+	armor := Armor([]byte("slate"))
+	armor[len(armorHeader)+3]++
+	_, err := Dearmor(armor)
+	assert.Error(t, err)
+}
+
+func TestPackPlain(t *testing.T) {
+	senderSecretKey, senderPublicKey := newTestKey(t)
+	payload := []byte(`{"amount":"1"}`)
+
+	armor, err := Pack(payload, senderPublicKey, "")
+	assert.NoError(t, err)
+
+	pack, err := Unpack(armor, senderSecretKey)
+	assert.NoError(t, err)
+	assert.False(t, pack.Encrypted)
+	assert.Equal(t, payload, pack.Payload)
+	assert.Equal(t, Address(senderPublicKey), pack.Sender)
+}
+
+func TestPackEncrypted(t *testing.T) {
+	_, senderPublicKey := newTestKey(t)
+	recipientSecretKey, recipientPublicKey := newTestKey(t)
+	otherSecretKey, _ := newTestKey(t)
+	payload := []byte(`{"amount":"1"}`)
+
+	armor, err := Pack(payload, senderPublicKey, Address(recipientPublicKey))
+	assert.NoError(t, err)
+
+	pack, err := Unpack(armor, recipientSecretKey)
+	assert.NoError(t, err)
+	assert.True(t, pack.Encrypted)
+	assert.Equal(t, payload, pack.Payload)
+	assert.Equal(t, Address(senderPublicKey), pack.Sender)
+
+	_, err = Unpack(armor, otherSecretKey)
+	assert.Error(t, err)
+}